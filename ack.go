@@ -2,13 +2,29 @@ package gosocketio
 
 import (
 	"errors"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var (
 	ErrorWaiterNotFound = errors.New("Waiter not found")
 )
 
+/**
+Ack response was not received within ack timeout, see WithAckTimeout
+*/
+type AckTimeoutError struct {
+	Method  string
+	AckId   int
+	Timeout time.Duration
+}
+
+func (e *AckTimeoutError) Error() string {
+	return "Ack " + strconv.Quote(e.Method) + " #" + strconv.Itoa(e.AckId) +
+		" timed out after " + e.Timeout.String()
+}
+
 /**
 Processes functions that require answers, also known as acknowledge or ack
 */
@@ -62,3 +78,25 @@ func (a *ackProcessor) getWaiter(id int) (chan string, error) {
 	}
 	return nil, ErrorWaiterNotFound
 }
+
+/**
+Remove all waiters, used when channel is closed
+*/
+func (a *ackProcessor) clearWaiters() {
+	a.resultWaitersLock.Lock()
+	defer a.resultWaitersLock.Unlock()
+
+	for id := range a.resultWaiters {
+		delete(a.resultWaiters, id)
+	}
+}
+
+/**
+Amount of waiters of not answered acks
+*/
+func (a *ackProcessor) waitersCount() int {
+	a.resultWaitersLock.RLock()
+	defer a.resultWaitersLock.RUnlock()
+
+	return len(a.resultWaiters)
+}
@@ -0,0 +1,332 @@
+package gosocketio
+
+import (
+	"sync"
+)
+
+/**
+Rooms and broadcast bookkeeping of the server
+
+MemoryAdapter is used by default, custom adapters can share broadcasts
+between several server instances, e.g. behind a load balancer
+*/
+type Adapter interface {
+	/**
+	Called once by NewServer, before any connection is accepted
+	*/
+	Init(s *Server)
+
+	/**
+	Join channel to given room, returns false if it is already joined
+	*/
+	AddToRoom(c *Channel, room string) bool
+
+	/**
+	Remove channel from given room, returns false if it was not joined
+	*/
+	RemoveFromRoom(c *Channel, room string) bool
+
+	/**
+	Remove channel from all rooms, used on disconnection, returns left rooms
+	*/
+	RemoveFromAllRooms(c *Channel) []string
+
+	/**
+	Remove all channels from given room at once, returns removed channels
+	*/
+	RemoveRoom(room string) []*Channel
+
+	/**
+	Get list of channels, joined to given room
+	*/
+	Sockets(room string) []*Channel
+
+	/**
+	Get list of rooms with at least one channel joined
+	*/
+	Rooms() []string
+
+	/**
+	Emit message to all room channels, or to all server channels if room is empty
+	*/
+	Broadcast(room, method string, args interface{}) error
+}
+
+/**
+Optional extension of Adapter sharing room membership between server
+instances, so Amount and ListSids of server count channels of all instances
+*/
+type ClusterAdapter interface {
+	/**
+	Get sids of channels joined to given room on all instances
+	*/
+	RoomSids(room string) ([]string, error)
+}
+
+/**
+Optional extension of Adapter routing events to channels of other
+server instances, used by Server.EmitTo for sids not connected locally
+*/
+type DirectAdapter interface {
+	/**
+	Emit event to channel with given sid, connected to other instance.
+	Several positional arguments are passed as args items
+	*/
+	EmitTo(sid, method string, args []interface{}) error
+}
+
+/**
+Default adapter, stores rooms in memory of current server instance.
+Rooms and channels are sharded, so operations on different rooms do not
+contend for locks. Channel shard is always locked before room one
+*/
+type MemoryAdapter struct {
+	server *Server
+
+	//channels of rooms, sharded by room name
+	channels [mapShards]struct {
+		rooms map[string]map[*Channel]struct{}
+		lock  sync.RWMutex
+	}
+	//rooms of channels, sharded by sid
+	rooms [mapShards]struct {
+		channels map[*Channel]map[string]struct{}
+		lock     sync.RWMutex
+	}
+}
+
+/**
+Create in-memory adapter, custom adapters can use it for local bookkeeping
+*/
+func NewMemoryAdapter() *MemoryAdapter {
+	a := &MemoryAdapter{}
+	for i := 0; i < mapShards; i++ {
+		a.channels[i].rooms = make(map[string]map[*Channel]struct{})
+		a.rooms[i].channels = make(map[*Channel]map[string]struct{})
+	}
+	return a
+}
+
+func (a *MemoryAdapter) Init(s *Server) {
+	a.server = s
+}
+
+func (a *MemoryAdapter) AddToRoom(c *Channel, room string) bool {
+	byChannel := &a.rooms[shardOf(c.Id())]
+	byChannel.lock.Lock()
+	defer byChannel.lock.Unlock()
+	byRoom := &a.channels[shardOf(room)]
+	byRoom.lock.Lock()
+	defer byRoom.lock.Unlock()
+
+	if _, ok := byRoom.rooms[room]; !ok {
+		byRoom.rooms[room] = make(map[*Channel]struct{})
+	}
+	if _, ok := byRoom.rooms[room][c]; ok {
+		return false
+	}
+	if _, ok := byChannel.channels[c]; !ok {
+		byChannel.channels[c] = make(map[string]struct{})
+	}
+
+	byRoom.rooms[room][c] = struct{}{}
+	byChannel.channels[c][room] = struct{}{}
+
+	return true
+}
+
+func (a *MemoryAdapter) RemoveFromRoom(c *Channel, room string) bool {
+	byChannel := &a.rooms[shardOf(c.Id())]
+	byChannel.lock.Lock()
+	defer byChannel.lock.Unlock()
+	byRoom := &a.channels[shardOf(room)]
+	byRoom.lock.Lock()
+	defer byRoom.lock.Unlock()
+
+	if _, ok := byRoom.rooms[room][c]; !ok {
+		return false
+	}
+
+	delete(byRoom.rooms[room], c)
+	if len(byRoom.rooms[room]) == 0 {
+		delete(byRoom.rooms, room)
+	}
+
+	if rooms, ok := byChannel.channels[c]; ok {
+		delete(rooms, room)
+		if len(rooms) == 0 {
+			delete(byChannel.channels, c)
+		}
+	}
+
+	return true
+}
+
+/**
+Get rooms joined by given channel
+*/
+func (a *MemoryAdapter) ChannelRooms(c *Channel) []string {
+	byChannel := &a.rooms[shardOf(c.Id())]
+	byChannel.lock.RLock()
+	defer byChannel.lock.RUnlock()
+
+	rooms := make([]string, 0, len(byChannel.channels[c]))
+	for room := range byChannel.channels[c] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+func (a *MemoryAdapter) RemoveFromAllRooms(c *Channel) []string {
+	byChannel := &a.rooms[shardOf(c.Id())]
+	byChannel.lock.Lock()
+	defer byChannel.lock.Unlock()
+
+	rooms, ok := byChannel.channels[c]
+	if !ok {
+		return nil
+	}
+
+	left := make([]string, 0, len(rooms))
+	for room := range rooms {
+		byRoom := &a.channels[shardOf(room)]
+		byRoom.lock.Lock()
+		if curRoom, ok := byRoom.rooms[room]; ok {
+			delete(curRoom, c)
+			if len(curRoom) == 0 {
+				delete(byRoom.rooms, room)
+			}
+		}
+		byRoom.lock.Unlock()
+		left = append(left, room)
+	}
+
+	delete(byChannel.channels, c)
+
+	return left
+}
+
+func (a *MemoryAdapter) RemoveRoom(room string) []*Channel {
+	//room is taken first, channel shards can not be locked after room one
+	byRoom := &a.channels[shardOf(room)]
+	byRoom.lock.Lock()
+	roomChannels, ok := byRoom.rooms[room]
+	delete(byRoom.rooms, room)
+	byRoom.lock.Unlock()
+
+	if !ok {
+		return []*Channel{}
+	}
+
+	removed := make([]*Channel, 0, len(roomChannels))
+	for c := range roomChannels {
+		byChannel := &a.rooms[shardOf(c.Id())]
+		byChannel.lock.Lock()
+		byRoom.lock.RLock()
+		//channel could join the room again meanwhile
+		_, rejoined := byRoom.rooms[room][c]
+		byRoom.lock.RUnlock()
+		if rooms, ok := byChannel.channels[c]; ok && !rejoined {
+			delete(rooms, room)
+			if len(rooms) == 0 {
+				delete(byChannel.channels, c)
+			}
+		}
+		byChannel.lock.Unlock()
+		removed = append(removed, c)
+	}
+
+	return removed
+}
+
+func (a *MemoryAdapter) Sockets(room string) []*Channel {
+	byRoom := &a.channels[shardOf(room)]
+	byRoom.lock.RLock()
+	defer byRoom.lock.RUnlock()
+
+	roomChannels, ok := byRoom.rooms[room]
+	if !ok {
+		return []*Channel{}
+	}
+
+	i := 0
+	roomChannelsCopy := make([]*Channel, len(roomChannels))
+	for channel := range roomChannels {
+		roomChannelsCopy[i] = channel
+		i++
+	}
+
+	return roomChannelsCopy
+}
+
+func (a *MemoryAdapter) Rooms() []string {
+	var rooms []string
+	for i := 0; i < mapShards; i++ {
+		byRoom := &a.channels[i]
+		byRoom.lock.RLock()
+		for room := range byRoom.rooms {
+			rooms = append(rooms, room)
+		}
+		byRoom.lock.RUnlock()
+	}
+
+	return rooms
+}
+
+func (a *MemoryAdapter) Broadcast(room, method string, args interface{}) error {
+	if room == "" {
+		a.broadcastToAll(method, args)
+		return nil
+	}
+
+	byRoom := &a.channels[shardOf(room)]
+	byRoom.lock.RLock()
+	defer byRoom.lock.RUnlock()
+
+	roomChannels, ok := byRoom.rooms[room]
+	if !ok {
+		return nil
+	}
+
+	recipients := 0
+	for cn := range roomChannels {
+		if cn.IsAlive() {
+			go a.server.emitBroadcast(cn, method, args)
+			recipients++
+		}
+	}
+	a.server.observeBroadcast(room, recipients)
+
+	return nil
+}
+
+func (a *MemoryAdapter) broadcastToAll(method string, args interface{}) {
+	recipients := 0
+	for _, cn := range a.server.sids.snapshot() {
+		if cn.IsAlive() {
+			go a.server.emitBroadcast(cn, method, args)
+			recipients++
+		}
+	}
+	a.server.observeBroadcast("", recipients)
+}
+
+/**
+Emit event to channel with given sid if it is connected to this server
+instance, adapters use it to deliver events routed by other instances
+*/
+func (a *MemoryAdapter) EmitToLocal(sid, method string, args ...interface{}) error {
+	c, err := a.server.GetChannel(sid)
+	if err != nil {
+		return err
+	}
+
+	return c.Emit(method, args...)
+}
+
+/**
+Generate unique id of server instance, adapters use it to skip own broadcasts
+*/
+func NewNodeId() string {
+	return generateNewId("node")
+}
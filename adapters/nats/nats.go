@@ -0,0 +1,156 @@
+package nats
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio"
+	natsgo "github.com/nats-io/nats.go"
+	"log"
+	"sync"
+)
+
+const (
+	DefaultSubject = "socket.io"
+)
+
+/**
+Broadcast, as it is sent through nats
+*/
+type message struct {
+	Node   string `json:"node"`
+	Room   string `json:"room"`
+	Method string `json:"method"`
+	//encoded by server parser, see Server.EncodeArgs
+	Args []byte `json:"args"`
+	//set for events routed to single channel, see EmitTo
+	Sid string `json:"sid,omitempty"`
+}
+
+/**
+NATS adapter, shares broadcasts between server instances subscribed
+to the same subject, rooms are stored in memory
+
+Core nats delivery is at-most-once, so broadcasts missed while instance
+is disconnected are lost. Args are encoded by server parser, so all
+instances should use the same parser
+*/
+type Adapter struct {
+	*gosocketio.MemoryAdapter
+
+	conn    *natsgo.Conn
+	subject string
+	node    string
+	server  *gosocketio.Server
+
+	sub     *natsgo.Subscription
+	subLock sync.Mutex
+}
+
+/**
+Create adapter using given nats connection, subject is DefaultSubject if empty
+*/
+func NewAdapter(conn *natsgo.Conn, subject string) *Adapter {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+
+	return &Adapter{
+		MemoryAdapter: gosocketio.NewMemoryAdapter(),
+		conn:          conn,
+		subject:       subject,
+		node:          gosocketio.NewNodeId(),
+	}
+}
+
+/**
+Start receiving broadcasts of other instances, called by server
+*/
+func (a *Adapter) Init(s *gosocketio.Server) {
+	a.MemoryAdapter.Init(s)
+	a.server = s
+
+	a.subLock.Lock()
+	defer a.subLock.Unlock()
+
+	sub, err := a.conn.Subscribe(a.subject, a.deliver)
+	if err != nil {
+		log.Println("socket.io nats adapter subscribe error: ", err)
+		return
+	}
+	a.sub = sub
+}
+
+/**
+Broadcast to local channels and publish broadcast to other instances
+*/
+func (a *Adapter) Broadcast(room, method string, args interface{}) error {
+	a.MemoryAdapter.Broadcast(room, method, args)
+	return a.publish(&message{Room: room, Method: method}, args)
+}
+
+/**
+Publish event to channel with given sid, it is delivered
+by instance the channel is connected to
+*/
+func (a *Adapter) EmitTo(sid, method string, args []interface{}) error {
+	return a.publish(&message{Sid: sid, Method: method}, gosocketio.Args(args))
+}
+
+func (a *Adapter) publish(msg *message, args interface{}) error {
+	encodedArgs, err := a.server.EncodeArgs(msg.Method, args)
+	if err != nil {
+		return err
+	}
+
+	msg.Node = a.node
+	msg.Args = []byte(encodedArgs)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return a.conn.Publish(a.subject, data)
+}
+
+/**
+Stop receiving broadcasts of other instances, connection is not closed
+*/
+func (a *Adapter) Close() error {
+	a.subLock.Lock()
+	defer a.subLock.Unlock()
+
+	if a.sub == nil {
+		return nil
+	}
+
+	err := a.sub.Unsubscribe()
+	a.sub = nil
+	return err
+}
+
+/**
+Deliver broadcast of other instance to local channels
+*/
+func (a *Adapter) deliver(m *natsgo.Msg) {
+	msg := &message{}
+	if err := json.Unmarshal(m.Data, msg); err != nil {
+		log.Println("socket.io nats adapter wrong message: ", err)
+		return
+	}
+
+	if msg.Node == a.node {
+		return
+	}
+	if msg.Sid != "" {
+		a.deliverTo(msg)
+		return
+	}
+
+	a.MemoryAdapter.Broadcast(msg.Room, msg.Method, gosocketio.EncodedArgs(msg.Args))
+}
+
+/**
+Deliver event routed by other instance to local channel, if it is connected here
+*/
+func (a *Adapter) deliverTo(msg *message) {
+	a.MemoryAdapter.EmitToLocal(msg.Sid, msg.Method, gosocketio.EncodedArgs(msg.Args))
+}
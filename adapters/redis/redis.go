@@ -0,0 +1,349 @@
+package redis
+
+import (
+	"encoding/json"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/graarh/golang-socketio"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultChannel = "socket.io"
+
+	reconnectDelay = time.Second
+
+	//room sets of instance expire if it does not refresh them in time
+	nodeTTL           = 30 * time.Second
+	heartbeatInterval = 10 * time.Second
+)
+
+/**
+Broadcast, as it is sent through redis
+*/
+type message struct {
+	Node   string `json:"node"`
+	Room   string `json:"room"`
+	Method string `json:"method"`
+	//encoded by server parser, see Server.EncodeArgs
+	Args []byte `json:"args"`
+	//set for events routed to single channel, see EmitTo
+	Sid string `json:"sid,omitempty"`
+}
+
+/**
+Redis pub/sub adapter, shares broadcasts between server instances
+connected to the same redis channel, rooms are stored in memory.
+Room members are also stored in redis sets, so server Amount and ListSids
+count channels of all instances. Every instance has own sets, they are
+refreshed by heartbeat and expire if instance crashes
+
+Args are encoded by server parser, so all instances should use the same parser
+*/
+type Adapter struct {
+	*gosocketio.MemoryAdapter
+
+	pool    *redigo.Pool
+	channel string
+	node    string
+	server  *gosocketio.Server
+
+	closed     bool
+	closedLock sync.Mutex
+	psc        redigo.PubSubConn
+	//stops heartbeat
+	done chan struct{}
+}
+
+/**
+Create adapter, pool is used for both publishing and subscription,
+channel is redis pub/sub channel name, DefaultChannel if empty
+*/
+func NewAdapter(pool *redigo.Pool, channel string) *Adapter {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	return &Adapter{
+		MemoryAdapter: gosocketio.NewMemoryAdapter(),
+		pool:          pool,
+		channel:       channel,
+		node:          gosocketio.NewNodeId(),
+		done:          make(chan struct{}),
+	}
+}
+
+/**
+Start receiving broadcasts of other instances, called by server
+*/
+func (a *Adapter) Init(s *gosocketio.Server) {
+	a.MemoryAdapter.Init(s)
+	a.server = s
+	a.refresh()
+	go a.subscribe()
+	go a.heartbeat()
+}
+
+/**
+Redis key of set with sids of room members connected to given instance
+*/
+func (a *Adapter) roomKey(room, node string) string {
+	return a.channel + ":room:" + room + ":" + node
+}
+
+/**
+Redis key of sorted set with instances by time of their last heartbeat
+*/
+func (a *Adapter) nodesKey() string {
+	return a.channel + ":nodes"
+}
+
+/**
+Refresh room sets of this instance until adapter is closed
+*/
+func (a *Adapter) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.refresh()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+/**
+Mark this instance alive, prolong its room sets and forget
+instances which missed their heartbeats
+*/
+func (a *Adapter) refresh() {
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().Unix()
+	ttl := int64(nodeTTL / time.Second)
+	conn.Send("ZADD", a.nodesKey(), now, a.node)
+	conn.Send("ZREMRANGEBYSCORE", a.nodesKey(), "-inf", now-ttl)
+	for _, room := range a.MemoryAdapter.Rooms() {
+		conn.Send("EXPIRE", a.roomKey(room, a.node), ttl)
+	}
+	if _, err := conn.Do(""); err != nil {
+		log.Println("socket.io redis adapter heartbeat error: ", err)
+	}
+}
+
+/**
+Run redis command changing room members, errors are logged,
+as local membership is already changed
+*/
+func (a *Adapter) updateMembers(command string, room string, sids ...string) {
+	if len(sids) == 0 {
+		return
+	}
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	key := a.roomKey(room, a.node)
+	conn.Send(command, redigo.Args{}.Add(key).AddFlat(sids)...)
+	conn.Send("EXPIRE", key, int64(nodeTTL/time.Second))
+	if _, err := conn.Do(""); err != nil {
+		log.Println("socket.io redis adapter members error: ", err)
+	}
+}
+
+func (a *Adapter) AddToRoom(c *gosocketio.Channel, room string) bool {
+	if !a.MemoryAdapter.AddToRoom(c, room) {
+		return false
+	}
+	a.updateMembers("SADD", room, c.Id())
+	return true
+}
+
+func (a *Adapter) RemoveFromRoom(c *gosocketio.Channel, room string) bool {
+	if !a.MemoryAdapter.RemoveFromRoom(c, room) {
+		return false
+	}
+	a.updateMembers("SREM", room, c.Id())
+	return true
+}
+
+func (a *Adapter) RemoveFromAllRooms(c *gosocketio.Channel) []string {
+	left := a.MemoryAdapter.RemoveFromAllRooms(c)
+	for _, room := range left {
+		a.updateMembers("SREM", room, c.Id())
+	}
+	return left
+}
+
+/**
+Remove local channels from given room, channels of other instances are kept
+*/
+func (a *Adapter) RemoveRoom(room string) []*gosocketio.Channel {
+	removed := a.MemoryAdapter.RemoveRoom(room)
+
+	sids := make([]string, 0, len(removed))
+	for _, c := range removed {
+		sids = append(sids, c.Id())
+	}
+	a.updateMembers("SREM", room, sids...)
+
+	return removed
+}
+
+/**
+Get sids of room members of all alive instances
+*/
+func (a *Adapter) RoomSids(room string) ([]string, error) {
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	since := time.Now().Add(-nodeTTL).Unix()
+	nodes, err := redigo.Strings(conn.Do("ZRANGEBYSCORE", a.nodesKey(), since, "+inf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return []string{}, nil
+	}
+
+	keys := redigo.Args{}
+	for _, node := range nodes {
+		keys = keys.Add(a.roomKey(room, node))
+	}
+	return redigo.Strings(conn.Do("SUNION", keys...))
+}
+
+/**
+Broadcast to local channels and publish broadcast to other instances
+*/
+func (a *Adapter) Broadcast(room, method string, args interface{}) error {
+	a.MemoryAdapter.Broadcast(room, method, args)
+	return a.publish(room, method, args)
+}
+
+/**
+Publish event to channel with given sid, it is delivered
+by instance the channel is connected to
+*/
+func (a *Adapter) EmitTo(sid, method string, args []interface{}) error {
+	return a.publishMessage(&message{Sid: sid, Method: method}, gosocketio.Args(args))
+}
+
+func (a *Adapter) publish(room, method string, args interface{}) error {
+	return a.publishMessage(&message{Room: room, Method: method}, args)
+}
+
+func (a *Adapter) publishMessage(msg *message, args interface{}) error {
+	encodedArgs, err := a.server.EncodeArgs(msg.Method, args)
+	if err != nil {
+		return err
+	}
+
+	msg.Node = a.node
+	msg.Args = []byte(encodedArgs)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	conn := a.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("PUBLISH", a.channel, data)
+	return err
+}
+
+/**
+Stop receiving broadcasts of other instances
+*/
+func (a *Adapter) Close() error {
+	a.closedLock.Lock()
+	defer a.closedLock.Unlock()
+
+	if !a.closed {
+		close(a.done)
+	}
+	a.closed = true
+	if a.psc.Conn != nil {
+		return a.psc.Close()
+	}
+	return nil
+}
+
+func (a *Adapter) isClosed() bool {
+	a.closedLock.Lock()
+	defer a.closedLock.Unlock()
+
+	return a.closed
+}
+
+/**
+Subscription loop, reconnects to redis on errors until closed
+*/
+func (a *Adapter) subscribe() {
+	for !a.isClosed() {
+		if err := a.receive(); err != nil && !a.isClosed() {
+			log.Println("socket.io redis adapter error: ", err)
+			time.Sleep(reconnectDelay)
+		}
+	}
+}
+
+func (a *Adapter) receive() error {
+	a.closedLock.Lock()
+	if a.closed {
+		a.closedLock.Unlock()
+		return nil
+	}
+	a.psc = redigo.PubSubConn{Conn: a.pool.Get()}
+	psc := a.psc
+	a.closedLock.Unlock()
+
+	defer psc.Close()
+
+	if err := psc.Subscribe(a.channel); err != nil {
+		return err
+	}
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redigo.Message:
+			a.deliver(v.Data)
+		case error:
+			return v
+		}
+	}
+}
+
+/**
+Deliver broadcast of other instance to local channels
+*/
+func (a *Adapter) deliver(data []byte) {
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		log.Println("socket.io redis adapter wrong message: ", err)
+		return
+	}
+
+	if msg.Node == a.node {
+		return
+	}
+	if msg.Sid != "" {
+		a.deliverTo(msg)
+		return
+	}
+
+	a.MemoryAdapter.Broadcast(msg.Room, msg.Method, gosocketio.EncodedArgs(msg.Args))
+}
+
+/**
+Deliver event routed by other instance to local channel, if it is connected here
+*/
+func (a *Adapter) deliverTo(msg *message) {
+	a.MemoryAdapter.EmitToLocal(msg.Sid, msg.Method, gosocketio.EncodedArgs(msg.Args))
+}
@@ -0,0 +1,179 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/graarh/golang-socketio"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrorRoomNotJoined = errors.New("Room is not joined")
+)
+
+/**
+Headers which are not exposed by admin api, as they contain credentials
+*/
+var RedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+/**
+Connected channel description
+*/
+type ChannelInfo struct {
+	Id     string                  `json:"id"`
+	Ip     string                  `json:"ip"`
+	Header http.Header             `json:"header"`
+	Rooms  []string                `json:"rooms"`
+	Stats  gosocketio.ChannelStats `json:"stats"`
+}
+
+/**
+Introspection and management of connected channels of one server instance
+*/
+type Admin struct {
+	server *gosocketio.Server
+}
+
+func New(s *gosocketio.Server) *Admin {
+	return &Admin{server: s}
+}
+
+/**
+Describe channel, credential headers are removed
+*/
+func describe(c *gosocketio.Channel) ChannelInfo {
+	header := http.Header{}
+	for name, values := range c.RequestHeader() {
+		header[name] = append([]string(nil), values...)
+	}
+	for _, name := range RedactedHeaders {
+		header.Del(name)
+	}
+
+	rooms := c.Rooms()
+	sort.Strings(rooms)
+
+	return ChannelInfo{
+		Id:     c.Id(),
+		Ip:     c.Ip(),
+		Header: header,
+		Rooms:  rooms,
+		Stats:  c.Stats(),
+	}
+}
+
+/**
+List connected channels, sorted by id
+*/
+func (a *Admin) List() []ChannelInfo {
+	channels := a.server.Channels()
+	list := make([]ChannelInfo, 0, len(channels))
+	for _, c := range channels {
+		list = append(list, describe(c))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+
+	return list
+}
+
+/**
+Describe channel with given sid
+*/
+func (a *Admin) Inspect(sid string) (ChannelInfo, error) {
+	c, err := a.server.GetChannel(sid)
+	if err != nil {
+		return ChannelInfo{}, err
+	}
+
+	return describe(c), nil
+}
+
+/**
+Remove channel with given sid from room
+*/
+func (a *Admin) Leave(sid, room string) error {
+	c, err := a.server.GetChannel(sid)
+	if err != nil {
+		return err
+	}
+
+	for _, joined := range c.Rooms() {
+		if joined == room {
+			return c.Leave(room)
+		}
+	}
+	return ErrorRoomNotJoined
+}
+
+/**
+Disconnect channel with given sid, client receives kick event with the reason
+*/
+func (a *Admin) Kick(sid, reason string) error {
+	c, err := a.server.GetChannel(sid)
+	if err != nil {
+		return err
+	}
+
+	return c.Kick(reason)
+}
+
+/**
+Get http handler of admin api, it should be mounted with http.StripPrefix
+and protected by authentication:
+
+	GET  /channels                    list of channels
+	GET  /channels/{sid}              channel description
+	POST /channels/{sid}/leave?room=  remove channel from room
+	POST /channels/{sid}/kick?reason= disconnect channel
+*/
+func (a *Admin) Handler() http.Handler {
+	return http.HandlerFunc(a.serveHTTP)
+}
+
+func (a *Admin) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "channels" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		writeJson(w, a.List())
+	case len(parts) == 2 && r.Method == "GET":
+		info, err := a.Inspect(parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJson(w, info)
+	case len(parts) == 3 && r.Method == "POST" && parts[2] == "leave":
+		writeResult(w, a.Leave(parts[1], r.URL.Query().Get("room")))
+	case len(parts) == 3 && r.Method == "POST" && parts[2] == "kick":
+		writeResult(w, a.Kick(parts[1], r.URL.Query().Get("reason")))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case gosocketio.ErrorConnectionNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrorRoomNotJoined:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
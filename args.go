@@ -0,0 +1,76 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+var (
+	ErrorMultipleArgsNotSupported = errors.New("Several arguments are not supported by parser")
+)
+
+/**
+Several positional event arguments, sent as separate arguments of one event,
+e.g. socket.on("event", (a, b) => ...) on js side. Emit builds it from its
+variadic arguments, it can be passed to broadcasts and acks as args value
+*/
+type Args []interface{}
+
+/**
+Event arguments already encoded by parser of server, e.g. broadcast
+received by adapter from other server instance. They are sent as is,
+see Server.EncodeArgs
+*/
+type EncodedArgs string
+
+/**
+Pack variadic arguments to one args value: nil, the only argument or Args
+*/
+func packArgs(args []interface{}) interface{} {
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0]
+	}
+
+	return Args(args)
+}
+
+/**
+Encode args value, Args are encoded as several positional arguments
+*/
+func marshalArgs(parser protocol.Parser, args interface{}) (string, error) {
+	if encoded, ok := args.(EncodedArgs); ok {
+		return string(encoded), nil
+	}
+
+	multiple, ok := args.(Args)
+	if !ok {
+		return parser.Marshal(args)
+	}
+
+	multiParser, ok := parser.(protocol.MultiArgsParser)
+	if !ok {
+		if len(multiple) == 1 {
+			return parser.Marshal(multiple[0])
+		}
+		return "", ErrorMultipleArgsNotSupported
+	}
+
+	return multiParser.MarshalArgs(multiple)
+}
+
+/**
+Decode positional arguments to given pointers
+*/
+func unmarshalArgs(parser protocol.Parser, data string, v []interface{}) error {
+	if multiParser, ok := parser.(protocol.MultiArgsParser); ok {
+		return multiParser.UnmarshalArgs(data, v)
+	}
+
+	if len(v) > 1 {
+		return ErrorMultipleArgsNotSupported
+	}
+	return parser.Unmarshal(data, v[0])
+}
@@ -0,0 +1,214 @@
+package gosocketio
+
+import (
+	"path"
+)
+
+/**
+Broadcast targeting builder, e.g.
+server.To("room1").To("room2").Except(sid).Emit("event", data)
+*/
+type BroadcastOperator struct {
+	server *Server
+	rooms  []string
+	except map[string]struct{}
+}
+
+/**
+Start broadcast to given room
+*/
+func (s *Server) To(room string) *BroadcastOperator {
+	return &BroadcastOperator{
+		server: s,
+		rooms:  []string{room},
+		except: make(map[string]struct{}),
+	}
+}
+
+/**
+Add one more room, channels joined to several rooms receive message once
+*/
+func (b *BroadcastOperator) To(room string) *BroadcastOperator {
+	b.rooms = append(b.rooms, room)
+	return b
+}
+
+/**
+Exclude channels with given sids from broadcast
+*/
+func (b *BroadcastOperator) Except(sids ...string) *BroadcastOperator {
+	for _, sid := range sids {
+		b.except[sid] = struct{}{}
+	}
+	return b
+}
+
+/**
+Emit message to all targeted channels.
+Broadcast to single room without exclusions is passed to adapter as is,
+other broadcasts are delivered to channels of this server instance only
+*/
+func (b *BroadcastOperator) Emit(method string, args interface{}) {
+	if len(b.rooms) == 1 && len(b.except) == 0 {
+		b.server.broadcast(b.rooms[0], method, args)
+		return
+	}
+
+	if b.server.recovery != nil {
+		b.server.recovery.record(b.rooms, method, args)
+	}
+	b.server.trackRoomBroadcast(b.rooms, method, args)
+
+	for _, cn := range b.channels() {
+		if cn.IsAlive() {
+			go b.server.emitBroadcast(cn, method, args)
+		}
+	}
+}
+
+/**
+Collect unique channels of all rooms, except excluded ones
+*/
+func (b *BroadcastOperator) channels() []*Channel {
+	seen := make(map[*Channel]struct{})
+	var channels []*Channel
+
+	for _, room := range b.rooms {
+		for _, cn := range b.server.List(room) {
+			if _, ok := seen[cn]; ok {
+				continue
+			}
+			seen[cn] = struct{}{}
+
+			if _, ok := b.except[cn.Id()]; ok {
+				continue
+			}
+			channels = append(channels, cn)
+		}
+	}
+
+	return channels
+}
+
+/**
+Broadcast message to channels of all given rooms, each channel receives it once
+*/
+func (s *Server) BroadcastToRooms(rooms []string, method string, args interface{}) {
+	if len(rooms) == 0 {
+		return
+	}
+
+	b := s.To(rooms[0])
+	for _, room := range rooms[1:] {
+		b.To(room)
+	}
+	b.Emit(method, args)
+}
+
+/**
+Get rooms of this server instance matching given glob pattern, e.g.
+"game:1234:*", see path.Match for pattern syntax
+*/
+func (s *Server) RoomsMatching(pattern string) ([]string, error) {
+	//bad pattern is reported even if there are no rooms
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for _, room := range s.adapter.Rooms() {
+		if ok, _ := path.Match(pattern, room); ok {
+			matched = append(matched, room)
+		}
+	}
+
+	return matched, nil
+}
+
+/**
+Broadcast message to channels of all rooms matching given glob pattern,
+e.g. "game:1234:*", each channel receives it once. Delivered to channels
+of this server instance only, see BroadcastToRooms
+*/
+func (s *Server) BroadcastToPattern(pattern, method string, args interface{}) error {
+	rooms, err := s.RoomsMatching(pattern)
+	if err != nil {
+		return err
+	}
+
+	s.BroadcastToRooms(rooms, method, args)
+	return nil
+}
+
+/**
+Broadcast message to all channels of this server instance matching predicate,
+predicate is called without server locks held
+*/
+func (s *Server) BroadcastIf(predicate func(c *Channel) bool, method string, args interface{}) {
+	for _, cn := range s.channelsSnapshot() {
+		if cn.IsAlive() && predicate(cn) {
+			go s.emitBroadcast(cn, method, args)
+		}
+	}
+}
+
+/**
+Get all connected channels of this server instance, list is a copy
+*/
+func (s *Server) Channels() []*Channel {
+	return s.channelsSnapshot()
+}
+
+/**
+Call f for every connected channel until it returns false. Channels are
+taken as a snapshot, so f can close channels and call server methods
+*/
+func (s *Server) ForEach(f func(c *Channel) bool) {
+	for _, c := range s.channelsSnapshot() {
+		if !f(c) {
+			return
+		}
+	}
+}
+
+/**
+Find connected channels matching given predicate, e.g. by session value
+*/
+func (s *Server) Find(f func(c *Channel) bool) []*Channel {
+	var found []*Channel
+	s.ForEach(func(c *Channel) bool {
+		if f(c) {
+			found = append(found, c)
+		}
+		return true
+	})
+
+	return found
+}
+
+/**
+Find first connected channel matching given predicate,
+returns ErrorConnectionNotFound if there is no such channel
+*/
+func (s *Server) FindOne(f func(c *Channel) bool) (*Channel, error) {
+	var found *Channel
+	s.ForEach(func(c *Channel) bool {
+		if f(c) {
+			found = c
+			return false
+		}
+		return true
+	})
+
+	if found == nil {
+		return nil, ErrorConnectionNotFound
+	}
+	return found, nil
+}
+
+/**
+Get copy of all connected channels list
+*/
+func (s *Server) channelsSnapshot() []*Channel {
+	return s.sids.snapshot()
+}
@@ -0,0 +1,104 @@
+package gosocketio
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrorBroadcastSkipped = errors.New("Broadcast skipped")
+)
+
+const (
+	//how often queue load is checked while broadcast is delayed
+	broadcastDelayStep = 10 * time.Millisecond
+)
+
+/**
+What to do with broadcast to channel which outgoing queue is near overflow
+*/
+type BroadcastAction int
+
+const (
+	/**
+	Send broadcast as usual, default action
+	*/
+	BroadcastSend BroadcastAction = iota
+	/**
+	Skip broadcast for this channel
+	*/
+	BroadcastSkip
+	/**
+	Wait until queue load is below threshold up to policy delay,
+	broadcast is skipped if it is not
+	*/
+	BroadcastDelay
+	/**
+	Send policy downgrade event instead, e.g. "state dirty" marker,
+	so client can request full state later
+	*/
+	BroadcastDowngrade
+)
+
+/**
+Broadcast policy for recipients which outgoing queue is loaded, see WithBroadcastPolicy
+*/
+type BroadcastPolicy struct {
+	//queue occupancy, from 0 to 1, at which action is taken
+	Threshold float64
+	Action    BroadcastAction
+
+	//max wait of BroadcastDelay action
+	Delay time.Duration
+
+	//event sent by BroadcastDowngrade action
+	DowngradeMethod string
+	DowngradeArgs   interface{}
+}
+
+/**
+Get occupancy of channel outgoing queue, from 0 to 1
+*/
+func (c *Channel) queueLoad() float64 {
+	if cap(c.out) == 0 {
+		return 0
+	}
+	return float64(len(c.out)) / float64(cap(c.out))
+}
+
+/**
+Emit broadcast message to one recipient according to broadcast policy,
+should be called in separate goroutine
+*/
+func (s *Server) emitBroadcast(c *Channel, method string, args interface{}) {
+	defer trackGoroutine(&s.goroutines.broadcasts)()
+
+	policy := s.broadcastPolicy
+	if policy == nil || policy.Action == BroadcastSend || c.queueLoad() < policy.Threshold {
+		c.Emit(method, args)
+		return
+	}
+
+	switch policy.Action {
+	case BroadcastSkip:
+		s.logger.Debug("broadcast skipped", "sid", c.Id(), "method", method)
+		c.skipSequence()
+		c.observeDropped(ErrorBroadcastSkipped)
+	case BroadcastDelay:
+		for waited := time.Duration(0); waited < policy.Delay; waited += broadcastDelayStep {
+			time.Sleep(broadcastDelayStep)
+			if !c.IsAlive() {
+				return
+			}
+			if c.queueLoad() < policy.Threshold {
+				c.Emit(method, args)
+				return
+			}
+		}
+		s.logger.Debug("delayed broadcast skipped", "sid", c.Id(), "method", method)
+		c.skipSequence()
+		c.observeDropped(ErrorBroadcastSkipped)
+	case BroadcastDowngrade:
+		c.Emit(policy.DowngradeMethod, policy.DowngradeArgs)
+	}
+}
@@ -1,6 +1,8 @@
 package gosocketio
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"reflect"
 )
@@ -9,18 +11,44 @@ type caller struct {
 	Func        reflect.Value
 	Args        reflect.Type
 	ArgsPresent bool
-	Out         bool
+	//types of positional arguments following the first one
+	ExtraArgs []reflect.Type
+	Out       bool
+	ErrOut    bool
+	Once      bool
+	Ctx       bool
+	//the only payload parameter is json.RawMessage
+	Raw bool
 }
 
+//Deprecated: handlers can return several values, error is not returned anymore
+var ErrorCallerMaxOneValue = errors.New("f should return not more than one value")
+
 var (
-	ErrorCallerNotFunc     = errors.New("f is not function")
-	ErrorCallerNot2Args    = errors.New("f should have 1 or 2 args")
-	ErrorCallerMaxOneValue = errors.New("f should return not more than one value")
+	ErrorCallerNotFunc    = errors.New("f is not function")
+	ErrorCallerNot2Args   = errors.New("f should have at least 1 arg, not counting context")
+	ErrorCallerNotChannel = errors.New("f should accept *Channel or Socket as first arg")
+
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	channelType = reflect.TypeOf((*Channel)(nil))
+	rawType     = reflect.TypeOf(json.RawMessage(nil))
 )
 
 /**
 Parses function passed by using reflection, and stores its representation
 for further call on message or ack
+
+Supported signatures are func(*Channel), func(*Channel, T), func(*Channel, T) R
+for acks and func(*Channel, T) error, returned error is passed to ErrorHandler.
+Ack functions can return several values, func(*Channel, T) (A, B), last error
+value is not sent but passed to ErrorHandler, ack is not sent in that case.
+Several positional event arguments are passed as func(*Channel, A, B, C).
+Each of them can have context.Context first argument, cancelled on disconnect,
+and can accept Socket interface instead of *Channel.
+The only payload parameter of json.RawMessage type receives encoded arguments
+as is, e.g. `{"a":1},2` for json parser, they are not decoded, []byte keeps
+usual base64 decoding
 */
 func newCaller(f interface{}) (*caller, error) {
 	fVal := reflect.ValueOf(f)
@@ -29,20 +57,36 @@ func newCaller(f interface{}) (*caller, error) {
 	}
 
 	fType := fVal.Type()
-	if fType.NumOut() > 1 {
-		return nil, ErrorCallerMaxOneValue
+	curCaller := &caller{
+		Func:   fVal,
+		Out:    fType.NumOut() > 0,
+		ErrOut: fType.NumOut() > 0 && fType.Out(fType.NumOut()-1) == errorType,
+	}
+	if curCaller.ErrOut && fType.NumOut() == 1 {
+		curCaller.Out = false
 	}
 
-	curCaller := &caller{
-		Func: fVal,
-		Out:  fType.NumOut() == 1,
+	numIn := fType.NumIn()
+	if numIn > 0 && fType.In(0) == contextType {
+		curCaller.Ctx = true
+		numIn--
 	}
-	if fType.NumIn() == 1 {
+
+	if numIn > 0 && !channelType.AssignableTo(fType.In(fType.NumIn()-numIn)) {
+		return nil, ErrorCallerNotChannel
+	}
+
+	if numIn == 1 {
 		curCaller.Args = nil
 		curCaller.ArgsPresent = false
-	} else if fType.NumIn() == 2 {
-		curCaller.Args = fType.In(1)
+	} else if numIn >= 2 {
+		first := fType.NumIn() - numIn + 1
+		curCaller.Args = fType.In(first)
 		curCaller.ArgsPresent = true
+		for i := first + 1; i < fType.NumIn(); i++ {
+			curCaller.ExtraArgs = append(curCaller.ExtraArgs, fType.In(i))
+		}
+		curCaller.Raw = len(curCaller.ExtraArgs) == 0 && curCaller.Args == rawType
 	} else {
 		return nil, ErrorCallerNot2Args
 	}
@@ -51,25 +95,110 @@ func newCaller(f interface{}) (*caller, error) {
 }
 
 /**
-returns function parameter as it is present in it using reflection
+returns pointers to function parameters as they are present in it using reflection
 */
-func (c *caller) getArgs() interface{} {
-	return reflect.New(c.Args).Interface()
+func (c *caller) getArgs() []interface{} {
+	if !c.ArgsPresent {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(c.ExtraArgs)+1)
+	args = append(args, reflect.New(c.Args).Interface())
+	for _, t := range c.ExtraArgs {
+		args = append(args, reflect.New(t).Interface())
+	}
+	return args
 }
 
 /**
-calls function with given arguments from its representation using reflection
+decodes function parameters with given decoder, nothing is decoded
+if function has no parameters
 */
-func (c *caller) callFunc(h *Channel, args interface{}) []reflect.Value {
-	//nil is untyped, so use the default empty value of correct type
+func (c *caller) decodeArgs(decode func(v []interface{}) error) ([]interface{}, error) {
+	if !c.ArgsPresent {
+		return nil, nil
+	}
+
+	//data types should be defined for unmarshall
+	data := c.getArgs()
+	if err := decode(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+/**
+same as decodeArgs, but function with raw payload parameter gets
+encoded arguments returned by raw, without decoding
+*/
+func (c *caller) decodeEventArgs(raw func() (string, error),
+	decode func(v []interface{}) error) ([]interface{}, error) {
+
+	if !c.Raw {
+		return c.decodeArgs(decode)
+	}
+
+	args, err := raw()
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.New(c.Args)
+	value.Elem().SetBytes([]byte(args))
+	return []interface{}{value.Interface()}, nil
+}
+
+/**
+calls function with given arguments from its representation using reflection,
+arguments are pointers to parameters, nil means default empty values
+*/
+func (c *caller) callFunc(h *Channel, args []interface{}) []reflect.Value {
+	return c.callFuncContext(h.Context(), h, args)
+}
+
+/**
+same as callFunc, but given context is passed to function with context argument
+*/
+func (c *caller) callFuncContext(ctx context.Context, h *Channel, args []interface{}) []reflect.Value {
+	//nil is untyped, so use the default empty values of correct types
 	if args == nil {
 		args = c.getArgs()
 	}
 
-	a := []reflect.Value{reflect.ValueOf(h), reflect.ValueOf(args).Elem()}
-	if !c.ArgsPresent {
-		a = a[0:1]
+	a := make([]reflect.Value, 0, len(args)+2)
+	if c.Ctx {
+		a = append(a, reflect.ValueOf(ctx))
+	}
+	a = append(a, reflect.ValueOf(h))
+	for _, arg := range args {
+		a = append(a, reflect.ValueOf(arg).Elem())
 	}
 
 	return c.Func.Call(a)
 }
+
+/**
+returns error, returned by function, if function returns error
+*/
+func (c *caller) getError(result []reflect.Value) error {
+	if !c.ErrOut || result[len(result)-1].IsNil() {
+		return nil
+	}
+
+	return result[len(result)-1].Interface().(error)
+}
+
+/**
+returns values to be sent in ack response: nil, the only value or Args
+*/
+func (c *caller) getResult(result []reflect.Value) interface{} {
+	if c.ErrOut {
+		result = result[:len(result)-1]
+	}
+
+	values := make([]interface{}, 0, len(result))
+	for _, value := range result {
+		values = append(values, value.Interface())
+	}
+	return packArgs(values)
+}
@@ -0,0 +1,50 @@
+package gosocketio
+
+import (
+	"strconv"
+)
+
+/**
+Error of channel passed to error handler, e.g. rate limit, oversized or
+malformed packet. Cause is kept in Err, so handlers can branch with
+errors.Is(err, ErrorRateLimited) or errors.As(err, &decodeErr).
+Event is empty for errors not related to an incoming event
+*/
+type ChannelError struct {
+	Sid   string
+	Event string
+	Err   error
+}
+
+func (e *ChannelError) Error() string {
+	if e.Event == "" {
+		return "sid " + e.Sid + ": " + e.Err.Error()
+	}
+	return "sid " + e.Sid + ", event " + strconv.Quote(e.Event) + ": " + e.Err.Error()
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+/**
+Error of incoming packet or event arguments decoding
+*/
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "Decode failed: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+/**
+Wrap error of channel, passed to error handler, with sid and event name
+*/
+func channelError(c *Channel, event string, err error) error {
+	return &ChannelError{Sid: c.Id(), Event: event, Err: err}
+}
@@ -0,0 +1,162 @@
+package gosocketio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//first byte of continuation frame, can not start engine.io packet
+	chunkFrameMarker = '\x01'
+
+	//query parameter of clients able to reassemble continuation frames
+	chunkQueryParam = "chunks"
+
+	chunkMore = '+'
+	chunkLast = '$'
+)
+
+var (
+	ErrorWrongChunk = errors.New("Wrong continuation frame")
+)
+
+/**
+Check that encoded packet should be split to continuation frames,
+packets of binary parsers are sent as is
+*/
+func (c *Channel) shouldChunk(command string) bool {
+	return c.chunkSize > 0 && len(command) > c.chunkSize && !c.parser.IsBinary(command)
+}
+
+/**
+Split packet to continuation frames and queue them, frames of one packet
+are queued in a row, so other packets and pings are written between them.
+Frame is marker, packet id, frame index, more or last flag and data
+*/
+func (c *Channel) enqueueChunks(ctx context.Context, command string) error {
+	c.chunkLock.Lock()
+	defer c.chunkLock.Unlock()
+
+	c.chunkId++
+	prefix := string(chunkFrameMarker) + strconv.Itoa(c.chunkId) + ":"
+
+	for index := 0; len(command) > 0; index++ {
+		size := len(command)
+		if size > c.chunkSize {
+			//text frames are split between runes
+			size = c.chunkSize
+			for size > 0 && !utf8.RuneStart(command[size]) {
+				size--
+			}
+			if size == 0 {
+				size = c.chunkSize
+			}
+		}
+
+		flag := string(chunkMore)
+		if size == len(command) {
+			flag = string(chunkLast)
+		}
+		frame := prefix + strconv.Itoa(index) + flag + command[:size]
+		if err := c.enqueueContext(ctx, markCompression(ctx, frame)); err != nil {
+			return err
+		}
+		command = command[size:]
+	}
+
+	return nil
+}
+
+/**
+Check that received packet is continuation frame
+*/
+func isChunkFrame(data []byte) bool {
+	return len(data) > 0 && data[0] == chunkFrameMarker
+}
+
+/**
+Add continuation frame to packet being reassembled, called by read loop only.
+Returns whole packet when its last frame is received, nil otherwise.
+Incomplete packet is dropped when frame of other one is received,
+e.g. if some frames were dropped by overflow policy of remote side.
+Frames are rejected if chunking was not negotiated with remote side
+*/
+func (c *Channel) reassemble(data []byte) ([]byte, error) {
+	if c.chunkSize <= 0 {
+		return nil, ErrorWrongChunk
+	}
+
+	head := data[1:]
+	sep := bytes.IndexByte(head, ':')
+	end := bytes.IndexAny(head, string(chunkMore)+string(chunkLast))
+	if sep <= 0 || end <= sep+1 {
+		c.resetChunks()
+		return nil, ErrorWrongChunk
+	}
+
+	id := string(head[:sep])
+	index, err := strconv.Atoi(string(head[sep+1 : end]))
+	if err != nil {
+		c.resetChunks()
+		return nil, ErrorWrongChunk
+	}
+	if id != c.chunkedId {
+		c.resetChunks()
+		c.chunkedId = id
+	}
+	if index != c.chunkedNext {
+		c.resetChunks()
+		return nil, ErrorWrongChunk
+	}
+
+	payload := head[end+1:]
+	if len(c.chunked)+len(payload) > c.maxChunkedSize() {
+		c.resetChunks()
+		return nil, ErrorMessageTooLarge
+	}
+	c.chunked = append(c.chunked, payload...)
+	c.chunkedNext++
+
+	if head[end] == chunkMore {
+		return nil, nil
+	}
+
+	packet := c.chunked
+	c.chunked = nil
+	c.resetChunks()
+	return packet, nil
+}
+
+/**
+Get max size of reassembled packet: max message size if it is set,
+max payload of engine.io v4 otherwise
+*/
+func (c *Channel) maxChunkedSize() int {
+	if c.maxMessageSize > 0 {
+		return c.maxMessageSize
+	}
+	return defaultMaxPayload
+}
+
+/**
+Drop packet being reassembled
+*/
+func (c *Channel) resetChunks() {
+	c.chunkedId = ""
+	c.chunkedNext = 0
+	c.chunked = c.chunked[:0]
+}
+
+/**
+Add chunks query parameter to url, so server sends continuation frames
+*/
+func withChunksParam(url string) string {
+	if strings.Contains(url, "?") {
+		return url + "&" + chunkQueryParam + "=1"
+	}
+	return url + "?" + chunkQueryParam + "=1"
+}
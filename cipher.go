@@ -0,0 +1,137 @@
+package gosocketio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"io"
+)
+
+var (
+	ErrorPayloadEncrypted = errors.New("Payload is not decrypted")
+)
+
+/**
+Symmetric cipher of event payloads, see Channel.SetPayloadCipher
+*/
+type PayloadCipher interface {
+	Encrypt(plain []byte) ([]byte, error)
+	Decrypt(data []byte) ([]byte, error)
+}
+
+/**
+AES-GCM payload cipher, nonce is prepended to encrypted payload
+*/
+type aesGcmCipher struct {
+	aead cipher.AEAD
+}
+
+/**
+Create AES-GCM payload cipher, key should be 16, 24 or 32 bytes long
+*/
+func NewAESGCMCipher(key []byte) (PayloadCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return aesGcmCipher{aead: aead}, nil
+}
+
+func (a aesGcmCipher) Encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(plain)+a.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return a.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (a aesGcmCipher) Decrypt(data []byte) ([]byte, error) {
+	size := a.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrorPayloadEncrypted
+	}
+
+	return a.aead.Open(nil, data[:size], data[size:], nil)
+}
+
+/**
+Encrypt arguments of events, ack requests and ack responses sent by channel
+and decrypt received ones with given cipher, e.g. with key derived at connect
+time. Encrypted arguments are sent as one base64 string argument, so proxies
+and packet logs see them encrypted. Nil cipher disables encryption
+*/
+func (c *Channel) SetPayloadCipher(pc PayloadCipher) {
+	c.cipherLock.Lock()
+	defer c.cipherLock.Unlock()
+
+	c.cipher = pc
+}
+
+func (c *Channel) payloadCipher() PayloadCipher {
+	c.cipherLock.RLock()
+	defer c.cipherLock.RUnlock()
+
+	return c.cipher
+}
+
+/**
+Check that arguments of message are encrypted
+*/
+func isPayloadMessage(msg *protocol.Message) bool {
+	return msg.Type == protocol.MessageTypeEmit ||
+		msg.Type == protocol.MessageTypeAckRequest ||
+		msg.Type == protocol.MessageTypeAckResponse
+}
+
+/**
+Replace encoded arguments of outgoing message with encrypted ones
+*/
+func (c *Channel) encryptArgs(msg *protocol.Message) error {
+	pc := c.payloadCipher()
+	if pc == nil || msg.Args == "" || !isPayloadMessage(msg) {
+		return nil
+	}
+
+	data, err := pc.Encrypt([]byte(msg.Args))
+	if err != nil {
+		return err
+	}
+
+	msg.Args, err = c.parser.Marshal(base64.StdEncoding.EncodeToString(data))
+	return err
+}
+
+/**
+Replace encrypted arguments of incoming message with decrypted ones
+*/
+func (c *Channel) decryptArgs(msg *protocol.Message) error {
+	pc := c.payloadCipher()
+	if pc == nil || msg.Args == "" || !isPayloadMessage(msg) {
+		return nil
+	}
+
+	var encoded string
+	if err := c.parser.Unmarshal(msg.Args, &encoded); err != nil {
+		return ErrorPayloadEncrypted
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrorPayloadEncrypted
+	}
+	plain, err := pc.Decrypt(data)
+	if err != nil {
+		return err
+	}
+
+	msg.Args = string(plain)
+	return nil
+}
@@ -1,14 +1,20 @@
 package gosocketio
 
 import (
+	"github.com/graarh/golang-socketio/protocol"
 	"github.com/graarh/golang-socketio/transport"
+	"net/url"
 	"strconv"
+	"sync"
+	"time"
 )
 
 const (
 	webSocketProtocol = "ws://"
 	webSocketSecureProtocol = "wss://"
 	socketioUrl       = "/socket.io/?EIO=3&transport=websocket"
+
+	DisconnectTimeout = time.Second
 )
 
 /**
@@ -17,6 +23,29 @@ Socket.io client representation
 type Client struct {
 	methods
 	Channel
+
+	queueSize int
+
+	//server sends pings, client answers them and does not ping itself
+	serverPings bool
+
+	//auth payload of connect packet
+	authData interface{}
+
+	url             string
+	transport       transport.Transport
+	fallbacks       []transport.Transport
+	stickySession   bool
+	reconnectPolicy *ReconnectPolicy
+	loops           sync.WaitGroup
+	closed          chan struct{}
+	closeOnce       sync.Once
+
+	//received from server, used by next reconnection
+	hint     *ReconnectHint
+	hintLock sync.Mutex
+
+	status statusTracker
 }
 
 /**
@@ -32,6 +61,19 @@ func GetUrl(host string, port int, secure bool) string {
 	return prefix + host + ":" + strconv.Itoa(port) + socketioUrl
 }
 
+/**
+Get ws/wss url by host and port with additional query parameters,
+e.g. auth token or client version
+*/
+func GetUrlWithQuery(host string, port int, secure bool, query url.Values) string {
+	result := GetUrl(host, port, secure)
+	if len(query) == 0 {
+		return result
+	}
+
+	return result + "&" + query.Encode()
+}
+
 /**
 connect to host and initialise socket.io protocol
 
@@ -40,27 +82,84 @@ ws://myserver.com/socket.io/?EIO=3&transport=websocket
 
 You can use GetUrlByHost for generating correct url
 */
-func Dial(url string, tr transport.Transport) (*Client, error) {
-	c := &Client{}
-	c.initChannel()
+func Dial(url string, tr transport.Transport, opts ...DialOption) (*Client, error) {
+	c := &Client{
+		queueSize: DefaultQueueSize,
+		url:       url,
+		transport: tr,
+		closed:    make(chan struct{}),
+	}
 	c.initMethods()
+	c.status.init()
+	c.trackStatus()
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.Channel.logger = c.methods.logger
+	c.Channel.serializers = c.methods.serializers
+	if c.Channel.chunkSize > 0 {
+		c.url = withChunksParam(c.url)
+		url = c.url
+	}
+	c.initChannel(c.queueSize)
+	if c.reconnectPolicy == nil {
+		//nothing to wait for, events would be queued forever
+		c.offline = nil
+	} else {
+		c.Channel.reconnectable = true
+		c.Intercept(c.interceptReconnectHint)
+	}
+
+	if c.stickySession {
+		c.setStickyJar()
+	}
 
 	var err error
-	c.conn, err = tr.Connect(url)
+	c.conn, err = c.connect()
 	if err != nil {
 		return nil, err
 	}
 
-	go inLoop(&c.Channel, &c.methods)
-	go outLoop(&c.Channel, &c.methods)
-	go pinger(&c.Channel)
+	if c.authData != nil {
+		if err := c.sendConnectAuth(); err != nil {
+			c.conn.Close()
+			return nil, err
+		}
+	}
+
+	c.startLoops()
+	if c.reconnectPolicy != nil {
+		go c.supervise()
+	}
 
 	return c, nil
 }
 
 /**
-Close client connection
+Close client connection, it is not restored by reconnection.
+Disconnect packet is sent to server first, waiting up to DisconnectTimeout
 */
 func (c *Client) Close() {
+	c.CloseGraceful(DisconnectTimeout)
+}
+
+/**
+Write already queued messages and disconnect packet, waiting up to given
+timeout, and close connection
+*/
+func (c *Client) CloseGraceful(timeout time.Duration) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.offline != nil {
+			c.offline.disable()
+		}
+	})
+
+	disconnect := &protocol.Message{Type: protocol.MessageTypeDisconnect}
+	if send(disconnect, &c.Channel, nil) == nil {
+		c.Channel.flush(timeout)
+	}
 	closeChannel(&c.Channel, &c.methods)
+	c.status.set(StatusClosed)
 }
@@ -0,0 +1,95 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/transport"
+	"strings"
+)
+
+const (
+	//queue prefixes of packets with compression set, can not start a valid packet
+	compressOnMarker  = "\x00z"
+	compressOffMarker = "\x00u"
+)
+
+type compressionKey struct{}
+
+/**
+Emit builder with compression or write callback of emitted events, e.g.
+c.Compress(false).Emit("event", data)
+*/
+type Emitter struct {
+	c           *Channel
+	compression transport.Compression
+	written     WriteCallback
+}
+
+/**
+Start emit compressed or not compressed regardless of transport compression
+threshold, e.g. big snapshots are compressed and small control events are not.
+Compression should be enabled in transport, see WebsocketTransport.EnableCompression,
+transports without compression send events as is
+*/
+func (c *Channel) Compress(compress bool) *Emitter {
+	e := &Emitter{c: c, compression: transport.CompressionOff}
+	if compress {
+		e.compression = transport.CompressionOn
+	}
+	return e
+}
+
+/**
+Same as Channel.Emit, with compression and write callback of emitter
+*/
+func (e *Emitter) Emit(method string, args ...interface{}) error {
+	return e.EmitContext(context.Background(), method, args...)
+}
+
+/**
+Same as Channel.EmitContext, with compression and write callback of emitter
+*/
+func (e *Emitter) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	ctx = context.WithValue(ctx, compressionKey{}, e.compression)
+	if e.written != nil {
+		ctx = context.WithValue(ctx, writeCallbackKey{}, e.written)
+	}
+	return e.c.EmitContext(ctx, method, args...)
+}
+
+/**
+Prefix queued packet with compression marker, if compression is set in ctx
+*/
+func markCompression(ctx context.Context, command string) string {
+	mode, _ := ctx.Value(compressionKey{}).(transport.Compression)
+	switch mode {
+	case transport.CompressionOn:
+		return compressOnMarker + command
+	case transport.CompressionOff:
+		return compressOffMarker + command
+	}
+
+	return command
+}
+
+/**
+Split queued packet to packet itself and its compression
+*/
+func splitCompression(command string) (string, transport.Compression) {
+	switch {
+	case strings.HasPrefix(command, compressOnMarker):
+		return command[len(compressOnMarker):], transport.CompressionOn
+	case strings.HasPrefix(command, compressOffMarker):
+		return command[len(compressOffMarker):], transport.CompressionOff
+	}
+
+	return command, transport.CompressionDefault
+}
+
+/**
+Set compression of the next written packets, if transport supports it
+*/
+func (c *Channel) setWriteCompression(mode transport.Compression) {
+	if conn, ok := c.connection().(transport.CompressionConnection); ok {
+		conn.SetWriteCompression(mode)
+	}
+}
@@ -0,0 +1,201 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"time"
+)
+
+const (
+	//time given to engine.io v4 clients to send connect packet, as socket.io does
+	DefaultConnectTimeout = 45 * time.Second
+)
+
+var (
+	ErrorConnectTimeout = errors.New("Connect packet timeout")
+	ErrorNotConnected   = errors.New("Event before connect packet")
+)
+
+/**
+Connect auth handler, called with auth payload of connect packet sent by
+socket.io v3 and newer clients, see WithConnectAuthHandler. Returned value
+is stored in channel, see Channel.Auth, returned error rejects the connection
+with error packet, *ConnectError is sent as is
+*/
+type ConnectAuthHandler func(c *Channel, payload string) (interface{}, error)
+
+/**
+Get raw auth payload of client connect packet, empty if client sent none
+*/
+func (c *Channel) AuthPayload() string {
+	c.authLock.RLock()
+	defer c.authLock.RUnlock()
+
+	return c.authPayload
+}
+
+/**
+Decode auth payload of client connect packet to given value
+*/
+func (c *Channel) UnmarshalAuthPayload(v interface{}) error {
+	return c.parser.Unmarshal(c.AuthPayload(), v)
+}
+
+/**
+Store auth payload of incoming connect packet and pass it to connect
+auth handler. Returned error closes the channel, client is notified by error packet.
+Connection handler is called when the first connect packet is accepted,
+events are dropped until then. Called by inLoop only
+*/
+func (s *Server) processConnectPacket(c *Channel, msg *protocol.Message) error {
+	c.authLock.Lock()
+	c.authPayload = msg.Args
+	c.authLock.Unlock()
+
+	if err := s.authorizeConnect(c, "", msg.Args); err != nil {
+		c.flush(upgradeTimeout)
+		return err
+	}
+	if err := s.acceptConnect(c); err != nil {
+		return err
+	}
+
+	if !c.connected {
+		c.connected = true
+		c.stopConnectTimeout()
+		go s.callLoopEvent(c, OnConnection)
+	}
+	return nil
+}
+
+/**
+Pass auth payload of connect packet to connect auth handler if it is set.
+Rejection is sent to client as error packet of given namespace
+*/
+func (s *Server) authorizeConnect(c *Channel, namespace, payload string) error {
+	if s.connectAuthHandler == nil {
+		return nil
+	}
+
+	auth, err := s.connectAuthHandler(c, payload)
+	if err != nil {
+		reason, ok := err.(*ConnectError)
+		if !ok {
+			reason = &ConnectError{Message: err.Error()}
+		}
+		send(&protocol.Message{Type: protocol.MessageTypeError, Namespace: namespace}, c, reason)
+		return reason
+	}
+
+	c.authLock.Lock()
+	c.auth = auth
+	c.authLock.Unlock()
+	return nil
+}
+
+/**
+Stop connect timeout of server channel, connect packet of any namespace
+was accepted. Called by inLoop only
+*/
+func (c *Channel) stopConnectTimeout() {
+	if c.connectAccepted != nil {
+		close(c.connectAccepted)
+		c.connectAccepted = nil
+	}
+}
+
+/**
+Check that incoming event can be processed: server channel accepted
+connect packet, or event belongs to custom namespace, which is checked
+to be joined on routing. Called by inLoop only
+*/
+func (c *Channel) acceptsEvent(namespace string) bool {
+	if c.server == nil || c.connected {
+		return true
+	}
+
+	return namespace != "" && c.server.hasNamespaces()
+}
+
+/**
+Close channel of engine.io v4 client with ErrorConnectTimeout,
+if it sends no accepted connect packet in given time
+*/
+func connectWatchdog(c *Channel, m *methods, accepted <-chan struct{}, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-accepted:
+	case <-c.Context().Done():
+	case <-timer.C:
+		c.logger.Debug("channel closed without connect packet", "sid", c.Id())
+		closeChannel(c, m, ErrorConnectTimeout)
+	}
+}
+
+/**
+Reply to connect packet of engine.io v4 client with channel sid,
+v3 clients receive connect packet in open sequence
+*/
+func (s *Server) acceptConnect(c *Channel) error {
+	if c.protocolVersion < transport.ProtocolV4 {
+		return nil
+	}
+
+	send(&protocol.Message{Type: protocol.MessageTypeEmpty}, c, &connectReply{Sid: c.Id()})
+	return nil
+}
+
+/**
+Connect packet payload sent to engine.io v4 clients
+*/
+type connectReply struct {
+	Sid string `json:"sid" msgpack:"sid"`
+}
+
+/**
+Get engine.io protocol version of server channel, 3 or 4 by EIO query
+parameter of client, see transport.ProtocolVersion. Zero for client channels
+*/
+func (c *Channel) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+/**
+Get socket.io protocol version of server channel: 4 for engine.io v3
+clients (socket.io 2.x), 5 for engine.io v4 ones. Zero for client channels
+*/
+func (c *Channel) SocketIOVersion() int {
+	if c.protocolVersion == 0 {
+		return 0
+	}
+	return c.protocolVersion + 1
+}
+
+/**
+Check that protocol version of new connection is accepted by server,
+see WithProtocolVersions
+*/
+func (s *Server) acceptsVersion(r *http.Request) bool {
+	if len(s.protocolVersions) == 0 {
+		return true
+	}
+
+	_, ok := s.protocolVersions[transport.ProtocolVersion(r)]
+	return ok
+}
+
+/**
+Queue connect packet with auth payload, sent by socket.io v3 and newer clients
+*/
+func (c *Client) sendConnectAuth() error {
+	payload, err := c.parser.Marshal(c.authData)
+	if err != nil {
+		return err
+	}
+
+	return send(&protocol.Message{Type: protocol.MessageTypeEmpty, Args: payload}, &c.Channel, nil)
+}
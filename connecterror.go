@@ -0,0 +1,77 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Connection rejection error, sent to client as socket.io error packet.
+Return it from AuthHandler to reject connection this way instead of
+http error, client receives it with OnConnectError event
+*/
+type ConnectError struct {
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *ConnectError) Error() string {
+	return e.Message
+}
+
+/**
+Error packet can contain plain string or object with message and data
+*/
+func (e *ConnectError) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &e.Message)
+	}
+
+	type plain ConnectError
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+/**
+Process incoming error packet: rejection of connection before it is
+established, OnConnectError event, or error of already established one,
+OnError event. Handler can accept ConnectError or string argument
+*/
+func (m *methods) processErrorPacket(c *Channel, msg *protocol.Message) {
+	event := OnError
+	if !c.connected {
+		event = OnConnectError
+
+		//remote side closes connection right after rejection
+		reason := &ConnectError{}
+		if err := c.parser.Unmarshal(msg.Args, reason); err != nil {
+			reason.Message = msg.Args
+		}
+		c.connectError = reason
+	}
+
+	go m.callErrorEvent(c, event, msg.Args)
+}
+
+/**
+Call error event handler with decoded error packet data
+*/
+func (m *methods) callErrorEvent(c *Channel, event, args string) {
+	defer m.recoverPanic(c)
+
+	f, ok := m.findMethod(event)
+	if !ok {
+		return
+	}
+
+	data, err := f.decodeArgs(func(v []interface{}) error {
+		return unmarshalArgs(c.parser, args, v)
+	})
+	if err != nil {
+		m.callErrorHandler(c, err)
+		return
+	}
+
+	if err := f.getError(f.callFunc(c, data)); err != nil {
+		m.callErrorHandler(c, err)
+	}
+}
@@ -0,0 +1,143 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"strconv"
+	"sync"
+)
+
+/**
+Get id of incoming event for deduplication, empty id means event
+is not deduplicated, see WithDeduplication
+*/
+type MessageIdFunc func(msg *protocol.Message) string
+
+/**
+Default message id: ack id of ack requests, which is kept by retries
+of reliable emits, see EmitReliable. Emits are not deduplicated
+*/
+func AckMessageId(msg *protocol.Message) string {
+	if msg.Type != protocol.MessageTypeAckRequest {
+		return ""
+	}
+	return strconv.Itoa(msg.AckId)
+}
+
+type dedupEntry struct {
+	done   bool
+	result interface{}
+}
+
+/**
+Ids of last incoming events of channel with their ack results
+*/
+type dedupWindow struct {
+	size    int
+	entries map[string]*dedupEntry
+	//ids in arrival order, the oldest one is forgotten when window is full
+	order []string
+	lock  sync.Mutex
+}
+
+func newDedupWindow(size int) *dedupWindow {
+	return &dedupWindow{
+		size:    size,
+		entries: make(map[string]*dedupEntry, size),
+	}
+}
+
+/**
+Remember id, returns entry of already seen one
+*/
+func (w *dedupWindow) seen(id string) (dedupEntry, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if entry, ok := w.entries[id]; ok {
+		return *entry, true
+	}
+
+	if len(w.order) >= w.size {
+		delete(w.entries, w.order[0])
+		w.order = w.order[1:]
+	}
+	w.entries[id] = &dedupEntry{}
+	w.order = append(w.order, id)
+
+	return dedupEntry{}, false
+}
+
+/**
+Store result of processed event, failed event is forgotten,
+so it is processed again when retried
+*/
+func (w *dedupWindow) finish(id string, result interface{}, ok bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	entry, found := w.entries[id]
+	if !found {
+		return
+	}
+	if ok {
+		entry.done, entry.result = true, result
+		return
+	}
+
+	delete(w.entries, id)
+	for i, seen := range w.order {
+		if seen == id {
+			w.order = append(w.order[:i:i], w.order[i+1:]...)
+			break
+		}
+	}
+}
+
+/**
+Check that incoming event is duplicate of already received one. Ack request
+duplicating processed event is answered with its result, other duplicates
+are dropped. Returns id of not duplicate event, see finishDedup
+*/
+func (m *methods) deduplicate(c *Channel, msg *protocol.Message) (string, bool) {
+	if m.dedupWindow <= 0 {
+		return "", false
+	}
+
+	idFunc := m.messageId
+	if idFunc == nil {
+		idFunc = AckMessageId
+	}
+	id := idFunc(msg)
+	if id == "" {
+		return "", false
+	}
+
+	c.dedupOnce.Do(func() {
+		c.dedup = newDedupWindow(m.dedupWindow)
+	})
+	entry, dup := c.dedup.seen(id)
+	if !dup {
+		return id, false
+	}
+
+	if entry.done && msg.Type == protocol.MessageTypeAckRequest {
+		//method is not sent, it selects serializer of ack result
+		send(&protocol.Message{
+			Type:   protocol.MessageTypeAckResponse,
+			AckId:  msg.AckId,
+			Method: msg.Method,
+		}, c, entry.result)
+	}
+	return id, true
+}
+
+/**
+Store result of event processing for its duplicates, nothing is done
+for events without id
+*/
+func (c *Channel) finishDedup(id string, result interface{}, ok bool) {
+	if id == "" || c.dedup == nil {
+		return
+	}
+	c.dedup.finish(id, result, ok)
+}
@@ -0,0 +1,119 @@
+package gosocketio
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+Goroutines of server by category, see Server.Diagnostics
+*/
+type Diagnostics struct {
+	//all goroutines of process, as runtime.NumGoroutine
+	Goroutines int `json:"goroutines"`
+	InLoops    int `json:"inLoops"`
+	OutLoops   int `json:"outLoops"`
+	//event handlers being run, by workers or own goroutines
+	Handlers int `json:"handlers"`
+	//worker pool goroutines, see WithWorkerPool
+	Workers int `json:"workers"`
+	//broadcast emits in progress, delayed ones included
+	Broadcasts int `json:"broadcasts"`
+	//run time of the oldest running handler, zero if none is running
+	OldestHandler time.Duration `json:"oldestHandler"`
+}
+
+/**
+Counters of server goroutines
+*/
+type goroutineCounters struct {
+	inLoops    int64
+	outLoops   int64
+	workers    int64
+	broadcasts int64
+
+	//start times of running handlers
+	handlers     map[uint64]time.Time
+	handlerId    uint64
+	handlersLock sync.Mutex
+}
+
+/**
+Count goroutine while it runs, returned function should be deferred
+*/
+func trackGoroutine(counter *int64) func() {
+	atomic.AddInt64(counter, 1)
+	return func() {
+		atomic.AddInt64(counter, -1)
+	}
+}
+
+/**
+Remember start of handler run, returned function should be called
+when handler returns
+*/
+func (g *goroutineCounters) trackHandler() func() {
+	g.handlersLock.Lock()
+	if g.handlers == nil {
+		g.handlers = make(map[uint64]time.Time)
+	}
+	g.handlerId++
+	id := g.handlerId
+	g.handlers[id] = time.Now()
+	g.handlersLock.Unlock()
+
+	return func() {
+		g.handlersLock.Lock()
+		delete(g.handlers, id)
+		g.handlersLock.Unlock()
+	}
+}
+
+/**
+Get amount of running handlers and run time of the oldest one
+*/
+func (g *goroutineCounters) runningHandlers() (int, time.Duration) {
+	g.handlersLock.Lock()
+	defer g.handlersLock.Unlock()
+
+	var oldest time.Time
+	for _, started := range g.handlers {
+		if oldest.IsZero() || started.Before(oldest) {
+			oldest = started
+		}
+	}
+	if oldest.IsZero() {
+		return 0, 0
+	}
+	return len(g.handlers), time.Since(oldest)
+}
+
+/**
+Get goroutines of server by category, e.g. to find out what is left
+running when Shutdown does not return
+*/
+func (s *Server) Diagnostics() Diagnostics {
+	handlers, oldest := s.goroutines.runningHandlers()
+
+	return Diagnostics{
+		Goroutines:    runtime.NumGoroutine(),
+		InLoops:       int(atomic.LoadInt64(&s.goroutines.inLoops)),
+		OutLoops:      int(atomic.LoadInt64(&s.goroutines.outLoops)),
+		Handlers:      handlers,
+		Workers:       int(atomic.LoadInt64(&s.goroutines.workers)),
+		Broadcasts:    int(atomic.LoadInt64(&s.goroutines.broadcasts)),
+		OldestHandler: oldest,
+	}
+}
+
+/**
+Get goroutine counters of server channel, nil for client ones
+*/
+func (c *Channel) goroutines() *goroutineCounters {
+	if c.server == nil {
+		return nil
+	}
+	return &c.server.goroutines
+}
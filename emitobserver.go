@@ -0,0 +1,48 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Function observing events written to socket, bytes is encoded packet size
+*/
+type EmitObserver func(c *Channel, event string, bytes int)
+
+/**
+Set function called after event or ack request is written to socket,
+e.g. for delivery accounting or per-event egress metrics. Called by
+writing goroutine of channel, so it should not block
+*/
+func (m *methods) OnEmit(f EmitObserver) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.emitted = f
+}
+
+/**
+Pass written events to emit observer, packets are decoded
+to find event names only if observer is set
+*/
+func (m *methods) observeEmits(c *Channel, msgs []string) {
+	m.messageHandlersLock.RLock()
+	f := m.emitted
+	m.messageHandlersLock.RUnlock()
+
+	if f == nil {
+		return
+	}
+
+	defer m.recoverPanic(c)
+	for _, packet := range msgs {
+		msg, err := c.parser.Decode(packet)
+		if err != nil {
+			continue
+		}
+		if msg.Type == protocol.MessageTypeEmit || msg.Type == protocol.MessageTypeAckRequest {
+			f(c, msg.Method, len(packet))
+		}
+		protocol.ReleaseMessage(msg)
+	}
+}
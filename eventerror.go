@@ -0,0 +1,55 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+const (
+	//event sent to client when handler of its emit returns error,
+	//see WithEventErrorReplies
+	OnEventError = "event_error"
+)
+
+/**
+Handler error sent back to client, see WithEventErrorReplies. Return it
+from handler to set data sent with error, message of other errors is sent
+*/
+type EventError struct {
+	//method of failed event, not set in ack response
+	Event   string      `json:"event,omitempty"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *EventError) Error() string {
+	return e.Message
+}
+
+/**
+Send error returned by handler to client: as ack response for ack request,
+or as OnEventError event for emit
+*/
+func (m *methods) replyError(c *Channel, method string, msgType, ackId int, err error) {
+	reply := &EventError{Message: err.Error()}
+	if e, ok := err.(*EventError); ok {
+		reply.Message, reply.Data = e.Message, e.Data
+	}
+
+	if msgType == protocol.MessageTypeAckRequest {
+		//method is not sent, it selects serializer of ack result
+		send(&protocol.Message{
+			Type:      protocol.MessageTypeAckResponse,
+			AckId:     ackId,
+			Method:    method,
+			Namespace: m.namespace,
+		}, c, reply)
+		return
+	}
+
+	reply.Event = method
+	send(&protocol.Message{
+		Type:      protocol.MessageTypeEmit,
+		Method:    OnEventError,
+		Namespace: m.namespace,
+	}, c, reply)
+}
@@ -0,0 +1,85 @@
+package gosocketio
+
+import (
+	"errors"
+	"strconv"
+	"unicode"
+)
+
+var (
+	ErrorEventNameTooLong    = errors.New("Event name is too long")
+	ErrorEventNameCharacters = errors.New("Event name contains not allowed characters")
+	ErrorEventNameNotAllowed = errors.New("Event name is not allowed")
+)
+
+/**
+Validator of incoming event names, called before handler lookup,
+returned error drops the event, see WithEventNameValidator
+*/
+type EventNameValidator func(method string) error
+
+/**
+Error passed to error handler once per channel for the first incoming
+event with invalid name, following ones are dropped silently
+*/
+type InvalidEventError struct {
+	Method string
+	Err    error
+}
+
+func (e *InvalidEventError) Error() string {
+	return "Invalid event " + strconv.Quote(e.Method) + ": " + e.Err.Error()
+}
+
+/**
+Create validator accepting names not longer than maxLength bytes,
+without control characters. If allowed names are given, other ones
+are rejected. Zero maxLength does not limit length
+*/
+func ValidateEventNames(maxLength int, allowed ...string) EventNameValidator {
+	var allowList map[string]struct{}
+	if len(allowed) > 0 {
+		allowList = make(map[string]struct{}, len(allowed))
+		for _, name := range allowed {
+			allowList[name] = struct{}{}
+		}
+	}
+
+	return func(method string) error {
+		if maxLength > 0 && len(method) > maxLength {
+			return ErrorEventNameTooLong
+		}
+		if allowList != nil {
+			if _, ok := allowList[method]; !ok {
+				return ErrorEventNameNotAllowed
+			}
+			return nil
+		}
+		for _, r := range method {
+			if r == unicode.ReplacementChar || unicode.IsControl(r) {
+				return ErrorEventNameCharacters
+			}
+		}
+		return nil
+	}
+}
+
+/**
+Check incoming event name with validator, first invalid name
+of channel is reported to error handler
+*/
+func (m *methods) validEventName(c *Channel, method string) bool {
+	if m.eventNameValidator == nil {
+		return true
+	}
+
+	err := m.eventNameValidator(method)
+	if err == nil {
+		return true
+	}
+
+	c.invalidEventOnce.Do(func() {
+		m.callErrorHandler(c, &InvalidEventError{Method: method, Err: err})
+	})
+	return false
+}
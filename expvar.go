@@ -0,0 +1,67 @@
+package gosocketio
+
+import (
+	"errors"
+	"expvar"
+	"runtime"
+)
+
+/**
+Server statistics published with expvar, see WithExpvar
+*/
+type expvarMetrics struct {
+	vars *expvar.Map
+
+	connects    expvar.Int
+	disconnects expvar.Int
+	messages    expvar.Int
+	dropped     expvar.Int
+}
+
+func newExpvarMetrics(name string) *expvarMetrics {
+	return &expvarMetrics{vars: expvar.NewMap(name)}
+}
+
+func (m *expvarMetrics) Init(s *Server) {
+	m.vars.Set("sids", expvar.Func(func() interface{} {
+		return s.AmountOfSids()
+	}))
+	m.vars.Set("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	m.vars.Set("diagnostics", expvar.Func(func() interface{} {
+		return s.Diagnostics()
+	}))
+	m.vars.Set("connects", &m.connects)
+	m.vars.Set("disconnects", &m.disconnects)
+	m.vars.Set("messages", &m.messages)
+	m.vars.Set("dropped", &m.dropped)
+
+	s.addConnectHook(func(*Channel) {
+		m.connects.Add(1)
+	})
+	s.addDisconnectHook(func(*Channel) {
+		m.disconnects.Add(1)
+	})
+}
+
+func (m *expvarMetrics) MessageReceived(*Channel) {
+	m.messages.Add(1)
+}
+
+func (m *expvarMetrics) MessagesSent(*Channel, int) {}
+
+func (m *expvarMetrics) QueueDepth(*Channel, int) {}
+
+func (m *expvarMetrics) Broadcast(string, int) {}
+
+/**
+Incoming packets dropped by limits are counted, handler errors are not
+*/
+func (m *expvarMetrics) Error(_ *Channel, err error) {
+	var unknown *UnknownPacketError
+	if errors.As(err, &unknown) || errors.Is(err, ErrorRateLimited) ||
+		errors.Is(err, ErrorBandwidthExceeded) || errors.Is(err, ErrorMessageTooLarge) {
+		m.dropped.Add(1)
+	}
+}
@@ -0,0 +1,45 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+)
+
+/**
+Get transports to connect with, in order of preference
+*/
+func (c *Client) transports() []transport.Transport {
+	return append([]transport.Transport{c.transport}, c.fallbacks...)
+}
+
+/**
+Connect with the first transport able to do it, starting from preferred one.
+Returns error of the last transport if all of them failed
+*/
+func (c *Client) connect() (transport.Connection, error) {
+	var lastErr error
+	for i, tr := range c.transports() {
+		conn, err := tr.Connect(c.url)
+		if err == nil {
+			c.status.setTransport(tr)
+			return conn, nil
+		}
+
+		lastErr = err
+		if i < len(c.fallbacks) {
+			c.Channel.logger.Warn("transport failed, falling back", "url", c.url,
+				"transport", transportName(tr), "error", err)
+		}
+	}
+
+	return nil, lastErr
+}
+
+/**
+Get name of transport for logs, empty if it is not named
+*/
+func transportName(tr transport.Transport) string {
+	if named, ok := tr.(transport.NamedTransport); ok {
+		return named.Name()
+	}
+	return ""
+}
@@ -1,32 +1,120 @@
 package gosocketio
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/graarh/golang-socketio/protocol"
+	"path"
+	"runtime/debug"
 	"sync"
-	"reflect"
+	"time"
 )
 
 const (
 	OnConnection    = "connection"
 	OnDisconnection = "disconnection"
 	OnError         = "error"
+	OnConnectError  = "connect_error"
+	OnKick          = "kick"
+
+	//client reconnection events, see DialWithReconnect
+	OnReconnecting    = "reconnecting"
+	OnReconnected     = "reconnected"
+	OnReconnectFailed = "reconnect_failed"
+)
+
+var (
+	ErrorReservedEvent = errors.New("Reserved event name")
+
+	//system events, called by library only, never by remote emits
+	reservedEvents = map[string]struct{}{
+		OnConnection:      {},
+		OnDisconnection:   {},
+		OnError:           {},
+		OnConnectError:    {},
+		OnReconnecting:    {},
+		OnReconnected:     {},
+		OnReconnectFailed: {},
+	}
 )
 
+/**
+Check that event name is reserved for system events, so remote side
+can not emit it to invoke system handlers
+*/
+func isReservedEvent(method string) bool {
+	_, ok := reservedEvents[method]
+	return ok
+}
+
 /**
 System handler function for internal event processing
 */
 type systemHandler func(c *Channel)
 
+/**
+Error handler function, receives errors returned by handlers
+and errors of incoming messages processing
+*/
+type ErrorHandler func(c *Channel, err error)
+
+/**
+Recovery handler function, receives value of panic occurred in handler
+or middleware, channel is kept open. Called after error handler
+receives *PanicError
+*/
+type RecoveryHandler func(c *Channel, r interface{})
+
+/**
+Function receiving incoming events without processing function,
+args are encoded event arguments, e.g. json ones, see OnUnhandled
+*/
+type UnhandledHandler func(c *Channel, event string, args string)
+
+/**
+Middleware function, called for every incoming event before its handler,
+returned error drops the event. Message is reused after processing,
+so it should not be kept after middleware returns
+*/
+type Middleware func(c *Channel, msg *protocol.Message) error
+
 /**
 Contains maps of message processing functions
 */
 type methods struct {
 	messageHandlers     map[string]*caller
 	messageHandlersLock sync.RWMutex
+	//patterns of messageHandlers keys in registration order, see On
+	patterns []string
+	//routers mounted under event name prefixes, see Mount
+	routers   []mountedRouter
+	unhandled UnhandledHandler
+	emitted   EmitObserver
+
+	middlewares     []Middleware
+	interceptors    []Interceptor
+	middlewaresLock sync.RWMutex
+
+	serializers *eventSerializers
 
 	onConnection    systemHandler
 	onDisconnection systemHandler
+
+	errorHandler    ErrorHandler
+	recoveryHandler RecoveryHandler
+	logger          Logger
+	metrics         Metrics
+
+	handlerTimeout     time.Duration
+	replyErrors        bool
+	eventNameValidator EventNameValidator
+
+	//deduplication of incoming events, see WithDeduplication
+	dedupWindow int
+	messageId   MessageIdFunc
+
+	//namespace of handlers, replies are sent to, see Manager
+	namespace string
 }
 
 /**
@@ -34,36 +122,210 @@ create messageHandlers map
 */
 func (m *methods) initMethods() {
 	m.messageHandlers = make(map[string]*caller)
+	m.serializers = &eventSerializers{}
+	m.logger = stdLogger{}
 }
 
 /**
-Add message processing function, and bind it to given method
+Add message processing function, and bind it to given method.
+Method with glob pattern, e.g. "chat.*", binds function to all incoming
+events matching it, see path.Match for pattern syntax. Events are matched
+with exact names first, then with patterns in the order they were added,
+matched event name is returned by EventName of handler context
 */
 func (m *methods) On(method string, f interface{}) error {
+	if isEventPattern(method) {
+		if _, err := path.Match(method, ""); err != nil {
+			return err
+		}
+	}
+
 	c, err := newCaller(f)
 	if err != nil {
 		return err
 	}
 
+	m.addCaller(method, c)
+	return nil
+}
+
+/**
+Bind already parsed function to given method
+*/
+func (m *methods) addCaller(method string, c *caller) {
 	m.messageHandlersLock.Lock()
 	defer m.messageHandlersLock.Unlock()
+
+	if _, ok := m.messageHandlers[method]; !ok && isEventPattern(method) {
+		m.patterns = append(m.patterns, method)
+	}
 	m.messageHandlers[method] = c
+}
+
+/**
+Add message processing function, that is removed after first call
+*/
+func (m *methods) Once(method string, f interface{}) error {
+	c, err := newCaller(f)
+	if err != nil {
+		return err
+	}
+	c.Once = true
 
+	m.addCaller(method, c)
 	return nil
 }
 
 /**
-Find message processing function associated with given method
+Remove message processing function, bound to given method
 */
-func (m *methods) findMethod(method string) (*caller, bool) {
+func (m *methods) Off(method string) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	delete(m.messageHandlers, method)
+	m.removePattern(method)
+}
+
+/**
+Remove all message processing functions
+*/
+func (m *methods) OffAll() {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.messageHandlers = make(map[string]*caller)
+	m.patterns = nil
+	m.routers = nil
+}
+
+/**
+Set function receiving incoming events without processing function,
+e.g. to forward them elsewhere. Such events are dropped silently by default.
+Args can be decoded with UnmarshalAck of the channel
+*/
+func (m *methods) OnUnhandled(f UnhandledHandler) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.unhandled = f
+}
+
+/**
+Pass event without processing function to unhandled events handler
+*/
+func (m *methods) callUnhandled(c *Channel, event, args string) {
+	defer m.recoverPanic(c)
+
 	m.messageHandlersLock.RLock()
-	defer m.messageHandlersLock.RUnlock()
+	f := m.unhandled
+	m.messageHandlersLock.RUnlock()
+
+	if f != nil {
+		f(c, event, args)
+	}
+}
+
+/**
+Add middleware, middlewares are called in the order they were added
+*/
+func (m *methods) Use(f Middleware) {
+	m.middlewaresLock.Lock()
+	defer m.middlewaresLock.Unlock()
+
+	m.middlewares = append(m.middlewares, f)
+}
+
+/**
+Run middlewares chain for incoming event, stops on first error
+*/
+func (m *methods) callMiddlewares(c *Channel, msg *protocol.Message) error {
+	m.middlewaresLock.RLock()
+	middlewares := m.middlewares
+	m.middlewaresLock.RUnlock()
 
+	for _, f := range middlewares {
+		if err := f(c, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/**
+Pass error to error handler, if it is set
+*/
+func (m *methods) callErrorHandler(c *Channel, err error) {
+	if m.metrics != nil {
+		m.metrics.Error(c, err)
+	}
+	if m.errorHandler != nil {
+		m.errorHandler(c, err)
+	}
+}
+
+/**
+Error passed to error handler when handler or middleware panics,
+Stack is stack trace of panicked goroutine
+*/
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Handler panic: %v", e.Value)
+}
+
+/**
+Recover panic of handler, should be deferred. Panic is logged and passed
+to error handler as *PanicError, recovery handler is called as well if set,
+channel is kept open
+*/
+func (m *methods) recoverPanic(c *Channel) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	m.logger.Error("handler panic", "sid", c.Id(), "panic", r, "stack", string(stack))
+	m.callErrorHandler(c, &PanicError{Value: r, Stack: stack})
+	if m.recoveryHandler != nil {
+		m.recoveryHandler(c, r)
+	}
+}
+
+/**
+Find message processing function associated with given method,
+one-shot function is removed, so it is found only once
+*/
+func (m *methods) findMethod(method string) (*caller, bool) {
+	m.messageHandlersLock.RLock()
 	f, ok := m.messageHandlers[method]
-	return f, ok
+	m.messageHandlersLock.RUnlock()
+
+	if !ok || !f.Once {
+		return f, ok
+	}
+
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	//other goroutine could take it already
+	if m.messageHandlers[method] != f {
+		return nil, false
+	}
+	delete(m.messageHandlers, method)
+	m.removePattern(method)
+
+	return f, true
 }
 
 func (m *methods) callLoopEvent(c *Channel, event string) {
+	defer m.recoverPanic(c)
+
 	if m.onConnection != nil && event == OnConnection {
 		m.onConnection(c)
 	}
@@ -76,7 +338,9 @@ func (m *methods) callLoopEvent(c *Channel, event string) {
 		return
 	}
 
-	f.callFunc(c, &struct{}{})
+	if err := f.getError(f.callFunc(c, nil)); err != nil {
+		m.callErrorHandler(c, err)
+	}
 }
 
 /**
@@ -84,58 +348,143 @@ Check incoming message
 On ack_resp - look for waiter
 On ack_req - look for processing function and send ack_resp
 On emit - look for processing function
+Emit and ack_req are passed through middlewares first.
+Message is returned to pool when processing is done
 */
 func (m *methods) processIncomingMessage(c *Channel, msg *protocol.Message) {
+	defer protocol.ReleaseMessage(msg)
+	defer m.recoverPanic(c)
+
+	if err := c.decryptArgs(msg); err != nil {
+		m.callErrorHandler(c, channelError(c, msg.Method, err))
+		return
+	}
+
 	switch msg.Type {
-	case protocol.MessageTypeEmit:
-		f, ok := m.findMethod(msg.Method)
-		if !ok {
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest:
+		if err := m.callInterceptors(c, msg); err != nil {
+			m.callErrorHandler(c, channelError(c, msg.Method, err))
+			return
+		}
+		if isReservedEvent(msg.Method) {
+			m.callErrorHandler(c, channelError(c, msg.Method, ErrorReservedEvent))
 			return
 		}
 
-		if !f.ArgsPresent {
-			f.callFunc(c, &struct{}{})
+		id, duplicate := m.deduplicate(c, msg)
+		if duplicate {
 			return
 		}
+		var result interface{}
+		var ok bool
+		defer func() {
+			c.finishDedup(id, result, ok)
+		}()
 
-		data := f.getArgs()
-		err := json.Unmarshal([]byte(msg.Args), &data)
+		f, err := m.routeEvent(c, msg, msg.Method)
 		if err != nil {
 			return
 		}
-
-		f.callFunc(c, data)
-
-	case protocol.MessageTypeAckRequest:
-		f, ok := m.findMethod(msg.Method)
-		if !ok || !f.Out {
+		if f == nil {
+			m.callUnhandled(c, msg.Method, msg.Args)
 			return
 		}
 
-		var result []reflect.Value
-		if f.ArgsPresent {
-			//data type should be defined for unmarshall
-			data := f.getArgs()
-			err := json.Unmarshal([]byte(msg.Args), &data)
-			if err != nil {
-				return
-			}
-
-			result = f.callFunc(c, data)
-		} else {
-			result = f.callFunc(c, &struct{}{})
+		data, err := f.decodeEventArgs(func() (string, error) {
+			return msg.Args, nil
+		}, func(v []interface{}) error {
+			return unmarshalArgs(c.eventParser(msg.Method), msg.Args, v)
+		})
+		if err != nil {
+			m.callErrorHandler(c, channelError(c, msg.Method, &DecodeError{Err: err}))
+			return
 		}
 
-		ack := &protocol.Message{
-			Type:  protocol.MessageTypeAckResponse,
-			AckId: msg.AckId,
-		}
-		send(ack, c, result[0].Interface())
+		result, ok = m.callEvent(c, f, msg.Method, msg.Type, msg.AckId, data)
 
 	case protocol.MessageTypeAckResponse:
 		waiter, err := c.ack.getWaiter(msg.AckId)
 		if err == nil {
-			waiter <- msg.Args
+			//duplicate responses of retried reliable emits are dropped
+			select {
+			case waiter <- msg.Args:
+			default:
+			}
+		}
+	}
+}
+
+/**
+Find processing function of incoming event by exact name or pattern,
+ack request can be processed only by function returning a value
+*/
+func (m *methods) findEventMethod(msgType int, method string) (*caller, bool) {
+	f, ok := m.findMethod(method)
+	if !ok {
+		f, ok = m.findPatternMethod(method)
+	}
+	if !ok {
+		return nil, false
+	}
+	if msgType == protocol.MessageTypeAckRequest && !(f.Out || f.ErrOut) {
+		return nil, false
+	}
+
+	return f, true
+}
+
+/**
+Call event processing function with already decoded arguments,
+send ack response for ack request. Returns ack result and false
+if function failed
+*/
+func (m *methods) callEvent(c *Channel, f *caller, method string, msgType, ackId int,
+	data []interface{}) (ackResult interface{}, ok bool) {
+
+	defer m.recoverPanic(c)
+	if g := c.goroutines(); g != nil {
+		defer g.trackHandler()()
+	}
+
+	ctx := c.Context()
+	var err error
+	if c.tracer != nil {
+		var end func(error)
+		ctx, end = c.tracer.StartEvent(ctx, c, method)
+		defer func() {
+			end(err)
+		}()
+	}
+
+	if f.Ctx {
+		ctx = withEventName(ctx, method)
+	}
+	ctx, done := m.watchHandler(ctx, c, method)
+	//watchdog is stopped even if handler panics
+	defer done()
+	result := f.callFuncContext(ctx, c, data)
+
+	//returned error is passed to error handler, ack is not sent
+	//unless errors are replied to client
+	if err = f.getError(result); err != nil {
+		m.callErrorHandler(c, err)
+		if m.replyErrors {
+			m.replyError(c, method, msgType, ackId, err)
 		}
+		return nil, false
+	}
+	if msgType == protocol.MessageTypeEmit {
+		return nil, true
+	}
+
+	//method is not sent, it selects serializer of ack result
+	ack := &protocol.Message{
+		Type:      protocol.MessageTypeAckResponse,
+		AckId:     ackId,
+		Method:    method,
+		Namespace: m.namespace,
 	}
+	ackResult = f.getResult(result)
+	send(ack, c, ackResult)
+	return ackResult, true
 }
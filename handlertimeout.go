@@ -0,0 +1,41 @@
+package gosocketio
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+/**
+Error passed to error handler when event handler runs longer than
+handler timeout, see WithHandlerTimeout
+*/
+type HandlerTimeoutError struct {
+	Method  string
+	Timeout time.Duration
+}
+
+func (e *HandlerTimeoutError) Error() string {
+	return "Handler " + strconv.Quote(e.Method) + " is running longer than " + e.Timeout.String()
+}
+
+/**
+Bound handler context with handler timeout and start watchdog reporting
+handler still running after it. Returned function should be called when
+handler returns, nothing is done if timeout is not set
+*/
+func (m *methods) watchHandler(ctx context.Context, c *Channel, method string) (context.Context, func()) {
+	if m.handlerTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.handlerTimeout)
+	watchdog := time.AfterFunc(m.handlerTimeout, func() {
+		m.callErrorHandler(c, &HandlerTimeoutError{Method: method, Timeout: m.handlerTimeout})
+	})
+
+	return ctx, func() {
+		watchdog.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,57 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/**
+Handshake rejection error, sent to client as http response with given status
+and json body {"message": ..., "data": ...} before connection upgrade.
+Return it from AuthHandler to reject connection with e.g. 403 or 429 status,
+401 is used if status is not set
+*/
+type HandshakeError struct {
+	Status int `json:"-"`
+	//engine.io error code, understood by js clients
+	Code    int         `json:"code,omitempty"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+
+	//additional response headers, e.g. Retry-After
+	Header http.Header `json:"-"`
+}
+
+/**
+Engine.io error code of unsupported protocol version
+*/
+const HandshakeCodeBadProtocol = 5
+
+func (e *HandshakeError) Error() string {
+	return e.Message
+}
+
+/**
+Write rejection response
+*/
+func (e *HandshakeError) writeResponse(w http.ResponseWriter) {
+	status := e.Status
+	if status == 0 {
+		status = http.StatusUnauthorized
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		http.Error(w, e.Message, status)
+		return
+	}
+
+	for key, values := range e.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,71 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	HealthOk       = "ok"
+	HealthFull     = "full"
+	HealthDraining = "draining"
+	HealthShutdown = "shutdown"
+)
+
+/**
+Server state reported by health handler
+*/
+type Health struct {
+	Status         string `json:"status"`
+	Accepting      bool   `json:"accepting"`
+	Connections    int64  `json:"connections"`
+	MaxConnections int64  `json:"maxConnections,omitempty"`
+	Rooms          int64  `json:"rooms"`
+	Draining       bool   `json:"draining"`
+	Shutdown       bool   `json:"shutdown"`
+}
+
+/**
+Get current server state, server accepts new connections
+if it is not drained, shut down or full
+*/
+func (s *Server) Health() Health {
+	health := Health{
+		Status:         HealthOk,
+		Accepting:      true,
+		Connections:    s.AmountOfSids(),
+		MaxConnections: s.maxConnections,
+		Rooms:          s.AmountOfRooms(),
+		Draining:       s.IsDraining(),
+		Shutdown:       s.IsShutdown(),
+	}
+
+	switch {
+	case health.Shutdown:
+		health.Status = HealthShutdown
+	case health.Draining:
+		health.Status = HealthDraining
+	case s.maxConnections > 0 && health.Connections >= s.maxConnections:
+		health.Status = HealthFull
+	}
+	health.Accepting = health.Status == HealthOk
+
+	return health
+}
+
+/**
+Get http handler reporting server health as json, responds with 503 status
+if server does not accept new connections. Can be mounted at /healthz
+*/
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := s.Health()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !health.Accepting {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
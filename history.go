@@ -0,0 +1,95 @@
+package gosocketio
+
+import (
+	"sync"
+)
+
+/**
+Last broadcasts of each room, kept for channels joining later
+*/
+type roomHistory struct {
+	size int
+
+	events map[string][]missedEvent
+	lock   sync.RWMutex
+}
+
+func newRoomHistory(size int) *roomHistory {
+	return &roomHistory{
+		size:   size,
+		events: make(map[string][]missedEvent),
+	}
+}
+
+/**
+Store broadcast to given rooms, oldest events are dropped
+*/
+func (h *roomHistory) record(rooms []string, method string, args interface{}) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, room := range rooms {
+		if room == "" {
+			continue
+		}
+
+		events := h.events[room]
+		if len(events) >= h.size {
+			events = events[1:]
+		}
+		h.events[room] = append(events, missedEvent{method, args})
+	}
+}
+
+/**
+Get up to n last events of given room, oldest first
+*/
+func (h *roomHistory) last(room string, n int) []missedEvent {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	events := h.events[room]
+	if n < 0 {
+		n = 0
+	}
+	if n < len(events) {
+		events = events[len(events)-n:]
+	}
+
+	result := make([]missedEvent, len(events))
+	copy(result, events)
+	return result
+}
+
+func (h *roomHistory) clear(room string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.events, room)
+}
+
+/**
+Join this channel to given room and send up to n last room broadcasts,
+server should be created with WithRoomHistory option
+*/
+func (c *Channel) JoinWithHistory(room string, n int) error {
+	if err := c.Join(room); err != nil {
+		return err
+	}
+
+	if c.server.history == nil {
+		return nil
+	}
+
+	for _, event := range c.server.history.last(room, n) {
+		if err := c.Emit(event.method, event.args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
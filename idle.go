@@ -0,0 +1,53 @@
+package gosocketio
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrorIdleTimeout = errors.New("Idle timeout")
+)
+
+/**
+Remember time of incoming packet other than heartbeat, see WithIdleTimeout
+*/
+func (c *Channel) touchMessage() {
+	c.lastActivityLock.Lock()
+	c.lastMessage = time.Now()
+	c.lastActivityLock.Unlock()
+}
+
+/**
+Get time of the last packet received by channel, heartbeats excluded
+*/
+func (c *Channel) LastMessage() time.Time {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.lastMessage
+}
+
+/**
+Idle watchdog closes channel with ErrorIdleTimeout if nothing but pings
+and pongs is received from remote side for given timeout
+*/
+func idleWatchdog(c *Channel, m *methods, timeout time.Duration) {
+	ctx := c.Context()
+	wait := timeout
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		idle := time.Since(c.LastMessage())
+		if idle >= timeout {
+			c.logger.Debug("idle channel closed", "sid", c.Id(), "idle", idle)
+			closeChannel(c, m, ErrorIdleTimeout)
+			return
+		}
+		wait = timeout - idle
+	}
+}
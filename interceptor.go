@@ -0,0 +1,52 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Incoming event interceptor, called with decoded and decrypted message
+before middlewares and handler lookup. Message method and args can be
+rewritten, e.g. to migrate payloads of old clients. Returned error drops
+the message and is passed to error handler
+*/
+type Interceptor func(c *Channel, msg *protocol.Message) error
+
+/**
+Add incoming event interceptor, interceptors are called in the order
+they were added. Streaming decoder is not used if there are interceptors,
+see WithStreamingDecoder
+*/
+func (m *methods) Intercept(f Interceptor) {
+	m.middlewaresLock.Lock()
+	defer m.middlewaresLock.Unlock()
+
+	m.interceptors = append(m.interceptors, f)
+}
+
+/**
+Check that incoming events are intercepted
+*/
+func (m *methods) hasInterceptors() bool {
+	m.middlewaresLock.RLock()
+	defer m.middlewaresLock.RUnlock()
+
+	return len(m.interceptors) > 0
+}
+
+/**
+Run interceptors chain, stops on first error
+*/
+func (m *methods) callInterceptors(c *Channel, msg *protocol.Message) error {
+	m.middlewaresLock.RLock()
+	interceptors := m.interceptors
+	m.middlewaresLock.RUnlock()
+
+	for _, f := range interceptors {
+		if err := f(c, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+	"net"
+)
+
+/**
+Accept raw tcp connections of listener and serve them, blocks until
+listener fails or is closed. Use tls.NewListener for tls connections.
+Connections are closed right away if server does not accept new ones
+*/
+func (s *Server) ServeListener(l net.Listener, tr *transport.TcpTransport) error {
+	for {
+		netConn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		if s.IsShutdown() || s.IsDraining() ||
+			(s.maxConnections > 0 && s.AmountOfSids() >= s.maxConnections) {
+			netConn.Close()
+			continue
+		}
+
+		s.SetupEventLoop(tr.NewConnection(netConn), netConn.RemoteAddr().String(), nil)
+	}
+}
@@ -0,0 +1,83 @@
+package gosocketio
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+/**
+Logger receives internal conditions which can not be returned to caller,
+e.g. adapter failures, encoding panics, dropped packets and reconnection
+attempts. Fields are key and value pairs, e.g. "sid", c.Id()
+*/
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+/**
+Logger writing to standard log.Logger, debug messages are skipped
+*/
+type stdLogger struct {
+	l *log.Logger
+}
+
+/**
+Create Logger writing to given log.Logger, debug messages are written
+if debug is set. Standard log package output is used if l is nil
+*/
+func NewLogger(l *log.Logger, debug bool) Logger {
+	if debug {
+		return debugLogger{stdLogger{l}}
+	}
+	return stdLogger{l}
+}
+
+func (s stdLogger) Debug(msg string, fields ...interface{}) {}
+
+func (s stdLogger) Info(msg string, fields ...interface{}) {
+	s.write("INFO", msg, fields)
+}
+
+func (s stdLogger) Warn(msg string, fields ...interface{}) {
+	s.write("WARN", msg, fields)
+}
+
+func (s stdLogger) Error(msg string, fields ...interface{}) {
+	s.write("ERROR", msg, fields)
+}
+
+func (s stdLogger) write(level, msg string, fields []interface{}) {
+	var line strings.Builder
+	line.WriteString("socket.io ")
+	line.WriteString(level)
+	line.WriteString(" ")
+	line.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 < len(fields) {
+			fmt.Fprintf(&line, " %v=%v", fields[i], fields[i+1])
+		} else {
+			fmt.Fprintf(&line, " %v", fields[i])
+		}
+	}
+
+	if s.l != nil {
+		s.l.Println(line.String())
+		return
+	}
+	log.Println(line.String())
+}
+
+/**
+Standard logger writing debug messages as well
+*/
+type debugLogger struct {
+	stdLogger
+}
+
+func (d debugLogger) Debug(msg string, fields ...interface{}) {
+	d.write("DEBUG", msg, fields)
+}
@@ -1,21 +1,38 @@
 package gosocketio
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/graarh/golang-socketio/protocol"
 	"github.com/graarh/golang-socketio/transport"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 )
 
 const (
-	queueBufferSize = 500
+	DefaultQueueSize = 500
+
+	minQueueSize = 2
+
+	//max amount of queued messages written at once
+	maxWriteBatch = 64
+
+	//queue marker, can not be a valid packet
+	flushMarker = "\x00flush"
 )
 
 var (
-	ErrorWrongHeader = errors.New("Wrong header")
+	ErrorWrongHeader        = errors.New("Wrong header")
+	ErrorBinaryNotSupported = errors.New("Binary frames are not supported by transport")
+	ErrorRemoteClosed       = errors.New("Connection closed by remote side")
+	ErrorLocalClosed        = errors.New("Connection closed by local side")
+	ErrorMessageTooLarge    = errors.New("Message too large")
+	ErrorPingTimeout        = errors.New("Ping timeout")
 )
 
 /**
@@ -26,6 +43,11 @@ type Header struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+
+	RecoveryToken string `json:"recoveryToken,omitempty"`
+
+	//max size of polling payload, sent to engine.io v4 clients
+	MaxPayload int `json:"maxPayload,omitempty"`
 }
 
 /**
@@ -38,28 +60,170 @@ Close message means channel is closed
 ping is automatic
 */
 type Channel struct {
-	conn transport.Connection
+	conn     transport.Connection
+	connLock sync.RWMutex
 
 	out    chan string
 	header Header
+	//sockets of other namespaces sharing connection, see Manager
+	namespaces *namespaceRouter
+	//custom namespaces joined by server channel, see Server.Of
+	joined     map[string]*Namespace
+	joinedLock sync.Mutex
+	parser     protocol.Parser
+	//serializers of event arguments, see OnWith
+	serializers *eventSerializers
+
+	//payload encryption, see SetPayloadCipher
+	cipher     PayloadCipher
+	cipherLock sync.RWMutex
+
+	//max time to wait for ack response, see WithAckTimeout
+	ackTimeout time.Duration
+
+	//transforms of written packets, see AddOutgoingTransform
+	transforms     []OutgoingTransform
+	transformsLock sync.RWMutex
+
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+
+	controlWriteTimeout time.Duration
+	dataWriteTimeout    time.Duration
+
+	maxMessageSize     int
+	streamDecode       bool
+	skipUnknownPackets bool
+	//malformed packets in a row kept before channel is closed, see WithDecodeErrorTolerance
+	decodeTolerance int
+	decodeFailures  int
+	//invalid event names are reported once, see WithEventNameValidator
+	invalidEventOnce sync.Once
+
+	//reliable emits, see EmitReliable
+	reliablePolicy ReliablePolicy
+	reliableWindow chan struct{}
+	reliableOnce   sync.Once
+	//connection is restored by client after close
+	reconnectable bool
+
+	//ids of last incoming events, see WithDeduplication
+	dedup     *dedupWindow
+	dedupOnce sync.Once
+
+	//sequence numbers of sent and received events, see WithSequenceNumbers
+	sequenced    bool
+	sequence     uint64
+	received     uint64
+	sequenceGap  SequenceGapHandler
+	sequenceLock sync.Mutex
+	//keeps queue order of stamped events
+	sequenceOrder sync.Mutex
+
+	//incoming stream transfers by id, see OnStream
+	transfers     map[string]*incomingTransfer
+	transferId    int
+	transfersLock sync.Mutex
+
+	//engine.io protocol version of server channel, see ProtocolVersion
+	protocolVersion int
+
+	//continuation frames, see WithMessageChunking
+	chunkSize   int
+	chunkId     int
+	chunkLock   sync.Mutex
+	chunked     []byte
+	chunkedId   string
+	chunkedNext int
+
+	limiter      *rateLimiter
+	limiterLock  sync.RWMutex
+	inBandwidth  *rateLimiter
+	outBandwidth *rateLimiter
 
 	alive     bool
+	closing   bool
+	flushed   chan struct{}
 	aliveLock sync.Mutex
 
+	disconnectReason     error
+	disconnectReasonLock sync.RWMutex
+	kickReason           error
+
+	//replaced on client reconnection, see Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	ctxLock sync.RWMutex
+
+	session     map[string]interface{}
+	sessionLock sync.RWMutex
+
 	ack ackProcessor
 
+	//statistics are guarded by lastActivityLock
+	lastActivity     time.Time
+	lastActivityLock sync.Mutex
+	connectedAt      time.Time
+	bytesSent        int64
+	bytesReceived    int64
+	messagesSent     int64
+	messagesReceived int64
+	//last packet other than heartbeat, see WithIdleTimeout
+	lastMessage time.Time
+
+	//callbacks of emits waiting to be written, see OnWrite
+	written writeCallbacks
+
+	writeErrorHooks     []WriteErrorHook
+	writeErrorHooksLock sync.RWMutex
+
+	//events emitted by reconnecting client
+	offline *offlineBuffer
+
+	logger Logger
+	tracer Tracer
+
+	//max logged payload length of raw packets, zero disables logging
+	packetDebug int
+
 	server        *Server
 	ip            string
 	requestHeader http.Header
+	query         url.Values
+	auth          interface{}
+	authPayload   string
+	authLock      sync.RWMutex
+	recovered     bool
+
+	//used by inLoop only
+	connected    bool
+	connectError *ConnectError
+	//closed when server channel connect packet is accepted, see WithConnectTimeout
+	connectAccepted chan struct{}
 }
 
 /**
 create channel, map, and set active
 */
-func (c *Channel) initChannel() {
-	//TODO: queueBufferSize from constant to server or client variable
-	c.out = make(chan string, queueBufferSize)
+func (c *Channel) initChannel(queueSize int) {
+	if queueSize < minQueueSize {
+		queueSize = DefaultQueueSize
+	}
+	c.out = make(chan string, queueSize)
 	c.ack.resultWaiters = make(map[int](chan string))
+	c.session = make(map[string]interface{})
+	if c.parser == nil {
+		c.parser = protocol.JsonParser{}
+	}
+	if c.logger == nil {
+		c.logger = stdLogger{}
+	}
+	c.ctxLock.Lock()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.ctxLock.Unlock()
+	c.lastActivity = time.Now()
+	c.connectedAt = c.lastActivity
+	c.lastMessage = c.lastActivity
 	c.alive = true
 }
 
@@ -70,6 +234,96 @@ func (c *Channel) Id() string {
 	return c.header.Sid
 }
 
+/**
+Store value in channel session, e.g. authenticated user id
+*/
+func (c *Channel) Set(key string, value interface{}) {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+
+	c.session[key] = value
+}
+
+/**
+Get value stored in channel session
+*/
+func (c *Channel) Get(key string) (interface{}, bool) {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+
+	value, ok := c.session[key]
+	return value, ok
+}
+
+/**
+Remove value from channel session
+*/
+func (c *Channel) Delete(key string) {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+
+	delete(c.session, key)
+}
+
+/**
+Copy of all channel session values
+*/
+func (c *Channel) sessionValues() map[string]interface{} {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+
+	values := make(map[string]interface{}, len(c.session))
+	for key, value := range c.session {
+		values[key] = value
+	}
+	return values
+}
+
+/**
+Get current transport connection, it can be replaced on upgrade
+*/
+func (c *Channel) connection() transport.Connection {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+
+	return c.conn
+}
+
+/**
+Replace transport connection, previous one is closed
+*/
+func (c *Channel) upgradeConnection(conn transport.Connection) {
+	c.connLock.Lock()
+	prev := c.conn
+	c.conn = conn
+	c.connLock.Unlock()
+
+	prev.Close()
+}
+
+/**
+Get context of channel, it is cancelled when channel is closed, including
+server shutdown, so goroutines started by handlers can stop with connection.
+Context of client is replaced on reconnection, returned one is cancelled
+when current connection is lost. See DisconnectReason for close reason
+*/
+func (c *Channel) Context() context.Context {
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+
+	return c.ctx
+}
+
+/**
+Cancel current context of channel
+*/
+func (c *Channel) cancelContext() {
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+
+	c.cancel()
+}
+
 /**
 Checks that Channel is still alive
 */
@@ -81,27 +335,114 @@ func (c *Channel) IsAlive() bool {
 }
 
 /**
-Close channel
+Check that channel is alive and is not being closed gracefully
 */
-func closeChannel(c *Channel, m *methods, args ...interface{}) error {
+func (c *Channel) canSend() bool {
 	c.aliveLock.Lock()
 	defer c.aliveLock.Unlock()
 
+	return c.alive && !c.closing
+}
+
+/**
+Stop accepting new messages and wait until already queued ones are written
+to socket, up to given timeout
+*/
+func (c *Channel) flush(timeout time.Duration) {
+	c.aliveLock.Lock()
+	if !c.alive || c.closing {
+		c.aliveLock.Unlock()
+		return
+	}
+	c.closing = true
+	c.flushed = make(chan struct{})
+	flushed := c.flushed
+	c.aliveLock.Unlock()
+
+	deadline := time.After(timeout)
+	select {
+	case c.out <- flushMarker:
+	case <-deadline:
+		return
+	}
+
+	select {
+	case <-flushed:
+	case <-deadline:
+	}
+}
+
+/**
+Called by outLoop, when all messages queued before flush marker are written
+*/
+func (c *Channel) markFlushed() {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.flushed != nil {
+		close(c.flushed)
+		c.flushed = nil
+	}
+}
+
+/**
+Get the reason of channel disconnection, e.g. transport read error,
+ErrorRemoteClosed, ErrorLocalClosed, ErrorPingTimeout, ErrorIdleTimeout
+or ErrorSocketOverflood.
+Returns nil while channel is alive
+*/
+func (c *Channel) DisconnectReason() error {
+	c.disconnectReasonLock.RLock()
+	defer c.disconnectReasonLock.RUnlock()
+
+	return c.disconnectReason
+}
+
+/**
+Close channel, first error argument is stored as disconnection reason
+*/
+func closeChannel(c *Channel, m *methods, args ...interface{}) error {
+	c.aliveLock.Lock()
 	if !c.alive {
 		//already closed
+		c.aliveLock.Unlock()
 		return nil
 	}
 
-	c.conn.Close()
+	reason := ErrorLocalClosed
+	if len(args) > 0 {
+		if err, ok := args[0].(error); ok {
+			reason = err
+		}
+	}
+	c.disconnectReasonLock.Lock()
+	c.disconnectReason = reason
+	c.disconnectReasonLock.Unlock()
+
+	c.connection().Close()
 	c.alive = false
+	c.cancelContext()
+	//pending acks return ErrorChannelClosed
+	c.ack.clearWaiters()
 
 	//clean outloop
 	for len(c.out) > 0 {
 		<-c.out
 	}
 	c.out <- protocol.CloseMessage
+	if c.flushed != nil {
+		//nothing more will be written, release graceful close
+		close(c.flushed)
+		c.flushed = nil
+	}
+	c.aliveLock.Unlock()
 
+	//handlers are called without lock, so they can use the channel
+	c.written.closeAll(reason)
 	m.callLoopEvent(c, OnDisconnection)
+	if c.namespaces != nil {
+		c.namespaces.disconnectAll(c)
+	}
 
 	overfloodedLock.Lock()
 	delete(overflooded, c)
@@ -112,33 +453,241 @@ func closeChannel(c *Channel, m *methods, args ...interface{}) error {
 
 //incoming messages loop, puts incoming messages to In channel
 func inLoop(c *Channel, m *methods) error {
+	if g := c.goroutines(); g != nil {
+		defer trackGoroutine(&g.inLoops)()
+	}
+
 	for {
-		pkg, err := c.conn.GetMessage()
+		conn := c.connection()
+		data, stream, err := c.readIncoming(conn)
+		if err == ErrorMessageTooLarge {
+			c.touch()
+			c.rejectMessage(ErrorMessageTooLarge)
+			m.callErrorHandler(c, channelError(c, "", ErrorMessageTooLarge))
+			continue
+		}
 		if err != nil {
+			if c.connection() != conn {
+				//transport was upgraded, continue with the new one
+				continue
+			}
+			if c.connectError != nil {
+				return closeChannel(c, m, c.connectError)
+			}
 			return closeChannel(c, m, err)
 		}
-		msg, err := protocol.Decode(pkg)
+		c.touch()
+		if stream != nil {
+			c.touchMessage()
+			c.debugPacket("in", "<streamed event>")
+			if !c.acceptsEvent("") {
+				//rest of packet is skipped by the next read
+				m.callErrorHandler(c, channelError(c, "", ErrorNotConnected))
+				continue
+			}
+			err := m.processIncomingStream(c, stream)
+			if err == protocol.ErrorWrongPacket {
+				m.callErrorHandler(c, channelError(c, "", &DecodeError{Err: err}))
+				if c.tolerateDecodeError() {
+					continue
+				}
+			}
+			if err != nil {
+				return closeChannel(c, m, err)
+			}
+			c.decodeFailures = 0
+			continue
+		}
+		if isChunkFrame(data) {
+			assembled, err := c.reassemble(data)
+			if err != nil {
+				m.callErrorHandler(c, channelError(c, "", err))
+				continue
+			}
+			if assembled == nil {
+				continue
+			}
+			data = assembled
+		}
+		if c.maxMessageSize > 0 && len(data) > c.maxMessageSize {
+			c.rejectMessage(ErrorMessageTooLarge)
+			m.callErrorHandler(c, channelError(c, "", ErrorMessageTooLarge))
+			continue
+		}
+		//data is reused by transport, decoded message keeps own copy
+		pkg := string(data)
+		c.debugPacket("in", pkg)
+		c.countReceived(len(data))
+		msg, err := c.decodePacket(conn, pkg)
+		if err == protocol.ErrorWrongMessageType && c.skipUnknownPackets {
+			c.logger.Debug("unknown packet skipped", "sid", c.Id(), "packet", pkg)
+			m.callErrorHandler(c, channelError(c, "", &UnknownPacketError{Packet: pkg}))
+			continue
+		}
 		if err != nil {
+			c.logger.Warn("wrong packet", "sid", c.Id(), "error", err)
+			m.callErrorHandler(c, channelError(c, "", &DecodeError{Err: err}))
+			if c.tolerateDecodeError() {
+				continue
+			}
 			closeChannel(c, m, protocol.ErrorWrongPacket)
 			return err
 		}
+		c.decodeFailures = 0
+		if msg.Type != protocol.MessageTypePing && msg.Type != protocol.MessageTypePong {
+			c.touchMessage()
+		}
+		if msg.Namespace != "" && c.namespaces != nil {
+			//message is released by namespace router
+			c.namespaces.process(c, msg)
+			continue
+		}
+		isNamespaceControl := msg.Type == protocol.MessageTypeEmpty ||
+			msg.Type == protocol.MessageTypeDisconnect
+		if isNamespaceControl && msg.Namespace != "" && c.server != nil && c.server.hasNamespaces() {
+			//events of namespaces are routed after checks and limits
+			c.server.processNamespacePacket(c, msg)
+			continue
+		}
 
 		switch msg.Type {
 		case protocol.MessageTypeOpen:
-			if err := json.Unmarshal([]byte(msg.Source[1:]), &c.header); err != nil {
+			if err := json.Unmarshal([]byte(msg.Args), &c.header); err != nil {
+				//both sentinel and json error are kept for errors.Is and errors.As
+				headerErr := fmt.Errorf("%w: %w", ErrorWrongHeader, err)
+				m.callErrorHandler(c, channelError(c, "", &DecodeError{Err: headerErr}))
 				closeChannel(c, m, ErrorWrongHeader)
 			}
+			c.applyPingParams(conn)
 			m.callLoopEvent(c, OnConnection)
+		case protocol.MessageTypeClose, protocol.MessageTypeDisconnect:
+			protocol.ReleaseMessage(msg)
+			if c.connectError != nil {
+				return closeChannel(c, m, c.connectError)
+			}
+			return closeChannel(c, m, ErrorRemoteClosed)
 		case protocol.MessageTypePing:
 			c.out <- protocol.PongMessage
 		case protocol.MessageTypePong:
+		case protocol.MessageTypeEmpty:
+			if c.server == nil {
+				c.connected = true
+			} else if err := c.server.processConnectPacket(c, msg); err != nil {
+				protocol.ReleaseMessage(msg)
+				return closeChannel(c, m, err)
+			}
+		case protocol.MessageTypeError:
+			m.processErrorPacket(c, msg)
 		default:
-			go m.processIncomingMessage(c, msg)
+			if !c.acceptsEvent(msg.Namespace) {
+				method := msg.Method
+				protocol.ReleaseMessage(msg)
+				m.callErrorHandler(c, channelError(c, method, ErrorNotConnected))
+				continue
+			}
+			method := msg.Method
+			if !c.allowInboundBytes(len(pkg)) {
+				protocol.ReleaseMessage(msg)
+				if limitCloses(c.inBandwidth) {
+					return closeChannel(c, m, ErrorBandwidthExceeded)
+				}
+				m.callErrorHandler(c, channelError(c, method, ErrorBandwidthExceeded))
+				continue
+			}
+			isEvent := msg.Type == protocol.MessageTypeEmit ||
+				msg.Type == protocol.MessageTypeAckRequest
+			if isEvent && !m.validEventName(c, msg.Method) {
+				protocol.ReleaseMessage(msg)
+				continue
+			}
+			if limiter := c.eventLimiter(); isEvent && limiter != nil && limiter.queue != nil {
+				if !c.queueIncoming(m, limiter, msg) {
+					protocol.ReleaseMessage(msg)
+					m.callErrorHandler(c, channelError(c, method, ErrorRateLimited))
+					continue
+				}
+				m.observeReceived(c)
+				continue
+			}
+			if isEvent && !c.allowIncoming() {
+				protocol.ReleaseMessage(msg)
+				if limitCloses(c.eventLimiter()) {
+					return closeChannel(c, m, ErrorRateLimited)
+				}
+				m.callErrorHandler(c, channelError(c, method, ErrorRateLimited))
+				continue
+			}
+			if isEvent {
+				m.observeReceived(c)
+				c.checkSequence(msg)
+			}
+			//message is released by processIncomingMessage
+			c.routeIncoming(m, msg)
+			continue
 		}
+		protocol.ReleaseMessage(msg)
 	}
 	return nil
 }
 
+/**
+Decode received packet, parser gets its frame type if both connection
+and parser support it
+*/
+func (c *Channel) decodePacket(conn transport.Connection, pkg string) (*protocol.Message, error) {
+	frameConn, ok := conn.(transport.FrameTypeConnection)
+	if !ok {
+		return c.parser.Decode(pkg)
+	}
+	frameParser, ok := c.parser.(protocol.FrameParser)
+	if !ok {
+		return c.parser.Decode(pkg)
+	}
+
+	return frameParser.DecodeFrame(pkg, frameConn.LastMessageBinary())
+}
+
+/**
+Count malformed packet, false if channel should be closed because of it.
+Called by inLoop only
+*/
+func (c *Channel) tolerateDecodeError() bool {
+	c.decodeFailures++
+	return c.decodeTolerance < 0 || c.decodeFailures <= c.decodeTolerance
+}
+
+/**
+Error passed to error handler for packets of unknown type,
+when they are skipped, see WithSkipUnknownPackets
+*/
+type UnknownPacketError struct {
+	Packet string
+}
+
+func (e *UnknownPacketError) Error() string {
+	return "Unknown packet type"
+}
+
+/**
+Use ping interval and timeout of server handshake for pings and read deadlines
+*/
+func (c *Channel) applyPingParams(conn transport.Connection) {
+	pingConn, ok := conn.(transport.PingParamsConnection)
+	if !ok || c.header.PingInterval <= 0 {
+		return
+	}
+
+	pingConn.SetPingParams(time.Duration(c.header.PingInterval)*time.Millisecond,
+		time.Duration(c.header.PingTimeout)*time.Millisecond)
+}
+
+/**
+Send socket.io error packet with error text to remote side
+*/
+func (c *Channel) rejectMessage(err error) {
+	send(&protocol.Message{Type: protocol.MessageTypeError}, c, err.Error())
+}
+
 var overflooded map[*Channel]struct{} = make(map[*Channel]struct{})
 var overfloodedLock sync.Mutex
 
@@ -153,11 +702,17 @@ func AmountOfOverflooded() int64 {
 outgoing messages loop, sends messages from channel to socket
 */
 func outLoop(c *Channel, m *methods) error {
+	if g := c.goroutines(); g != nil {
+		defer trackGoroutine(&g.outLoops)()
+	}
+
+	batch := make([]string, 0, maxWriteBatch)
 	for {
-		outBufferLen := len(c.out)
-		if outBufferLen >= queueBufferSize-1 {
+		outBufferLen, queueSize := len(c.out), cap(c.out)
+		if outBufferLen >= queueSize-1 && c.overflowPolicy == OverflowClose {
+			m.callErrorHandler(c, channelError(c, "", ErrorSocketOverflood))
 			return closeChannel(c, m, ErrorSocketOverflood)
-		} else if outBufferLen > int(queueBufferSize/2) {
+		} else if outBufferLen > int(queueSize/2) {
 			overfloodedLock.Lock()
 			overflooded[c] = struct{}{}
 			overfloodedLock.Unlock()
@@ -167,26 +722,283 @@ func outLoop(c *Channel, m *methods) error {
 			overfloodedLock.Unlock()
 		}
 
-		msg := <-c.out
-		if msg == protocol.CloseMessage {
-			return nil
+		m.observeQueueDepth(c, outBufferLen)
+		batch = append(batch[:0], <-c.out)
+		//queue is deep, take more messages to write them at once
+		for waiting := true; waiting && len(batch) < maxWriteBatch; {
+			select {
+			case msg := <-c.out:
+				batch = append(batch, msg)
+			default:
+				waiting = false
+			}
 		}
 
-		err := c.conn.WriteMessage(msg)
-		if err != nil {
+		//filtered in place, only messages to write are kept
+		pending := batch[:0]
+		for _, msg := range batch {
+			if msg == protocol.CloseMessage {
+				return nil
+			}
+			if msg == flushMarker {
+				if err := c.writePending(m, pending); err != nil {
+					return closeChannel(c, m, err)
+				}
+				pending = pending[:0]
+				c.markFlushed()
+				continue
+			}
+			if id, ok := parseWrittenMarker(msg); ok {
+				if err := c.writePending(m, pending); err != nil {
+					return closeChannel(c, m, err)
+				}
+				pending = pending[:0]
+				c.written.fire(id, nil)
+				continue
+			}
+			msg, compression := splitCompression(msg)
+			//engine.io control packets are small and keep connection alive
+			isControl := msg == protocol.PingMessage || msg == protocol.PongMessage
+			if !isControl && !c.allowOutboundBytes(len(msg)) {
+				if limitCloses(c.outBandwidth) {
+					return closeChannel(c, m, ErrorBandwidthExceeded)
+				}
+				m.callErrorHandler(c, channelError(c, "", ErrorBandwidthExceeded))
+				continue
+			}
+			if compression != transport.CompressionDefault {
+				//packet with own compression is written separately
+				if err := c.writePending(m, pending); err != nil {
+					return closeChannel(c, m, err)
+				}
+				pending = pending[:0]
+				c.setWriteCompression(compression)
+				err := c.writePending(m, []string{msg})
+				c.setWriteCompression(transport.CompressionDefault)
+				if err != nil {
+					return closeChannel(c, m, err)
+				}
+				continue
+			}
+			pending = append(pending, msg)
+			if c.kicked(msg) != nil {
+				//nothing is written after disconnect packet
+				break
+			}
+		}
+
+		if err := c.writePending(m, pending); err != nil {
 			return closeChannel(c, m, err)
 		}
 	}
 	return nil
 }
 
+/**
+Transform and write packets taken from queue, returns kick reason
+if one of them is disconnect packet
+*/
+func (c *Channel) writePending(m *methods, pending []string) error {
+	msgs := c.transformOutgoing(m, pending)
+	if sent, err := c.writeBatch(msgs); err != nil {
+		c.callWriteErrorHooks(err, msgs[sent:])
+		return err
+	}
+	m.observeSent(c, pending)
+
+	return c.kickedBy(pending)
+}
+
+/**
+Write packets to socket, all at once if transport supports it.
+Returns amount of written packets
+*/
+func (c *Channel) writeBatch(msgs []string) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	for _, msg := range msgs {
+		c.debugPacket("out", msg)
+	}
+	c.countSent(msgs)
+
+	conn := c.connection()
+	batchConn, ok := conn.(transport.BatchConnection)
+	if !ok || len(msgs) == 1 {
+		for i, msg := range msgs {
+			if err := c.writeOne(msg); err != nil {
+				return i, err
+			}
+		}
+		return len(msgs), nil
+	}
+
+	binary := make([]bool, len(msgs))
+	for i, msg := range msgs {
+		binary[i] = c.parser.IsBinary(msg)
+	}
+	sent, err := batchConn.WriteMessages(msgs, binary, c.dataWriteTimeout)
+	if err != nil && c.connection() != conn {
+		//transport was upgraded while writing, send the rest with the new one
+		rest, err := c.writeBatch(msgs[sent:])
+		return sent + rest, err
+	}
+
+	return sent, err
+}
+
+/**
+Write one packet to socket
+*/
+func (c *Channel) writeOne(msg string) error {
+	conn := c.connection()
+	err := writePacket(c, conn, msg)
+	if err != nil && c.connection() != conn {
+		//transport was upgraded while writing, retry with the new one
+		err = writePacket(c, c.connection(), msg)
+	}
+
+	return err
+}
+
+/**
+Check that one of sent packets is disconnect one, queued by Channel.Kick
+*/
+func (c *Channel) kickedBy(msgs []string) error {
+	for _, msg := range msgs {
+		if reason := c.kicked(msg); reason != nil {
+			return reason
+		}
+	}
+
+	return nil
+}
+
+/**
+Check that sent packet is disconnect one, queued by Channel.Kick
+*/
+func (c *Channel) kicked(msg string) error {
+	c.disconnectReasonLock.RLock()
+	defer c.disconnectReasonLock.RUnlock()
+
+	if c.kickReason == nil {
+		return nil
+	}
+
+	decoded, err := c.parser.Decode(msg)
+	if err != nil {
+		return nil
+	}
+	defer protocol.ReleaseMessage(decoded)
+	if decoded.Type != protocol.MessageTypeDisconnect {
+		return nil
+	}
+
+	return c.kickReason
+}
+
+/**
+Get write timeout of packet, zero means transport default one
+*/
+func (c *Channel) writeTimeout(msg string) time.Duration {
+	switch msg {
+	case protocol.PingMessage, protocol.PongMessage, protocol.CloseMessage:
+		return c.controlWriteTimeout
+	}
+
+	return c.dataWriteTimeout
+}
+
+/**
+Write packet to socket, using binary frame if parser requires it
+*/
+func writePacket(c *Channel, conn transport.Connection, msg string) error {
+	timeout := c.writeTimeout(msg)
+	if timeoutConn, ok := conn.(transport.TimeoutConnection); ok && timeout > 0 {
+		return timeoutConn.WriteMessageTimeout(msg, c.parser.IsBinary(msg), timeout)
+	}
+
+	if !c.parser.IsBinary(msg) {
+		return conn.WriteMessage(msg)
+	}
+
+	binaryConn, ok := conn.(transport.BinaryConnection)
+	if !ok {
+		return ErrorBinaryNotSupported
+	}
+
+	return binaryConn.WriteBinaryMessage(msg)
+}
+
+/**
+Log raw packet if packet debug is enabled, payload is truncated
+*/
+func (c *Channel) debugPacket(direction, packet string) {
+	if c.packetDebug <= 0 {
+		return
+	}
+	if len(packet) > c.packetDebug {
+		packet = packet[:c.packetDebug] + "..."
+	}
+
+	c.logger.Info("packet", "sid", c.Id(), "dir", direction, "data", strconv.Quote(packet))
+}
+
+/**
+Remember time of last incoming packet
+*/
+func (c *Channel) touch() {
+	c.lastActivityLock.Lock()
+	c.lastActivity = time.Now()
+	c.lastActivityLock.Unlock()
+}
+
+/**
+Get time passed since last incoming packet
+*/
+func (c *Channel) idle() time.Duration {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return time.Since(c.lastActivity)
+}
+
+/**
+Watchdog closes channel with ErrorPingTimeout if nothing, including pings,
+is received from remote side for ping interval plus ping timeout
+*/
+func watchdog(c *Channel, m *methods) {
+	ctx := c.Context()
+	for {
+		interval, timeout := c.connection().PingParams()
+		if interval+timeout <= 0 {
+			return
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+		if c.idle() > interval+timeout {
+			closeChannel(c, m, ErrorPingTimeout)
+			return
+		}
+	}
+}
+
 /**
 Pinger sends ping messages for keeping connection alive
 */
 func pinger(c *Channel) {
+	ctx := c.Context()
 	for {
-		interval, _ := c.conn.PingParams()
-		time.Sleep(interval)
+		interval, _ := c.connection().PingParams()
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
 		if !c.IsAlive() {
 			return
 		}
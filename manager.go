@@ -0,0 +1,345 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorDefaultNamespace = errors.New("Default namespace is served by manager client")
+	ErrorSocketClosed     = errors.New("Socket closed")
+)
+
+/**
+Client side owner of one physical connection, which is shared by sockets
+of several namespaces, like Manager of js client. Default namespace is served
+by Client, other ones by sockets returned from Socket
+*/
+type Manager struct {
+	client *Client
+	router *namespaceRouter
+}
+
+/**
+Connect to server, see Dial. Options are applied to the shared connection
+*/
+func NewManager(url string, tr transport.Transport, opts ...DialOption) (*Manager, error) {
+	router := &namespaceRouter{sockets: make(map[string]*NamespaceSocket)}
+	opts = append(opts, func(c *Client) {
+		c.Channel.namespaces = router
+	})
+
+	client, err := Dial(url, tr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{client: client, router: router}, nil
+}
+
+/**
+Get client of default namespace, its connection is shared by all sockets
+*/
+func (m *Manager) Client() *Client {
+	return m.client
+}
+
+/**
+Get socket of given namespace, e.g. "/chat". Socket is created and connect
+packet is sent on the first call, the same socket is returned later until
+it is closed. Handlers should be added before connection is acknowledged,
+see OnConnection
+*/
+func (m *Manager) Socket(namespace string) (*NamespaceSocket, error) {
+	namespace = namespaceName(namespace)
+	if namespace == "/" {
+		return nil, ErrorDefaultNamespace
+	}
+
+	m.router.lock.Lock()
+	defer m.router.lock.Unlock()
+
+	if s, ok := m.router.sockets[namespace]; ok {
+		return s, nil
+	}
+
+	s := &NamespaceSocket{manager: m, namespace: namespace}
+	s.initMethods()
+	s.methods.namespace = namespace
+	s.methods.logger = m.client.methods.logger
+	s.methods.serializers = m.client.methods.serializers
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	m.router.sockets[namespace] = s
+
+	return s, nil
+}
+
+/**
+Close all sockets and the shared connection
+*/
+func (m *Manager) Close() {
+	m.client.Close()
+}
+
+/**
+Socket of one namespace, sharing connection of Manager. Handlers are added
+with On, they receive *Channel of the shared connection
+*/
+type NamespaceSocket struct {
+	methods
+
+	manager   *Manager
+	namespace string
+
+	connected    bool
+	closed       bool
+	connectError *ConnectError
+	lock         sync.Mutex
+}
+
+/**
+Get namespace of socket
+*/
+func (s *NamespaceSocket) Namespace() string {
+	return s.namespace
+}
+
+/**
+Check that server acknowledged connection to namespace
+*/
+func (s *NamespaceSocket) Connected() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.connected
+}
+
+/**
+Get rejection of namespace connection sent by server, if any
+*/
+func (s *NamespaceSocket) ConnectError() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.connectError == nil {
+		return nil
+	}
+	return s.connectError
+}
+
+/**
+Send event to namespace, see Channel.Emit
+*/
+func (s *NamespaceSocket) Emit(method string, args ...interface{}) error {
+	return s.EmitContext(context.Background(), method, args...)
+}
+
+/**
+Same as Emit, but waits for room in outgoing queue until given context is done
+*/
+func (s *NamespaceSocket) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	if s.isClosed() {
+		return ErrorSocketClosed
+	}
+	c := &s.manager.client.Channel
+	if !c.canSend() {
+		return ErrorChannelClosed
+	}
+
+	return c.emitNamespace(ctx, s.namespace, method, args)
+}
+
+/**
+Send ack request to namespace and wait for response, see Channel.Ack
+*/
+func (s *NamespaceSocket) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := s.AckContext(ctx, method, args)
+	if err == context.DeadlineExceeded {
+		return "", ErrorSendTimeout
+	}
+
+	return result, err
+}
+
+/**
+Same as Ack, but waits for room in outgoing queue and for response
+until given context is done
+*/
+func (s *NamespaceSocket) AckContext(ctx context.Context, method string, args interface{}) (string, error) {
+	if s.isClosed() {
+		return "", ErrorSocketClosed
+	}
+
+	return s.manager.client.Channel.ackNamespace(ctx, s.namespace, method, args)
+}
+
+/**
+Leave namespace, shared connection is kept open
+*/
+func (s *NamespaceSocket) Close() {
+	router := s.manager.router
+	router.lock.Lock()
+	if router.sockets[s.namespace] == s {
+		delete(router.sockets, s.namespace)
+	}
+	router.lock.Unlock()
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	wasConnected := s.connected
+	s.connected = false
+	s.lock.Unlock()
+
+	c := &s.manager.client.Channel
+	send(&protocol.Message{Type: protocol.MessageTypeDisconnect, Namespace: s.namespace}, c, nil)
+	if wasConnected {
+		s.callLoopEvent(c, OnDisconnection)
+	}
+}
+
+func (s *NamespaceSocket) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed
+}
+
+/**
+Queue connect packet of namespace, with auth payload of client if it is set
+*/
+func (s *NamespaceSocket) connect() error {
+	client := s.manager.client
+	msg := &protocol.Message{Type: protocol.MessageTypeEmpty, Namespace: s.namespace}
+	if client.authData != nil {
+		payload, err := client.parser.Marshal(client.authData)
+		if err != nil {
+			return err
+		}
+		msg.Args = payload
+	}
+
+	return send(msg, &client.Channel, nil)
+}
+
+/**
+Process packet of namespace socket, e.g. connection acknowledge or event
+*/
+func (s *NamespaceSocket) process(c *Channel, msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.MessageTypeEmpty:
+		s.lock.Lock()
+		s.connected = true
+		s.connectError = nil
+		s.lock.Unlock()
+		protocol.ReleaseMessage(msg)
+		go s.callLoopEvent(c, OnConnection)
+	case protocol.MessageTypeDisconnect:
+		//server made socket leave namespace
+		s.setDisconnected(c)
+		protocol.ReleaseMessage(msg)
+	case protocol.MessageTypeError:
+		reason := &ConnectError{}
+		if err := c.parser.Unmarshal(msg.Args, reason); err != nil {
+			reason.Message = msg.Args
+		}
+		s.lock.Lock()
+		s.connectError = reason
+		s.lock.Unlock()
+		go s.callErrorEvent(c, OnConnectError, msg.Args)
+		protocol.ReleaseMessage(msg)
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest, protocol.MessageTypeAckResponse:
+		//message is released by processIncomingMessage
+		c.dispatchIncoming(&s.methods, msg)
+	default:
+		protocol.ReleaseMessage(msg)
+	}
+}
+
+/**
+Mark socket disconnected and call its disconnection handler once
+*/
+func (s *NamespaceSocket) setDisconnected(c *Channel) {
+	s.lock.Lock()
+	wasConnected := s.connected
+	s.connected = false
+	s.lock.Unlock()
+
+	if wasConnected {
+		go s.callLoopEvent(c, OnDisconnection)
+	}
+}
+
+/**
+Namespace sockets of one client connection
+*/
+type namespaceRouter struct {
+	sockets map[string]*NamespaceSocket
+	lock    sync.Mutex
+}
+
+func (r *namespaceRouter) get(namespace string) (*NamespaceSocket, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.sockets[namespace]
+	return s, ok
+}
+
+func (r *namespaceRouter) all() []*NamespaceSocket {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result := make([]*NamespaceSocket, 0, len(r.sockets))
+	for _, s := range r.sockets {
+		result = append(result, s)
+	}
+	return result
+}
+
+/**
+Pass incoming packet to socket of its namespace, packets of unknown
+namespaces are dropped
+*/
+func (r *namespaceRouter) process(c *Channel, msg *protocol.Message) {
+	s, ok := r.get(msg.Namespace)
+	if !ok {
+		c.logger.Debug("packet of unknown namespace dropped", "sid", c.Id(), "namespace", msg.Namespace)
+		protocol.ReleaseMessage(msg)
+		return
+	}
+
+	s.process(c, msg)
+}
+
+/**
+Mark all sockets disconnected, when shared connection is closed
+*/
+func (r *namespaceRouter) disconnectAll(c *Channel) {
+	for _, s := range r.all() {
+		s.setDisconnected(c)
+	}
+}
+
+/**
+Connect all sockets again, after shared connection is restored
+*/
+func (r *namespaceRouter) connectAll(c *Channel) {
+	for _, s := range r.all() {
+		if err := s.connect(); err != nil {
+			c.logger.Warn("namespace connect failed", "namespace", s.namespace, "error", err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package gosocketio
+
+/**
+Metrics receives server events for monitoring, see metrics/prometheus
+for prometheus collector. Methods are called right from processing
+goroutines, so they should not block
+*/
+type Metrics interface {
+	/**
+	Called once by NewServer, before any connection is accepted
+	*/
+	Init(s *Server)
+
+	/**
+	Incoming event or ack request accepted for processing
+	*/
+	MessageReceived(c *Channel)
+
+	/**
+	Given amount of packets written to socket
+	*/
+	MessagesSent(c *Channel, n int)
+
+	/**
+	Amount of packets waiting in outgoing queue of channel before write
+	*/
+	QueueDepth(c *Channel, depth int)
+
+	/**
+	Broadcast to room, or to all channels if room is empty,
+	sent to given amount of local channels
+	*/
+	Broadcast(room string, recipients int)
+
+	/**
+	Error passed to error handler, e.g. *ChannelError wrapping ErrorRateLimited,
+	or handler error
+	*/
+	Error(c *Channel, err error)
+}
+
+/**
+Optional extension of Metrics receiving connection lifecycle events
+*/
+type ConnectionMetrics interface {
+	ConnectionOpened(c *Channel)
+	ConnectionClosed(c *Channel, reason error)
+}
+
+/**
+Optional extension of Metrics receiving outgoing messages dropped before
+they are written, e.g. ErrorSocketOverflood or ErrorBroadcastSkipped
+*/
+type DropMetrics interface {
+	MessageDropped(c *Channel, reason error)
+}
+
+/**
+Subscribe metrics implementing ConnectionMetrics to connection events
+*/
+func (s *Server) initConnectionMetrics() {
+	cm, ok := s.metrics.(ConnectionMetrics)
+	if !ok {
+		return
+	}
+
+	s.addConnectHook(cm.ConnectionOpened)
+	s.addDisconnectHook(func(c *Channel) {
+		cm.ConnectionClosed(c, c.DisconnectReason())
+	})
+}
+
+/**
+Pass outgoing message drop to server metrics implementing DropMetrics
+*/
+func (c *Channel) observeDropped(reason error) {
+	if c.server == nil {
+		return
+	}
+	if dm, ok := c.server.metrics.(DropMetrics); ok {
+		dm.MessageDropped(c, reason)
+	}
+}
+
+func (m *methods) observeReceived(c *Channel) {
+	if m.metrics != nil {
+		m.metrics.MessageReceived(c)
+	}
+}
+
+func (m *methods) observeSent(c *Channel, msgs []string) {
+	if m.metrics != nil && len(msgs) > 0 {
+		m.metrics.MessagesSent(c, len(msgs))
+	}
+	m.observeEmits(c, msgs)
+}
+
+func (m *methods) observeQueueDepth(c *Channel, depth int) {
+	if m.metrics != nil {
+		m.metrics.QueueDepth(c, depth)
+	}
+}
+
+func (s *Server) observeBroadcast(room string, recipients int) {
+	if s.metrics != nil {
+		s.metrics.Broadcast(room, recipients)
+	}
+}
+
+/**
+Several metrics receiving the same events
+*/
+type multiMetrics []Metrics
+
+func (mm multiMetrics) Init(s *Server) {
+	for _, m := range mm {
+		m.Init(s)
+	}
+}
+
+func (mm multiMetrics) MessageReceived(c *Channel) {
+	for _, m := range mm {
+		m.MessageReceived(c)
+	}
+}
+
+func (mm multiMetrics) MessagesSent(c *Channel, n int) {
+	for _, m := range mm {
+		m.MessagesSent(c, n)
+	}
+}
+
+func (mm multiMetrics) QueueDepth(c *Channel, depth int) {
+	for _, m := range mm {
+		m.QueueDepth(c, depth)
+	}
+}
+
+func (mm multiMetrics) Broadcast(room string, recipients int) {
+	for _, m := range mm {
+		m.Broadcast(room, recipients)
+	}
+}
+
+func (mm multiMetrics) Error(c *Channel, err error) {
+	for _, m := range mm {
+		m.Error(c, err)
+	}
+}
+
+func (mm multiMetrics) ConnectionOpened(c *Channel) {
+	for _, m := range mm {
+		if cm, ok := m.(ConnectionMetrics); ok {
+			cm.ConnectionOpened(c)
+		}
+	}
+}
+
+func (mm multiMetrics) ConnectionClosed(c *Channel, reason error) {
+	for _, m := range mm {
+		if cm, ok := m.(ConnectionMetrics); ok {
+			cm.ConnectionClosed(c, reason)
+		}
+	}
+}
+
+func (mm multiMetrics) MessageDropped(c *Channel, reason error) {
+	for _, m := range mm {
+		if dm, ok := m.(DropMetrics); ok {
+			dm.MessageDropped(c, reason)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package prometheus
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultNamespace = "socketio"
+)
+
+/**
+Prometheus collector of socket.io server metrics, pass it to server
+with gosocketio.WithMetrics and register it with prometheus registry
+*/
+type Collector struct {
+	server *gosocketio.Server
+
+	connections    prom.GaugeFunc
+	rooms          prom.GaugeFunc
+	messagesIn     prom.Counter
+	messagesOut    prom.Counter
+	broadcastFan   prom.Histogram
+	queueDepth     prom.Histogram
+	rateLimitDrops *prom.CounterVec
+	errors         prom.Counter
+	opened         prom.Counter
+	closed         prom.Counter
+	dropped        prom.Counter
+}
+
+/**
+Create collector, metric names are prefixed with given namespace
+*/
+func NewCollector(namespace string) *Collector {
+	c := &Collector{}
+
+	c.connections = prom.NewGaugeFunc(prom.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections",
+		Help:      "Amount of connected channels",
+	}, func() float64 {
+		if c.server == nil {
+			return 0
+		}
+		return float64(c.server.AmountOfSids())
+	})
+	c.rooms = prom.NewGaugeFunc(prom.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rooms",
+		Help:      "Amount of rooms with at least one channel joined",
+	}, func() float64 {
+		if c.server == nil {
+			return 0
+		}
+		return float64(c.server.AmountOfRooms())
+	})
+	c.messagesIn = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Incoming events and ack requests accepted for processing",
+	})
+	c.messagesOut = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Packets written to sockets",
+	})
+	c.broadcastFan = prom.NewHistogram(prom.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_recipients",
+		Help:      "Amount of local channels receiving one broadcast",
+		Buckets:   prom.ExponentialBuckets(1, 4, 8),
+	})
+	c.queueDepth = prom.NewHistogram(prom.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Packets waiting in outgoing queue of channel before write",
+		Buckets:   prom.ExponentialBuckets(1, 2, 10),
+	})
+	c.rateLimitDrops = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_drops_total",
+		Help:      "Events and packets dropped by rate and bandwidth limits",
+	}, []string{"limit"})
+	c.errors = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Handler and processing errors, except rate limit drops",
+	})
+	c.opened = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_opened_total",
+		Help:      "Channels connected",
+	})
+	c.closed = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_closed_total",
+		Help:      "Channels disconnected",
+	})
+	c.dropped = prom.NewCounter(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dropped_total",
+		Help:      "Outgoing messages dropped before write, e.g. on queue overflow",
+	})
+
+	return c
+}
+
+func (c *Collector) collectors() []prom.Collector {
+	return []prom.Collector{
+		c.connections,
+		c.rooms,
+		c.messagesIn,
+		c.messagesOut,
+		c.broadcastFan,
+		c.queueDepth,
+		c.rateLimitDrops,
+		c.errors,
+		c.opened,
+		c.closed,
+		c.dropped,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (c *Collector) Init(s *gosocketio.Server) {
+	c.server = s
+}
+
+func (c *Collector) MessageReceived(*gosocketio.Channel) {
+	c.messagesIn.Inc()
+}
+
+func (c *Collector) MessagesSent(_ *gosocketio.Channel, n int) {
+	c.messagesOut.Add(float64(n))
+}
+
+func (c *Collector) QueueDepth(_ *gosocketio.Channel, depth int) {
+	c.queueDepth.Observe(float64(depth))
+}
+
+func (c *Collector) Broadcast(_ string, recipients int) {
+	c.broadcastFan.Observe(float64(recipients))
+}
+
+func (c *Collector) Error(_ *gosocketio.Channel, err error) {
+	switch {
+	case errors.Is(err, gosocketio.ErrorRateLimited):
+		c.rateLimitDrops.WithLabelValues("events").Inc()
+	case errors.Is(err, gosocketio.ErrorBandwidthExceeded):
+		c.rateLimitDrops.WithLabelValues("bandwidth").Inc()
+	default:
+		c.errors.Inc()
+	}
+}
+
+func (c *Collector) ConnectionOpened(*gosocketio.Channel) {
+	c.opened.Inc()
+}
+
+func (c *Collector) ConnectionClosed(*gosocketio.Channel, error) {
+	c.closed.Inc()
+}
+
+func (c *Collector) MessageDropped(*gosocketio.Channel, error) {
+	c.dropped.Inc()
+}
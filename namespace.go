@@ -0,0 +1,322 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorInvalidNamespace = errors.New("Invalid namespace")
+)
+
+/**
+Server namespace other than default one, with own event handlers.
+Handlers receive *Channel of the connection that joined namespace,
+replies of ack handlers are sent to namespace
+*/
+type Namespace struct {
+	methods
+
+	name string
+
+	//created by pattern, removed when the last channel leaves it
+	dynamic bool
+	//joined channels, guarded by namespaces lock of server
+	members int
+}
+
+/**
+Configure namespace created for the first connection to namespace
+matching pattern, see OfPattern. Returned error rejects connection
+*/
+type NamespaceFactory func(n *Namespace) error
+
+/**
+Get namespace name, e.g. "/chat"
+*/
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+/**
+Send event to channel that joined namespace
+*/
+func (n *Namespace) Emit(c *Channel, method string, args ...interface{}) error {
+	if !c.canSend() {
+		return ErrorChannelClosed
+	}
+
+	return c.emitNamespace(context.Background(), n.name, method, args)
+}
+
+type namespacePattern struct {
+	expr    *regexp.Regexp
+	factory NamespaceFactory
+}
+
+/**
+Namespaces of server, created by name or by pattern on first connection
+*/
+type namespaceRegistry struct {
+	namespaces map[string]*Namespace
+	patterns   []namespacePattern
+	hookOnce   sync.Once
+	lock       sync.Mutex
+}
+
+/**
+Get namespace by name, e.g. "/chat", it is created on the first call.
+Default namespace is served by server itself
+*/
+func (s *Server) Of(name string) *Namespace {
+	name = namespaceName(name)
+	s.initNamespaces()
+
+	s.namespaces.lock.Lock()
+	defer s.namespaces.lock.Unlock()
+
+	n, ok := s.namespaces.namespaces[name]
+	if !ok {
+		n = s.newNamespace(name)
+		s.namespaces.namespaces[name] = n
+	}
+	return n
+}
+
+/**
+Create namespaces by regular expression, e.g. `/game-\d+`, matching whole
+namespace name. Factory is called on the first connection to each
+matching namespace, so per-match namespaces need no pre-creation.
+Namespace is removed when its last channel leaves, the next connection
+creates it again.
+Patterns are tried in the order they were added, after namespaces of Of.
+Factory is called under namespaces lock, so it must not call Of
+*/
+func (s *Server) OfPattern(pattern string, f NamespaceFactory) error {
+	expr, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return err
+	}
+	s.initNamespaces()
+
+	s.namespaces.lock.Lock()
+	defer s.namespaces.lock.Unlock()
+
+	s.namespaces.patterns = append(s.namespaces.patterns, namespacePattern{expr: expr, factory: f})
+	return nil
+}
+
+func (s *Server) initNamespaces() {
+	s.namespaces.hookOnce.Do(func() {
+		s.namespaces.lock.Lock()
+		s.namespaces.namespaces = make(map[string]*Namespace)
+		s.namespaces.lock.Unlock()
+		s.addDisconnectHook(leaveNamespaces)
+	})
+}
+
+func (s *Server) newNamespace(name string) *Namespace {
+	n := &Namespace{name: name}
+	n.initMethods()
+	n.methods.namespace = name
+	n.methods.logger = s.methods.logger
+	n.methods.serializers = s.methods.serializers
+	return n
+}
+
+/**
+Find namespace by name or create it by the first matching pattern.
+Namespace is counted as joined, see releaseNamespace
+*/
+func (s *Server) acquireNamespace(name string) (*Namespace, error) {
+	s.namespaces.lock.Lock()
+	defer s.namespaces.lock.Unlock()
+
+	if n, ok := s.namespaces.namespaces[name]; ok {
+		n.members++
+		return n, nil
+	}
+	for _, p := range s.namespaces.patterns {
+		if !p.expr.MatchString(name) {
+			continue
+		}
+
+		n := s.newNamespace(name)
+		if err := p.factory(n); err != nil {
+			return nil, err
+		}
+		n.dynamic = true
+		n.members = 1
+		s.namespaces.namespaces[name] = n
+		return n, nil
+	}
+
+	return nil, ErrorInvalidNamespace
+}
+
+/**
+Count namespace as left, namespace created by pattern is removed
+when it has no channels left
+*/
+func (s *Server) releaseNamespace(n *Namespace) {
+	s.namespaces.lock.Lock()
+	defer s.namespaces.lock.Unlock()
+
+	n.members--
+	if n.dynamic && n.members <= 0 && s.namespaces.namespaces[n.name] == n {
+		delete(s.namespaces.namespaces, n.name)
+	}
+}
+
+/**
+Check that server has namespaces besides default one
+*/
+func (s *Server) hasNamespaces() bool {
+	s.namespaces.lock.Lock()
+	defer s.namespaces.lock.Unlock()
+
+	return s.namespaces.namespaces != nil
+}
+
+/**
+Process packet of custom namespace: connect, disconnect or event
+of namespace joined by channel
+*/
+func (s *Server) processNamespacePacket(c *Channel, msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.MessageTypeEmpty:
+		name, payload := msg.Namespace, msg.Args
+		protocol.ReleaseMessage(msg)
+		if s.authorizeConnect(c, name, payload) != nil {
+			return
+		}
+		n, err := s.acquireNamespace(name)
+		if err != nil {
+			reason, ok := err.(*ConnectError)
+			if !ok {
+				reason = &ConnectError{Message: err.Error()}
+			}
+			send(&protocol.Message{Type: protocol.MessageTypeError, Namespace: name}, c, reason)
+			return
+		}
+		if !c.joinNamespace(n) {
+			s.releaseNamespace(n)
+			return
+		}
+		c.stopConnectTimeout()
+
+		reply := &protocol.Message{Type: protocol.MessageTypeEmpty, Namespace: name}
+		if c.protocolVersion < transport.ProtocolV4 {
+			send(reply, c, nil)
+		} else {
+			send(reply, c, &connectReply{Sid: c.Id()})
+		}
+		go n.callLoopEvent(c, OnConnection)
+	case protocol.MessageTypeDisconnect:
+		n, ok := c.leaveNamespace(msg.Namespace)
+		protocol.ReleaseMessage(msg)
+		if ok {
+			s.releaseNamespace(n)
+			go n.callLoopEvent(c, OnDisconnection)
+		}
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest, protocol.MessageTypeAckResponse:
+		n, ok := c.joinedNamespace(msg.Namespace)
+		if !ok {
+			protocol.ReleaseMessage(msg)
+			return
+		}
+		//message is released by processIncomingMessage
+		c.dispatchIncoming(&n.methods, msg)
+	default:
+		protocol.ReleaseMessage(msg)
+	}
+}
+
+/**
+Dispatch incoming event or ack which passed channel checks and limits.
+Packets of custom namespaces go to joined namespace, other ones
+are processed by given methods
+*/
+func (c *Channel) routeIncoming(m *methods, msg *protocol.Message) {
+	if msg.Namespace != "" && c.server != nil && c.server.hasNamespaces() {
+		c.server.processNamespacePacket(c, msg)
+		return
+	}
+
+	c.dispatchIncoming(m, msg)
+}
+
+/**
+Add namespace to joined ones, false if it is already joined
+*/
+func (c *Channel) joinNamespace(n *Namespace) bool {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	if _, ok := c.joined[n.name]; ok {
+		return false
+	}
+	if c.joined == nil {
+		c.joined = make(map[string]*Namespace)
+	}
+	c.joined[n.name] = n
+	return true
+}
+
+func (c *Channel) leaveNamespace(name string) (*Namespace, bool) {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	n, ok := c.joined[name]
+	delete(c.joined, name)
+	return n, ok
+}
+
+func (c *Channel) joinedNamespace(name string) (*Namespace, bool) {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	n, ok := c.joined[name]
+	return n, ok
+}
+
+/**
+Get names of custom namespaces joined by server channel
+*/
+func (c *Channel) Namespaces() []string {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	result := make([]string, 0, len(c.joined))
+	for name := range c.joined {
+		result = append(result, name)
+	}
+	return result
+}
+
+/**
+Disconnection hook, call disconnection handlers of joined namespaces
+*/
+func leaveNamespaces(c *Channel) {
+	c.joinedLock.Lock()
+	joined := c.joined
+	c.joined = nil
+	c.joinedLock.Unlock()
+
+	for _, n := range joined {
+		c.server.releaseNamespace(n)
+		n.callLoopEvent(c, OnDisconnection)
+	}
+}
+
+func namespaceName(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return "/" + name
+	}
+	return name
+}
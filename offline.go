@@ -0,0 +1,83 @@
+package gosocketio
+
+import (
+	"sync"
+)
+
+/**
+Event emitted while client was disconnected
+*/
+type offlineEvent struct {
+	method string
+	args   []interface{}
+}
+
+/**
+Bounded queue of events emitted while client is reconnecting,
+they are sent after connection is restored
+*/
+type offlineBuffer struct {
+	events   []offlineEvent
+	size     int
+	policy   OverflowPolicy
+	disabled bool
+	lock     sync.Mutex
+}
+
+/**
+Queue event, returns ErrorChannelClosed if client will not be reconnected
+and ErrorSocketOverflood if buffer is full and event is dropped
+*/
+func (b *offlineBuffer) push(method string, args []interface{}) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.disabled {
+		return ErrorChannelClosed
+	}
+	if len(b.events) >= b.size {
+		if b.policy != OverflowDropOldest || b.size == 0 {
+			return ErrorSocketOverflood
+		}
+		b.events = b.events[1:]
+	}
+
+	b.events = append(b.events, offlineEvent{method: method, args: args})
+	return nil
+}
+
+/**
+Take all queued events
+*/
+func (b *offlineBuffer) take() []offlineEvent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	events := b.events
+	b.events = nil
+	return events
+}
+
+/**
+Drop queued events, nothing is queued after that
+*/
+func (b *offlineBuffer) disable() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.events = nil
+	b.disabled = true
+}
+
+/**
+Send events queued while client was disconnected
+*/
+func (c *Channel) flushOffline() {
+	if c.offline == nil {
+		return
+	}
+
+	for _, event := range c.offline.take() {
+		c.Emit(event.method, event.args...)
+	}
+}
@@ -0,0 +1,861 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"time"
+)
+
+/**
+Server configuration function, can be passed to NewServer
+*/
+type ServerOption func(s *Server)
+
+/**
+Client configuration function, can be passed to Dial
+*/
+type DialOption func(c *Client)
+
+/**
+Set packet format used by server, e.g. protocol.MsgpackParser{}
+*/
+func WithParser(p protocol.Parser) ServerOption {
+	return func(s *Server) {
+		s.parser = p
+	}
+}
+
+/**
+Set json encoder and decoder of event and ack arguments used by default
+json parser, e.g. jsoniter.ConfigCompatibleWithStandardLibrary
+*/
+func WithSerializer(serializer protocol.Serializer) ServerOption {
+	return WithParser(protocol.JsonParser{Serializer: serializer})
+}
+
+/**
+Set adapter to share broadcasts between several server instances
+*/
+func WithAdapter(a Adapter) ServerOption {
+	return func(s *Server) {
+		s.adapter = a
+	}
+}
+
+/**
+Set handshake authentication function, called for every new connection
+*/
+func WithAuthHandler(f AuthHandler) ServerOption {
+	return func(s *Server) {
+		s.authHandler = f
+	}
+}
+
+/**
+Set origin checking function, all origins are allowed by default.
+Cross-origin requests with credentials are allowed for accepted origins
+*/
+func WithCheckOrigin(f CheckOriginFunc) ServerOption {
+	return func(s *Server) {
+		s.originChecker = f
+		s.anyOrigin = false
+	}
+}
+
+/**
+Allow connections only from given origins, see AllowedOrigins.
+Cross-origin requests with credentials are allowed for listed origins,
+"*" allows any origin without credentials
+*/
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.originChecker = AllowedOrigins(origins...)
+		s.anyOrigin = false
+		for _, origin := range origins {
+			if origin == "*" {
+				s.anyOrigin = true
+			}
+		}
+	}
+}
+
+/**
+Set function receiving errors returned by handlers and processing errors
+*/
+func WithErrorHandler(f ErrorHandler) ServerOption {
+	return func(s *Server) {
+		s.errorHandler = f
+	}
+}
+
+/**
+Set function receiving panics of handlers and middlewares, panics
+are always recovered, logged and passed to error handler as *PanicError
+*/
+func WithRecoveryHandler(f RecoveryHandler) ServerOption {
+	return func(s *Server) {
+		s.recoveryHandler = f
+	}
+}
+
+/**
+Limit running time of event handlers. Context passed to handlers
+with context argument is cancelled after timeout, handlers still running
+are reported to error handler with *HandlerTimeoutError
+*/
+func WithHandlerTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.handlerTimeout = timeout
+	}
+}
+
+/**
+Send errors returned by handlers back to client, so it does not wait
+for response of failed request. Ack request receives *EventError as ack
+response, emit is followed by OnEventError event with *EventError
+*/
+func WithEventErrorReplies() ServerOption {
+	return func(s *Server) {
+		s.replyErrors = true
+	}
+}
+
+/**
+Validate names of incoming events before handler lookup, events with
+invalid names are dropped. First of them is passed to error handler
+as *InvalidEventError, following ones of the same channel are dropped
+silently. See ValidateEventNames
+*/
+func WithEventNameValidator(f EventNameValidator) ServerOption {
+	return func(s *Server) {
+		s.eventNameValidator = f
+	}
+}
+
+/**
+Send reconnect hint to connected clients on Drain and Shutdown,
+Go clients with reconnect policy reconnect as hint says
+*/
+func WithReconnectHint(hint ReconnectHint) ServerOption {
+	return func(s *Server) {
+		s.reconnectHint = &hint
+	}
+}
+
+/**
+Keep clients on this server instance behind l7 load balancer: sids are
+prefixed with routing key and sticky cookie is set on handshake, see RoutingKey
+*/
+func WithStickySession(sticky StickySession) ServerOption {
+	return func(s *Server) {
+		s.sticky = &sticky
+	}
+}
+
+/**
+Set retries, ttl and in-flight window of reliable emits of server
+channels, see EmitReliable. DefaultReliablePolicy is used by default
+*/
+func WithReliablePolicy(policy ReliablePolicy) ServerOption {
+	return func(s *Server) {
+		s.reliablePolicy = policy
+	}
+}
+
+/**
+Drop duplicates of last window incoming events of every channel, so retried
+events do not execute handlers twice. Duplicate ack request of processed event
+is answered with cached result. Events are identified by idFunc,
+AckMessageId is used if nil, so retries of EmitReliable are deduplicated
+*/
+func WithDeduplication(window int, idFunc MessageIdFunc) ServerOption {
+	return func(s *Server) {
+		s.dedupWindow = window
+		s.messageId = idFunc
+	}
+}
+
+/**
+Stamp events emitted by server channels with sequence number of channel,
+starting from 1. Number is sent as the last event argument, so clients can
+detect events dropped on overflow or by broadcast policy and request resync.
+Acks are not stamped, parsers without several arguments support are not
+stamped as well, see DialWithSequenceCheck
+*/
+func WithSequenceNumbers() ServerOption {
+	return func(s *Server) {
+		s.sequenceNumbers = true
+	}
+}
+
+/**
+Split packets longer than size to continuation frames, so big emit does not
+hold write loop and pings are sent in time. Frames are reassembled by Go
+clients only, so packets are split for clients dialed with DialWithMessageChunking.
+Packets of binary parsers are not split, max message size limits reassembled packets,
+engine.io v4 max payload is used if it is not set
+*/
+func WithMessageChunking(size int) ServerOption {
+	return func(s *Server) {
+		s.chunkSize = size
+	}
+}
+
+/**
+Set max duration of websocket handshake, for websocket transport
+of the server and for upgrade one of polling transport
+*/
+func WithHandshakeTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		for _, wst := range s.websocketTransports() {
+			wst.HandshakeTimeout = timeout
+		}
+	}
+}
+
+/**
+Set sizes of read and write buffers of websocket connections, for websocket
+transport of the server and for upgrade one of polling transport
+*/
+func WithBufferSizes(read, write int) ServerOption {
+	return func(s *Server) {
+		for _, wst := range s.websocketTransports() {
+			wst.ReadBufferSize = read
+			wst.WriteBufferSize = write
+		}
+	}
+}
+
+/**
+Share write buffers of websocket connections in given pool, e.g. &sync.Pool{},
+so idle connections keep no write buffer. Applied as WithBufferSizes is
+*/
+func WithWriteBufferPool(pool transport.BufferPool) ServerOption {
+	return func(s *Server) {
+		for _, wst := range s.websocketTransports() {
+			wst.WriteBufferPool = pool
+		}
+	}
+}
+
+/**
+Register transport chosen by transport query parameter of new connections,
+e.g. "websocket" or "polling", transport given to NewServer is used for
+requests of other transports. Registered transports other than polling are
+upgrade targets of polling connections. Options configuring websocket
+transports, e.g. WithHandshakeTimeout, should follow this one
+*/
+func WithTransport(name string, tr transport.Transport) ServerOption {
+	return func(s *Server) {
+		if s.transports == nil {
+			s.transports = make(map[string]transport.Transport)
+		}
+		s.transports[name] = tr
+	}
+}
+
+/**
+Register several transports by their names, so one server serves clients
+of all of them, with the same channels, rooms and sessions. See WithTransport
+*/
+func WithTransports(trs ...transport.NamedTransport) ServerOption {
+	return func(s *Server) {
+		for _, tr := range trs {
+			WithTransport(tr.Name(), tr)(s)
+		}
+	}
+}
+
+/**
+Accept clients of given engine.io protocol versions only, e.g.
+transport.ProtocolV4 to enforce socket.io 3.x and newer clients. Other
+clients are rejected on handshake with 400 status and engine.io error code 5
+*/
+func WithProtocolVersions(versions ...int) ServerOption {
+	return func(s *Server) {
+		s.protocolVersions = make(map[int]struct{}, len(versions))
+		for _, version := range versions {
+			s.protocolVersions[version] = struct{}{}
+		}
+	}
+}
+
+/**
+Force close channels which are not cleaned up within timeout after
+Shutdown closed them, e.g. because disconnection handler is blocked, so
+Shutdown returns and process can exit. Channels are also force closed
+when Shutdown context is done. Not set by default, Shutdown waits for
+channels until its context is done
+*/
+func WithForceCloseTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.forceCloseTimeout = timeout
+	}
+}
+
+/**
+Close channels which receive nothing but heartbeats for given timeout,
+e.g. abandoned browser tabs, with ErrorIdleTimeout disconnect reason.
+Messages sent to channel do not count as activity
+*/
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+/**
+Close channels of engine.io v4 clients which send no accepted connect
+packet in given time, with ErrorConnectTimeout disconnect reason.
+Disconnection handler is called for them too. Default is DefaultConnectTimeout,
+zero keeps such channels until they are closed otherwise
+*/
+func WithConnectTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.connectTimeout = timeout
+	}
+}
+
+/**
+Set ping interval sent to clients in handshake, overriding one of transport
+*/
+func WithPingInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pingInterval = interval
+	}
+}
+
+/**
+Set ping timeout sent to clients in handshake, overriding one of transport.
+Channel is closed if nothing is received for ping interval plus ping timeout
+*/
+func WithPingTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pingTimeout = timeout
+	}
+}
+
+/**
+Keep channel open when malformed packet is received, it is skipped
+and passed to error handler as error wrapping *DecodeError. Channel is
+closed when more than given amount of malformed packets are received
+in a row, negative amount keeps it open regardless.
+Default zero closes channel on the first malformed packet
+*/
+func WithDecodeErrorTolerance(consecutive int) ServerOption {
+	return func(s *Server) {
+		s.decodeTolerance = consecutive
+	}
+}
+
+/**
+Set logger of internal conditions, standard log package is used by default,
+see NewLogger
+*/
+func WithLogger(l Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+/**
+Set metrics receiving server events, e.g. prometheus collector
+of metrics/prometheus package. Several metrics can be set
+*/
+func WithMetrics(m Metrics) ServerOption {
+	return func(s *Server) {
+		if s.metrics == nil {
+			s.metrics = m
+			return
+		}
+		s.metrics = multiMetrics{s.metrics, m}
+	}
+}
+
+/**
+Publish server statistics as expvar map with given name: active sids,
+connects, disconnects, processed and dropped messages, goroutines.
+Name should be unique, expvar panics otherwise
+*/
+func WithExpvar(name string) ServerOption {
+	return WithMetrics(newExpvarMetrics(name))
+}
+
+/**
+Set tracer starting spans of incoming events and ack round trips,
+e.g. OpenTelemetry one of tracing/otel package
+*/
+func WithTracer(t Tracer) ServerOption {
+	return func(s *Server) {
+		s.tracer = t
+	}
+}
+
+/**
+Log every raw packet received and sent, with sid and direction, using
+logger Info level. Payloads longer than maxPayload bytes are truncated
+*/
+func WithPacketDebug(maxPayload int) ServerOption {
+	return func(s *Server) {
+		s.packetDebug = maxPayload
+	}
+}
+
+/**
+Add transform of packets written to every channel, see OutgoingTransform.
+Channel ones can be added by Channel.AddOutgoingTransform
+*/
+func WithOutgoingTransform(f OutgoingTransform) ServerOption {
+	return func(s *Server) {
+		s.outgoingTransforms = append(s.outgoingTransforms, f)
+	}
+}
+
+/**
+Limit waiting for ack responses, waiter of ack is removed after timeout and
+Ack returns *AckTimeoutError, so not answered acks do not pile up on
+long-lived connections. Acks are waited until their context is done by default
+*/
+func WithAckTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.ackTimeout = timeout
+	}
+}
+
+/**
+Process incoming messages of all channels by shared pool of given amount
+of workers instead of goroutine per message, so concurrency of handlers is
+limited server-wide. Channel reading is paused while queue of queueSize
+messages is full. Handlers waiting for long time hold workers.
+Workers are stopped by Server.Shutdown.
+Option is ignored if workers amount is not positive
+*/
+func WithWorkerPool(workers, queueSize int) ServerOption {
+	return func(s *Server) {
+		if workers <= 0 {
+			return
+		}
+		s.workers = newWorkerPool(workers, queueSize, &s.goroutines.workers)
+	}
+}
+
+/**
+Set what to do with broadcasts to channels which outgoing queue is loaded
+above policy threshold, instead of pushing them to overflow
+*/
+func WithBroadcastPolicy(policy BroadcastPolicy) ServerOption {
+	return func(s *Server) {
+		s.broadcastPolicy = &policy
+	}
+}
+
+/**
+Set handler of auth payload, sent in connect packet by socket.io v3
+and newer clients, e.g. io({auth: {token: "..."}})
+*/
+func WithConnectAuthHandler(f ConnectAuthHandler) ServerOption {
+	return func(s *Server) {
+		s.connectAuthHandler = f
+	}
+}
+
+/**
+Set connection id generator, ids are generated from remote address by default
+*/
+func WithIDGenerator(f IDGenerator) ServerOption {
+	return func(s *Server) {
+		s.idGenerator = f
+	}
+}
+
+/**
+Reject new connections when n channels are connected, with 503 status
+or by calling onReject if it is not nil
+*/
+func WithMaxConnections(n int, onReject http.HandlerFunc) ServerOption {
+	return func(s *Server) {
+		s.maxConnections = int64(n)
+		s.onMaxConnections = onReject
+	}
+}
+
+/**
+Limit incoming events of every channel to rate events per second,
+short spikes up to burst events are allowed. Policy sets whether
+exceeding events are dropped, queued or channel reading is paused
+*/
+func WithRateLimit(rate float64, burst int, policy RateLimitPolicy) ServerOption {
+	return func(s *Server) {
+		s.rateLimit = rate
+		s.rateLimitBurst = burst
+		s.rateLimitPolicy = policy
+	}
+}
+
+/**
+Set size of pending events queue of every channel for RateLimitQueue
+policy, DefaultRateLimitQueueSize if not set
+*/
+func WithRateLimitQueue(size int) ServerOption {
+	return func(s *Server) {
+		s.rateLimitQueue = size
+	}
+}
+
+/**
+Set write timeouts of control packets (ping, pong, close) and of data ones
+separately, so big messages do not delay pings. Zero means transport SendTimeout
+*/
+func WithWriteTimeouts(control, data time.Duration) ServerOption {
+	return func(s *Server) {
+		s.controlWriteTimeout = control
+		s.dataWriteTimeout = data
+	}
+}
+
+/**
+Reject incoming packets bigger than given size in bytes. Client receives
+socket.io error packet, error handler receives error wrapping
+ErrorMessageTooLarge, connection is kept open. Long polling requests
+bigger than size are answered with 413 status, 1mb limit is used if not set
+*/
+func WithMaxMessageSize(size int) ServerOption {
+	return func(s *Server) {
+		s.maxMessageSize = size
+	}
+}
+
+/**
+Decode event arguments right from websocket stream, so big payloads are not
+kept in memory as a whole. Used with default json parser only, without
+interceptors, namespaces and RateLimitQueue policy. Middlewares are called
+before arguments are read, so message Args are empty for them
+*/
+func WithStreamingDecoder() ServerOption {
+	return func(s *Server) {
+		s.streamDecode = true
+	}
+}
+
+/**
+Keep connection open when packet of unknown type is received, e.g. one
+of future protocol version. Packet is skipped and passed to error handler
+as *UnknownPacketError. Malformed packets of known types still close the channel
+*/
+func WithSkipUnknownPackets() ServerOption {
+	return func(s *Server) {
+		s.skipUnknownPackets = true
+	}
+}
+
+/**
+Send pings from server every ping interval and expect pongs, as engine.io v4
+does, instead of waiting for client pings. Clients should use DialWithServerPings
+*/
+func WithServerPings() ServerOption {
+	return func(s *Server) {
+		s.serverPings = true
+	}
+}
+
+/**
+Limit traffic of every channel to given bytes per second, zero means
+no limit for that direction. Policy sets whether exceeding packets are
+dropped, reading and writing is throttled or channel is closed.
+Engine.io ping and pong packets are not limited
+*/
+func WithBandwidthLimit(inbound, outbound int, policy RateLimitPolicy) ServerOption {
+	return func(s *Server) {
+		s.inboundBandwidth = inbound
+		s.outboundBandwidth = outbound
+		s.bandwidthPolicy = policy
+	}
+}
+
+/**
+Set outgoing queue size of every channel, DefaultQueueSize is used
+by default. Channel is closed with ErrorSocketOverflood when queue is full
+*/
+func WithQueueSize(n int) ServerOption {
+	return func(s *Server) {
+		s.queueSize = n
+	}
+}
+
+/**
+Set what to do when outgoing queue of channel is full, OverflowClose
+is used by default. Timeout is used by OverflowBlock policy only,
+DefaultOverflowTimeout if not positive
+*/
+func WithOverflowPolicy(policy OverflowPolicy, timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.overflowPolicy = policy
+		if timeout > 0 {
+			s.overflowTimeout = timeout
+		}
+	}
+}
+
+/**
+Keep rooms and up to bufferSize missed room broadcasts of disconnected
+channels for given window, so reconnected clients can recover their state
+*/
+func WithConnectionRecovery(window time.Duration, bufferSize int) ServerOption {
+	return func(s *Server) {
+		s.recoveryWindow = window
+		s.recoveryBuffer = bufferSize
+	}
+}
+
+/**
+Keep sid, rooms and session values of disconnected channels for grace period,
+client reconnecting with previous sid and recovery token gets the same sid back.
+Missed broadcasts are buffered only if WithConnectionRecovery is used as well,
+state is kept for the longer of grace period and recovery window then
+*/
+func WithSessionResumption(grace time.Duration) ServerOption {
+	return func(s *Server) {
+		s.resumeGrace = grace
+		s.resumeSessions = true
+	}
+}
+
+/**
+Keep up to size last broadcasts of each room, see Channel.JoinWithHistory.
+History is kept while room has channels of this server joined
+*/
+func WithRoomHistory(size int) ServerOption {
+	return func(s *Server) {
+		s.history = newRoomHistory(size)
+	}
+}
+
+/**
+Set packet format used by client, should be the same as server one
+*/
+func DialWithParser(p protocol.Parser) DialOption {
+	return func(c *Client) {
+		c.parser = p
+	}
+}
+
+/**
+Set json encoder and decoder of client arguments, see WithSerializer
+*/
+func DialWithSerializer(serializer protocol.Serializer) DialOption {
+	return DialWithParser(protocol.JsonParser{Serializer: serializer})
+}
+
+/**
+Set outgoing queue size of client, DefaultQueueSize is used by default
+*/
+func DialWithQueueSize(n int) DialOption {
+	return func(c *Client) {
+		c.queueSize = n
+	}
+}
+
+/**
+Set function receiving errors returned by client handlers and processing errors
+*/
+func DialWithErrorHandler(f ErrorHandler) DialOption {
+	return func(c *Client) {
+		c.errorHandler = f
+	}
+}
+
+/**
+Set function receiving panics of client handlers, see WithRecoveryHandler
+*/
+func DialWithRecoveryHandler(f RecoveryHandler) DialOption {
+	return func(c *Client) {
+		c.recoveryHandler = f
+	}
+}
+
+/**
+Set logger of client internal errors, see WithLogger
+*/
+func DialWithLogger(l Logger) DialOption {
+	return func(c *Client) {
+		c.methods.logger = l
+	}
+}
+
+/**
+Limit running time of client event handlers, see WithHandlerTimeout
+*/
+func DialWithHandlerTimeout(timeout time.Duration) DialOption {
+	return func(c *Client) {
+		c.methods.handlerTimeout = timeout
+	}
+}
+
+/**
+Send errors returned by client handlers back to server, see WithEventErrorReplies
+*/
+func DialWithEventErrorReplies() DialOption {
+	return func(c *Client) {
+		c.methods.replyErrors = true
+	}
+}
+
+/**
+Validate names of events received by client, see WithEventNameValidator
+*/
+func DialWithEventNameValidator(f EventNameValidator) DialOption {
+	return func(c *Client) {
+		c.methods.eventNameValidator = f
+	}
+}
+
+/**
+Set retries, ttl and in-flight window of client reliable emits,
+see WithReliablePolicy
+*/
+func DialWithReliablePolicy(policy ReliablePolicy) DialOption {
+	return func(c *Client) {
+		c.reliablePolicy = policy
+	}
+}
+
+/**
+Drop duplicates of events received by client, see WithDeduplication
+*/
+func DialWithDeduplication(window int, idFunc MessageIdFunc) DialOption {
+	return func(c *Client) {
+		c.methods.dedupWindow = window
+		c.methods.messageId = idFunc
+	}
+}
+
+/**
+Check sequence numbers of events sent by server with WithSequenceNumbers,
+f is called when some events are missed. Events of streaming decoder
+and encrypted ones are not checked
+*/
+func DialWithSequenceCheck(f SequenceGapHandler) DialOption {
+	return func(c *Client) {
+		c.sequenceGap = f
+	}
+}
+
+/**
+Split packets longer than size to continuation frames and ask server
+to do the same, server should be Go one, see WithMessageChunking
+*/
+func DialWithMessageChunking(size int) DialOption {
+	return func(c *Client) {
+		c.Channel.chunkSize = size
+	}
+}
+
+/**
+Connect with given transports in order if transport passed to Dial fails,
+e.g. with polling if websocket is blocked by proxy. Reconnection tries
+preferred transport first, see ActiveTransport
+*/
+func DialWithFallback(trs ...transport.Transport) DialOption {
+	return func(c *Client) {
+		c.fallbacks = append(c.fallbacks, trs...)
+	}
+}
+
+/**
+Set write timeouts of control packets and data ones, see WithWriteTimeouts
+*/
+func DialWithWriteTimeouts(control, data time.Duration) DialOption {
+	return func(c *Client) {
+		c.controlWriteTimeout = control
+		c.dataWriteTimeout = data
+	}
+}
+
+/**
+Skip packets of unknown type instead of closing connection, see WithSkipUnknownPackets
+*/
+func DialWithSkipUnknownPackets() DialOption {
+	return func(c *Client) {
+		c.skipUnknownPackets = true
+	}
+}
+
+/**
+Reconnect automatically when connection is lost, with the same url and transport.
+Channel, its handlers and session are kept, OnConnection is called again
+after each reconnection. Client closed by Close is not reconnected
+*/
+func DialWithReconnect(policy ReconnectPolicy) DialOption {
+	return func(c *Client) {
+		c.reconnectPolicy = &policy
+	}
+}
+
+/**
+Queue up to size events emitted while client is reconnecting and send them
+when connection is restored. Policy OverflowDropOldest drops the oldest queued
+event when buffer is full, otherwise Emit returns ErrorSocketOverflood.
+Used with DialWithReconnect, acks are not queued
+*/
+func DialWithOfflineBuffer(size int, policy OverflowPolicy) DialOption {
+	return func(c *Client) {
+		c.offline = &offlineBuffer{size: size, policy: policy}
+	}
+}
+
+/**
+Answer pings of server instead of sending own ones, see WithServerPings.
+Connection is closed with ErrorPingTimeout if server pings are missing
+*/
+func DialWithServerPings() DialOption {
+	return func(c *Client) {
+		c.serverPings = true
+	}
+}
+
+/**
+Set tracer of client events and acks, see WithTracer
+*/
+func DialWithTracer(t Tracer) DialOption {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+/**
+Log every raw packet of client, see WithPacketDebug
+*/
+func DialWithPacketDebug(maxPayload int) DialOption {
+	return func(c *Client) {
+		c.packetDebug = maxPayload
+	}
+}
+
+/**
+Send auth payload in connect packet, as socket.io v3 and newer clients do,
+server receives it with WithConnectAuthHandler. Payload is sent on reconnection too
+*/
+func DialWithAuth(payload interface{}) DialOption {
+	return func(c *Client) {
+		c.authData = payload
+	}
+}
+
+/**
+Add transform of packets written by client, see WithOutgoingTransform
+*/
+func DialWithOutgoingTransform(f OutgoingTransform) DialOption {
+	return func(c *Client) {
+		c.AddOutgoingTransform(f)
+	}
+}
+
+/**
+Limit waiting for ack responses of client, see WithAckTimeout
+*/
+func DialWithAckTimeout(timeout time.Duration) DialOption {
+	return func(c *Client) {
+		c.ackTimeout = timeout
+	}
+}
@@ -0,0 +1,75 @@
+package gosocketio
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	HeaderOrigin = "Origin"
+)
+
+var (
+	ErrorOriginNotAllowed = errors.New("Origin not allowed")
+)
+
+/**
+Origin checking function, returns false to reject the connection
+*/
+type CheckOriginFunc func(r *http.Request) bool
+
+/**
+Check request origin and set cors headers for allowed cross-origin requests,
+returns false if request is rejected or already served (preflight).
+Origin and credentials are allowed only for origins accepted by origin checker,
+any origin is allowed without credentials if there is no checker or "*" is allowed
+*/
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if s.originChecker != nil && !s.originChecker(r) {
+		http.Error(w, ErrorOriginNotAllowed.Error(), http.StatusForbidden)
+		return false
+	}
+
+	origin := r.Header.Get(HeaderOrigin)
+	if origin != "" && (s.originChecker == nil || s.anyOrigin) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", HeaderOrigin)
+	}
+
+	//preflight request of cross-origin long polling
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	return true
+}
+
+/**
+Allow connections only from given origins, "*" allows any origin.
+Requests without Origin header (non-browser clients) are always allowed
+*/
+func AllowedOrigins(origins ...string) CheckOriginFunc {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = struct{}{}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(HeaderOrigin)
+		if origin == "" {
+			return true
+		}
+		if _, ok := allowed["*"]; ok {
+			return true
+		}
+
+		_, ok := allowed[origin]
+		return ok
+	}
+}
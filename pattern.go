@@ -0,0 +1,62 @@
+package gosocketio
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+type eventNameKey struct{}
+
+/**
+Get name of event being processed from handler context, useful
+for handlers bound to event patterns, e.g. "chat.*"
+*/
+func EventName(ctx context.Context) string {
+	name, _ := ctx.Value(eventNameKey{}).(string)
+	return name
+}
+
+func withEventName(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, eventNameKey{}, method)
+}
+
+/**
+Check that method contains glob pattern characters
+*/
+func isEventPattern(method string) bool {
+	return strings.ContainsAny(method, "*?[")
+}
+
+/**
+Find processing function bound to first pattern matching given event,
+one-shot function is removed, so it is found only once
+*/
+func (m *methods) findPatternMethod(method string) (*caller, bool) {
+	m.messageHandlersLock.RLock()
+	var pattern string
+	for _, p := range m.patterns {
+		if ok, _ := path.Match(p, method); ok {
+			pattern = p
+			break
+		}
+	}
+	m.messageHandlersLock.RUnlock()
+
+	if pattern == "" {
+		return nil, false
+	}
+	return m.findMethod(pattern)
+}
+
+/**
+Remove pattern from patterns list, should be called under handlers lock
+*/
+func (m *methods) removePattern(method string) {
+	for i, p := range m.patterns {
+		if p == method {
+			m.patterns = append(m.patterns[:i:i], m.patterns[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package gosocketio
+
+import (
+	"sync"
+)
+
+const (
+	OnPresenceOnline  = "presence:online"
+	OnPresenceOffline = "presence:offline"
+)
+
+/**
+Presence notification payload
+*/
+type PresenceEvent struct {
+	Key string `json:"key"`
+}
+
+/**
+Online status tracking of users, identified by key, e.g. user id.
+One user can have several connections, user is online while at least
+one of them is alive
+*/
+type Presence struct {
+	server *Server
+
+	users map[string]map[*Channel]struct{}
+	keys  map[*Channel]string
+	lock  sync.RWMutex
+
+	notifyRooms []string
+}
+
+/**
+Create presence tracker for given server, channels are untracked
+automatically on disconnection
+*/
+func NewPresence(s *Server) *Presence {
+	p := &Presence{
+		server: s,
+		users:  make(map[string]map[*Channel]struct{}),
+		keys:   make(map[*Channel]string),
+	}
+	s.addDisconnectHook(p.untrack)
+
+	return p
+}
+
+/**
+Set rooms to notify with OnPresenceOnline and OnPresenceOffline events,
+when user becomes online or offline
+*/
+func (p *Presence) Notify(rooms ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.notifyRooms = rooms
+}
+
+/**
+Bind channel to user key, usually called from connection handler
+*/
+func (p *Presence) Track(c *Channel, key string) {
+	p.lock.Lock()
+	if prev, ok := p.keys[c]; ok && prev != key {
+		p.lock.Unlock()
+		p.untrack(c)
+		p.lock.Lock()
+	}
+
+	connections, ok := p.users[key]
+	if !ok {
+		connections = make(map[*Channel]struct{})
+		p.users[key] = connections
+	}
+	connections[c] = struct{}{}
+	p.keys[c] = key
+	rooms := p.notifyRooms
+	p.lock.Unlock()
+
+	if !ok {
+		p.notify(rooms, OnPresenceOnline, key)
+	}
+}
+
+/**
+Remove channel from user connections
+*/
+func (p *Presence) untrack(c *Channel) {
+	p.lock.Lock()
+	key, ok := p.keys[c]
+	if !ok {
+		p.lock.Unlock()
+		return
+	}
+
+	delete(p.keys, c)
+	connections := p.users[key]
+	delete(connections, c)
+	offline := len(connections) == 0
+	if offline {
+		delete(p.users, key)
+	}
+	rooms := p.notifyRooms
+	p.lock.Unlock()
+
+	if offline {
+		p.notify(rooms, OnPresenceOffline, key)
+	}
+}
+
+func (p *Presence) notify(rooms []string, method, key string) {
+	if len(rooms) > 0 {
+		p.server.BroadcastToRooms(rooms, method, PresenceEvent{key})
+	}
+}
+
+/**
+Check that user has at least one connection
+*/
+func (p *Presence) Online(key string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, ok := p.users[key]
+	return ok
+}
+
+/**
+Get connections of given user
+*/
+func (p *Presence) Connections(key string) []*Channel {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	connections := make([]*Channel, 0, len(p.users[key]))
+	for c := range p.users[key] {
+		connections = append(connections, c)
+	}
+
+	return connections
+}
+
+/**
+Get keys of users, having at least one connection joined to given room
+*/
+func (p *Presence) List(room string) []string {
+	channels := p.server.List(room)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	seen := make(map[string]struct{})
+	keys := []string{}
+	for _, c := range channels {
+		key, ok := p.keys[c]
+		if !ok {
+			continue
+		}
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+/**
+Get keys of all online users
+*/
+func (p *Presence) Users() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	keys := make([]string, 0, len(p.users))
+	for key := range p.users {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -1,5 +1,9 @@
 package protocol
 
+import (
+	"sync"
+)
+
 const (
 	/**
 	Message with connection options
@@ -18,7 +22,8 @@ const (
 	*/
 	MessageTypePong = iota
 	/**
-	Empty message
+	Empty message, socket.io connect. Args contain auth payload
+	sent by socket.io v3 and newer clients
 	*/
 	MessageTypeEmpty = iota
 	/**
@@ -33,6 +38,14 @@ const (
 	ack response
 	*/
 	MessageTypeAckResponse = iota
+	/**
+	socket.io disconnect, remote side leaves the namespace
+	*/
+	MessageTypeDisconnect = iota
+	/**
+	socket.io error, args contain error data
+	*/
+	MessageTypeError = iota
 )
 
 type Message struct {
@@ -41,5 +54,36 @@ type Message struct {
 	Method string
 	Args   string
 	Source string
+	//socket.io namespace, empty for default "/" one
+	Namespace string
+	//amount of binary attachments following binary event or ack packet
+	Attachments int
 }
 
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return &Message{}
+	},
+}
+
+/**
+Get empty message from pool. Messages returned by parsers are taken from
+pool too, owner should return them with ReleaseMessage when done
+*/
+func AcquireMessage() *Message {
+	return messagePool.Get().(*Message)
+}
+
+/**
+Return message to pool, it should not be used after that.
+Strings taken from message fields stay valid
+*/
+func ReleaseMessage(msg *Message) {
+	if msg == nil {
+		return
+	}
+
+	*msg = Message{}
+	messagePool.Put(msg)
+}
@@ -0,0 +1,210 @@
+package protocol
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	/**
+	engine.io message packet type, prepended to binary frames
+	*/
+	binaryMessage = "\x04"
+
+	msgpackNamespace = "/"
+)
+
+/**
+socket.io packet types, as they are encoded by msgpack parser
+*/
+const (
+	packetConnect = iota
+	packetDisconnect
+	packetEvent
+	packetAck
+	packetError
+)
+
+type msgpackPacket struct {
+	Type int                `msgpack:"type"`
+	Data msgpack.RawMessage `msgpack:"data,omitempty"`
+	Nsp  string             `msgpack:"nsp"`
+	Id   *int               `msgpack:"id,omitempty"`
+}
+
+/**
+Packet format compatible with socket.io-msgpack-parser
+
+engine.io packets (open, close, ping, pong) are still sent as text,
+socket.io packets are sent as binary frames. Arguments are encoded
+with msgpack too, so use "msgpack" struct tags instead of "json" ones
+*/
+type MsgpackParser struct{}
+
+func (p MsgpackParser) Encode(msg *Message) (string, error) {
+	packet := &msgpackPacket{Nsp: msgpackNamespace}
+	if msg.Namespace != "" {
+		packet.Nsp = msg.Namespace
+	}
+
+	switch msg.Type {
+	case MessageTypeOpen, MessageTypeClose, MessageTypePing, MessageTypePong:
+		return Encode(msg)
+	case MessageTypeEmpty:
+		packet.Type = packetConnect
+		if msg.Args != "" {
+			packet.Data = msgpack.RawMessage(msg.Args)
+		}
+	case MessageTypeDisconnect:
+		packet.Type = packetDisconnect
+	case MessageTypeEmit, MessageTypeAckRequest:
+		packet.Type = packetEvent
+		method, err := msgpack.Marshal(msg.Method)
+		if err != nil {
+			return "", err
+		}
+		if packet.Data, err = msgpackArgs(method, msg.Args); err != nil {
+			return "", err
+		}
+		if msg.Type == MessageTypeAckRequest {
+			packet.Id = &msg.AckId
+		}
+	case MessageTypeAckResponse:
+		packet.Type = packetAck
+		var err error
+		if packet.Data, err = msgpackArgs(nil, msg.Args); err != nil {
+			return "", err
+		}
+		packet.Id = &msg.AckId
+	case MessageTypeError:
+		packet.Type = packetError
+		if msg.Args != "" {
+			packet.Data = msgpack.RawMessage(msg.Args)
+		}
+	default:
+		return "", ErrorWrongMessageType
+	}
+
+	data, err := msgpack.Marshal(packet)
+	if err != nil {
+		return "", err
+	}
+
+	return binaryMessage + string(data), nil
+}
+
+/**
+Build packet data array from already encoded method and arguments
+*/
+func msgpackArgs(method []byte, args string) (msgpack.RawMessage, error) {
+	data := make([]msgpack.RawMessage, 0, 2)
+	if method != nil {
+		data = append(data, msgpack.RawMessage(method))
+	}
+	if args != "" {
+		data = append(data, msgpack.RawMessage(args))
+	}
+
+	return msgpack.Marshal(data)
+}
+
+func (p MsgpackParser) Decode(data string) (*Message, error) {
+	if !p.IsBinary(data) {
+		return Decode(data)
+	}
+
+	packet := &msgpackPacket{}
+	if err := msgpack.Unmarshal([]byte(data[1:]), packet); err != nil {
+		return nil, ErrorWrongPacket
+	}
+
+	msg := AcquireMessage()
+	msg.Source = data
+	if packet.Nsp != msgpackNamespace {
+		msg.Namespace = packet.Nsp
+	}
+	switch packet.Type {
+	case packetConnect:
+		msg.Type = MessageTypeEmpty
+		msg.Args = string(packet.Data)
+		return msg, nil
+	case packetDisconnect:
+		msg.Type = MessageTypeDisconnect
+		return msg, nil
+	case packetError:
+		msg.Type = MessageTypeError
+		msg.Args = string(packet.Data)
+		return msg, nil
+	case packetEvent, packetAck:
+	default:
+		ReleaseMessage(msg)
+		return nil, ErrorWrongMessageType
+	}
+
+	var args []msgpack.RawMessage
+	if err := msgpack.Unmarshal(packet.Data, &args); err != nil {
+		ReleaseMessage(msg)
+		return nil, ErrorWrongPacket
+	}
+
+	if packet.Type == packetAck {
+		if packet.Id == nil {
+			ReleaseMessage(msg)
+			return nil, ErrorWrongPacket
+		}
+		msg.Type = MessageTypeAckResponse
+		msg.AckId = *packet.Id
+		if len(args) > 0 {
+			msg.Args = string(args[0])
+		}
+		return msg, nil
+	}
+
+	if len(args) == 0 {
+		ReleaseMessage(msg)
+		return nil, ErrorWrongPacket
+	}
+	if err := msgpack.Unmarshal(args[0], &msg.Method); err != nil {
+		ReleaseMessage(msg)
+		return nil, ErrorWrongPacket
+	}
+	if len(args) > 1 {
+		msg.Args = string(args[1])
+	}
+
+	msg.Type = MessageTypeEmit
+	if packet.Id != nil {
+		msg.Type = MessageTypeAckRequest
+		msg.AckId = *packet.Id
+	}
+
+	return msg, nil
+}
+
+func (p MsgpackParser) Marshal(v interface{}) (string, error) {
+	data, err := msgpack.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (p MsgpackParser) Unmarshal(data string, v interface{}) error {
+	return msgpack.Unmarshal([]byte(data), v)
+}
+
+/**
+Decode packet by its frame type, binary frames without engine.io
+message type prefix are sent by engine.io v4 clients
+*/
+func (p MsgpackParser) DecodeFrame(data string, binary bool) (*Message, error) {
+	if binary && !p.IsBinary(data) {
+		data = binaryMessage + data
+	}
+
+	return p.Decode(data)
+}
+
+func (p MsgpackParser) IsBinary(packet string) bool {
+	return len(packet) > 0 && packet[0:1] == binaryMessage
+}
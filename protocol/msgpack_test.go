@@ -0,0 +1,172 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+/**
+Packets encoded by msgpack parser should be decoded back to the same
+message, arguments should be decoded to the same values
+*/
+func TestMsgpackRoundTrip(t *testing.T) {
+	p := MsgpackParser{}
+	tests := []struct {
+		name string
+		msg  Message
+		args interface{}
+	}{
+		{"emit", Message{Type: MessageTypeEmit, Method: "chat"}, "hello"},
+		{"emit without args", Message{Type: MessageTypeEmit, Method: "ready"}, nil},
+		{"emit to namespace", Message{Type: MessageTypeEmit, Method: "chat", Namespace: "/admin"}, 42},
+		{"ack request", Message{Type: MessageTypeAckRequest, AckId: 7, Method: "join"},
+			map[string]interface{}{"room": "lobby"}},
+		{"ack request with zero id", Message{Type: MessageTypeAckRequest, Method: "join"}, "lobby"},
+		{"ack response", Message{Type: MessageTypeAckResponse, AckId: 7}, true},
+		{"ack response without args", Message{Type: MessageTypeAckResponse, AckId: 12}, nil},
+		{"binary args", Message{Type: MessageTypeEmit, Method: "upload"}, []byte{0, 1, 2, 0xff}},
+		{"binary ack", Message{Type: MessageTypeAckResponse, AckId: 3}, []byte("\x00\x04raw")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := test.msg
+			if test.args != nil {
+				args, err := p.Marshal(test.args)
+				if err != nil {
+					t.Fatalf("marshal of %v failed: %v", test.args, err)
+				}
+				msg.Args = args
+			}
+
+			encoded, err := p.Encode(&msg)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			if !p.IsBinary(encoded) {
+				t.Fatalf("%q is not sent as binary frame", encoded)
+			}
+
+			decoded, err := p.Decode(encoded)
+			if err != nil {
+				t.Fatalf("decoding of %q failed: %v", encoded, err)
+			}
+			defer ReleaseMessage(decoded)
+
+			if decoded.Type != msg.Type || decoded.AckId != msg.AckId ||
+				decoded.Method != msg.Method || decoded.Namespace != msg.Namespace ||
+				decoded.Args != msg.Args {
+				t.Fatalf("%+v encoded as %q and decoded as %+v", msg, encoded, *decoded)
+			}
+			checkMsgpackArgs(t, p, decoded.Args, test.args)
+		})
+	}
+}
+
+func checkMsgpackArgs(t *testing.T, p MsgpackParser, data string, expected interface{}) {
+	if expected == nil {
+		if data != "" {
+			t.Fatalf("args %q, expected none", data)
+		}
+		return
+	}
+
+	v := reflect.New(reflect.TypeOf(expected))
+	if err := p.Unmarshal(data, v.Interface()); err != nil {
+		t.Fatalf("unmarshal of %q failed: %v", data, err)
+	}
+	if !reflect.DeepEqual(v.Elem().Interface(), expected) {
+		t.Fatalf("args %v, expected %v", v.Elem().Interface(), expected)
+	}
+}
+
+/**
+Connect and disconnect packets are sent as binary frames too,
+engine.io packets are sent as text
+*/
+func TestMsgpackControlPackets(t *testing.T) {
+	p := MsgpackParser{}
+	tests := []struct {
+		name   string
+		msg    Message
+		binary bool
+	}{
+		{"connect", Message{Type: MessageTypeEmpty}, true},
+		{"connect to namespace", Message{Type: MessageTypeEmpty, Namespace: "/admin"}, true},
+		{"disconnect", Message{Type: MessageTypeDisconnect, Namespace: "/admin"}, true},
+		{"ping", Message{Type: MessageTypePing}, false},
+		{"pong", Message{Type: MessageTypePong}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := p.Encode(&test.msg)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			if p.IsBinary(encoded) != test.binary {
+				t.Fatalf("%q binary %v, expected %v", encoded, !test.binary, test.binary)
+			}
+
+			decoded, err := p.Decode(encoded)
+			if err != nil {
+				t.Fatalf("decoding of %q failed: %v", encoded, err)
+			}
+			defer ReleaseMessage(decoded)
+
+			if decoded.Type != test.msg.Type || decoded.Namespace != test.msg.Namespace {
+				t.Fatalf("%+v encoded as %q and decoded as %+v", test.msg, encoded, *decoded)
+			}
+		})
+	}
+}
+
+/**
+Binary frames of engine.io v4 clients come without message type prefix
+*/
+func TestMsgpackDecodeFrame(t *testing.T) {
+	p := MsgpackParser{}
+	args, err := p.Marshal("hello")
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	encoded, err := p.Encode(&Message{Type: MessageTypeEmit, Method: "chat", Args: args})
+	if err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+
+	decoded, err := p.DecodeFrame(encoded[len(binaryMessage):], true)
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	defer ReleaseMessage(decoded)
+
+	if decoded.Type != MessageTypeEmit || decoded.Method != "chat" || decoded.Args != args {
+		t.Fatalf("decoded as %+v", *decoded)
+	}
+}
+
+func TestMsgpackDecodeWrong(t *testing.T) {
+	p := MsgpackParser{}
+	ackWithoutId, err := p.Marshal(map[string]interface{}{"type": packetAck, "nsp": "/"})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	eventWithoutMethod, err := p.Marshal(map[string]interface{}{
+		"type": packetEvent, "nsp": "/", "data": []interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	for _, data := range []string{
+		binaryMessage,
+		binaryMessage + "\xc1",
+		binaryMessage + ackWithoutId,
+		binaryMessage + eventWithoutMethod,
+	} {
+		if msg, err := p.Decode(data); err == nil {
+			t.Fatalf("%q decoded as %+v, expected error", data, *msg)
+		}
+	}
+}
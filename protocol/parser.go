@@ -0,0 +1,143 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+/**
+Packet format used by socket.io connection, json one is used by default
+*/
+type Parser interface {
+	/**
+	Encode message to the packet ready to be sent
+	*/
+	Encode(msg *Message) (string, error)
+
+	/**
+	Decode received packet to message, taken from pool, see ReleaseMessage
+	*/
+	Decode(data string) (*Message, error)
+
+	/**
+	Encode emit, ack or handler result arguments
+	*/
+	Marshal(v interface{}) (string, error)
+
+	/**
+	Decode message arguments to given value
+	*/
+	Unmarshal(data string, v interface{}) error
+
+	/**
+	Check that encoded packet should be sent as binary frame
+	*/
+	IsBinary(packet string) bool
+}
+
+/**
+Parser decoding packets by frame type they were received with.
+Binary frames of engine.io v4 have no engine.io message type prefix
+*/
+type FrameParser interface {
+	/**
+	Decode packet received as binary frame if binary is set
+	*/
+	DecodeFrame(data string, binary bool) (*Message, error)
+}
+
+/**
+Packet format able to carry several positional event arguments
+*/
+type MultiArgsParser interface {
+	/**
+	Encode several arguments, they are sent as separate event arguments
+	*/
+	MarshalArgs(v []interface{}) (string, error)
+
+	/**
+	Decode message arguments to given pointers one by one
+	*/
+	UnmarshalArgs(data string, v []interface{}) error
+}
+
+/**
+Json encoder and decoder of arguments, e.g. jsoniter or segmentio one,
+encoding/json is used by default
+*/
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+/**
+Default socket.io text packet format, arguments are encoded by Serializer
+if it is set. Packet headers are always processed by encoding/json
+*/
+type JsonParser struct {
+	Serializer Serializer
+}
+
+func (p JsonParser) Encode(msg *Message) (string, error) {
+	return Encode(msg)
+}
+
+func (p JsonParser) Decode(data string) (*Message, error) {
+	return Decode(data)
+}
+
+func (p JsonParser) Marshal(v interface{}) (string, error) {
+	var data []byte
+	var err error
+	if p.Serializer != nil {
+		data, err = p.Serializer.Marshal(v)
+	} else {
+		data, err = json.Marshal(&v)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (p JsonParser) Unmarshal(data string, v interface{}) error {
+	if p.Serializer != nil {
+		return p.Serializer.Unmarshal([]byte(data), v)
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func (p JsonParser) IsBinary(packet string) bool {
+	return false
+}
+
+func (p JsonParser) MarshalArgs(v []interface{}) (string, error) {
+	encoded := make([]string, 0, len(v))
+	for _, arg := range v {
+		data, err := p.Marshal(arg)
+		if err != nil {
+			return "", err
+		}
+		encoded = append(encoded, data)
+	}
+
+	return strings.Join(encoded, ","), nil
+}
+
+func (p JsonParser) UnmarshalArgs(data string, v []interface{}) error {
+	if p.Serializer == nil {
+		return DecodeArgs(strings.NewReader(data+"]"), v)
+	}
+
+	var args []json.RawMessage
+	if err := p.Serializer.Unmarshal([]byte("["+data+"]"), &args); err != nil {
+		return err
+	}
+	for i := 0; i < len(v) && i < len(args); i++ {
+		if err := p.Serializer.Unmarshal(args[i], v[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,18 +5,27 @@ import (
 	"errors"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
-	open          = "0"
-	msg           = "4"
-	emptyMessage  = "40"
-	commonMessage = "42"
-	ackMessage    = "43"
+	open               = "0"
+	msgPrefix          = "4"
+	emptyMessage       = "40"
+	disconnectMessage  = "41"
+	commonMessage      = "42"
+	ackMessage         = "43"
+	errorMessage       = "44"
+	binaryEventMessage = "45"
+	binaryAckMessage   = "46"
+
+	defaultNamespace = "/"
 
 	CloseMessage = "1"
 	PingMessage = "2"
 	PongMessage = "3"
+	UpgradeMessage = "5"
+	NoopMessage = "6"
 )
 
 var (
@@ -36,43 +45,136 @@ func typeToText(msgType int) (string, error) {
 		return PongMessage, nil
 	case MessageTypeEmpty:
 		return emptyMessage, nil
+	case MessageTypeDisconnect:
+		return disconnectMessage, nil
 	case MessageTypeEmit, MessageTypeAckRequest:
 		return commonMessage, nil
 	case MessageTypeAckResponse:
 		return ackMessage, nil
+	case MessageTypeError:
+		return errorMessage, nil
 	}
 	return "", ErrorWrongMessageType
 }
 
 func Encode(msg *Message) (string, error) {
-	result, err := typeToText(msg.Type)
+	result, err := AppendMessage(make([]byte, 0, encodedSizeHint(msg)), msg)
 	if err != nil {
 		return "", err
 	}
 
-	if msg.Type == MessageTypeEmpty || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong {
-		return result, nil
+	return string(result), nil
+}
+
+/**
+Append encoded message to dst and return extended slice, like strconv.Append*.
+Nothing is allocated if dst has enough capacity
+*/
+func AppendMessage(dst []byte, msg *Message) ([]byte, error) {
+	result, err := typeToText(msg.Type)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, result...)
+	if len(result) > 1 && msg.Namespace != "" && msg.Namespace != defaultNamespace {
+		//socket.io packet of custom namespace
+		dst = append(dst, msg.Namespace...)
+		dst = append(dst, ',')
+	}
+
+	if msg.Type == MessageTypePing || msg.Type == MessageTypePong ||
+		msg.Type == MessageTypeDisconnect {
+		return dst, nil
+	}
+	if msg.Type == MessageTypeEmpty {
+		//socket.io v3 connect packet can carry auth payload
+		return append(dst, msg.Args...), nil
 	}
 
 	if msg.Type == MessageTypeAckRequest || msg.Type == MessageTypeAckResponse {
-		result += strconv.Itoa(msg.AckId)
+		dst = strconv.AppendInt(dst, int64(msg.AckId), 10)
 	}
 
-	if msg.Type == MessageTypeOpen || msg.Type == MessageTypeClose {
-		return result + msg.Args, nil
+	if msg.Type == MessageTypeOpen || msg.Type == MessageTypeClose ||
+		msg.Type == MessageTypeError {
+		return append(dst, msg.Args...), nil
 	}
 
-	if msg.Type == MessageTypeAckResponse {
-		return result + "[" + msg.Args + "]", nil
+	dst = append(dst, '[')
+	if msg.Type != MessageTypeAckResponse {
+		dst = appendJsonString(dst, msg.Method)
+		if msg.Args != "" {
+			dst = append(dst, ',')
+		}
 	}
+	dst = append(dst, msg.Args...)
 
-	jsonMethod, err := json.Marshal(&msg.Method)
-	if err != nil {
-		return "", err
+	return append(dst, ']'), nil
+}
+
+/**
+Approximate size of encoded message, used to allocate buffer once
+*/
+func encodedSizeHint(msg *Message) int {
+	//type, ack id, brackets, quotes and comma
+	return len(msg.Method) + len(msg.Args) + 16
+}
+
+const hexDigits = "0123456789abcdef"
+
+/**
+Append string as json string literal, escaped the same way as encoding/json
+does it, except html characters, which are kept as is
+*/
+func appendJsonString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		//line and paragraph separators are not valid in javascript strings
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
 	}
+	dst = append(dst, s[start:]...)
 
-	return result + "[" + string(jsonMethod) + "," + msg.Args + "]", nil
+	return append(dst, '"')
 }
 
 func MustEncode(msg *Message) string {
@@ -97,118 +199,187 @@ func getMessageType(data string) (int, error) {
 		return MessageTypePing, nil
 	case PongMessage:
 		return MessageTypePong, nil
-	case msg:
+	case msgPrefix:
 		if len(data) == 1 {
 			return 0, ErrorWrongMessageType
 		}
 		switch data[0:2] {
 		case emptyMessage:
 			return MessageTypeEmpty, nil
-		case commonMessage:
+		case disconnectMessage:
+			return MessageTypeDisconnect, nil
+		case commonMessage, binaryEventMessage:
 			return MessageTypeAckRequest, nil
-		case ackMessage:
+		case ackMessage, binaryAckMessage:
 			return MessageTypeAckResponse, nil
+		case errorMessage:
+			return MessageTypeError, nil
 		}
 	}
 	return 0, ErrorWrongMessageType
 }
 
 /**
-Get ack id of current packet, if present
+Decode packet, returned message is taken from pool, see ReleaseMessage.
+Malformed packets are reported with ErrorWrongPacket
 */
-func getAck(text string) (ackId int, restText string, err error) {
-	if len(text) < 4 {
-		return 0, "", ErrorWrongPacket
-	}
-	text = text[2:]
-
-	pos := strings.IndexByte(text, '[')
-	if pos == -1 {
-		return 0, "", ErrorWrongPacket
+func Decode(data string) (*Message, error) {
+	msgType, err := getMessageType(data)
+	if err != nil {
+		return nil, err
 	}
 
-	ack, err := strconv.Atoi(text[0:pos])
-	if err != nil {
-		return 0, "", err
+	msg := AcquireMessage()
+	msg.Source = data
+	msg.Type = msgType
+	if err := decodeBody(msg, data); err != nil {
+		ReleaseMessage(msg)
+		return nil, err
 	}
 
-	return ack, text[pos:], nil
+	return msg, nil
 }
 
 /**
-Get message method of current packet, if present
+Decode packet after its type is known:
+type, binary attachments count, namespace, ack id and data array
 */
-func getMethod(text string) (method, restText string, err error) {
-	var start, end, rest, countQuote int
-
-	for i, c := range text {
-		if c == '"' {
-			switch countQuote {
-			case 0:
-				start = i + 1
-			case 1:
-				end = i
-				rest = i + 1
-			default:
-				return "", "", ErrorWrongPacket
-			}
-			countQuote++
+func decodeBody(msg *Message, data string) error {
+	switch msg.Type {
+	case MessageTypeOpen:
+		msg.Args = data[1:]
+		return nil
+	case MessageTypeClose, MessageTypePing, MessageTypePong:
+		return nil
+	}
+
+	binary := data[0:2] == binaryEventMessage || data[0:2] == binaryAckMessage
+	rest := data[2:]
+	if binary {
+		count, tail, ok := cutNumber(rest)
+		if !ok || len(tail) == 0 || tail[0] != '-' {
+			return ErrorWrongPacket
 		}
-		if c == ',' {
-			if countQuote < 2 {
-				continue
-			}
-			rest = i + 1
-			break
+		msg.Attachments = count
+		rest = tail[1:]
+	}
+
+	if len(rest) > 0 && rest[0] == '/' {
+		end := strings.IndexByte(rest, ',')
+		if end == -1 {
+			msg.Namespace, rest = rest, ""
+		} else {
+			msg.Namespace, rest = rest[:end], rest[end+1:]
+		}
+		if msg.Namespace == defaultNamespace {
+			msg.Namespace = ""
+		}
+	}
+
+	switch msg.Type {
+	case MessageTypeDisconnect:
+		return nil
+	case MessageTypeEmpty, MessageTypeError:
+		msg.Args = rest
+		return nil
+	}
+
+	ack, rest, hasAck := cutNumber(rest)
+	msg.AckId = ack
+	body, ok := arrayBody(rest)
+	if !ok {
+		return ErrorWrongPacket
+	}
+
+	if msg.Type == MessageTypeAckResponse {
+		if !hasAck {
+			return ErrorWrongPacket
 		}
+		msg.Args = body
+		return nil
+	}
+
+	if !hasAck {
+		msg.Type = MessageTypeEmit
 	}
 
-	if (end < start) || (rest >= len(text)) {
-		return "", "", ErrorWrongPacket
+	method, args, ok := cutMethod(body)
+	if !ok {
+		return ErrorWrongPacket
 	}
+	msg.Method, msg.Args = method, args
 
-	return text[start:end], text[rest : len(text)-1], nil
+	return nil
 }
 
-func Decode(data string) (*Message, error) {
-	var err error
-	msg := &Message{}
-	msg.Source = data
+const jsonSpace = " \t\r\n"
 
-	msg.Type, err = getMessageType(data)
-	if err != nil {
-		return nil, err
+/**
+Cut leading decimal number, ok is false if there are no digits
+*/
+func cutNumber(s string) (n int, rest string, ok bool) {
+	i := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		//ids are not expected to be that long, prevent overflow
+		if i >= 18 {
+			return 0, s, false
+		}
+		n = n*10 + int(s[i]-'0')
 	}
 
-	if msg.Type == MessageTypeOpen {
-		msg.Args = data[1:]
-		return msg, nil
+	return n, s[i:], i > 0
+}
+
+/**
+Get contents of json array, without brackets
+*/
+func arrayBody(s string) (string, bool) {
+	s = strings.Trim(s, jsonSpace)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return "", false
 	}
 
-	if msg.Type == MessageTypeClose || msg.Type == MessageTypePing ||
-		msg.Type == MessageTypePong || msg.Type == MessageTypeEmpty {
-		return msg, nil
+	return strings.Trim(s[1:len(s)-1], jsonSpace), true
+}
+
+/**
+Split array contents to method name, json string, and raw arguments
+*/
+func cutMethod(body string) (method, args string, ok bool) {
+	if len(body) == 0 || body[0] != '"' {
+		return "", "", false
 	}
 
-	ack, rest, err := getAck(data)
-	msg.AckId = ack
-	if msg.Type == MessageTypeAckResponse {
-		if err != nil {
-			return nil, err
+	end, escaped := -1, false
+	for i := 1; i < len(body); i++ {
+		if body[i] == '\\' {
+			escaped = true
+			//skip escaped character
+			i++
+			continue
+		}
+		if body[i] == '"' {
+			end = i + 1
+			break
 		}
-		msg.Args = rest[1 : len(rest)-1]
-		return msg, nil
+	}
+	if end == -1 {
+		return "", "", false
 	}
 
-	if err != nil {
-		msg.Type = MessageTypeEmit
-		rest = data[2:]
+	if !escaped {
+		method = body[1 : end-1]
+	} else if err := json.Unmarshal([]byte(body[:end]), &method); err != nil {
+		return "", "", false
 	}
 
-	msg.Method, msg.Args, err = getMethod(rest)
-	if err != nil {
-		return nil, err
+	rest := strings.TrimLeft(body[end:], jsonSpace)
+	if rest == "" {
+		return method, "", true
+	}
+	if rest[0] != ',' {
+		return "", "", false
 	}
 
-	return msg, nil
+	return method, strings.TrimLeft(rest[1:], jsonSpace), true
 }
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+/**
+Decoding of any input should fail with error or return consistent message,
+decoded events and acks should survive encoding back.
+Seed corpus of real socket.io frames is in testdata/fuzz/FuzzDecode
+*/
+func FuzzDecode(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data string) {
+		msg, err := Decode(data)
+		if err != nil {
+			if msg != nil {
+				t.Fatalf("message returned with error %v", err)
+			}
+			return
+		}
+		defer ReleaseMessage(msg)
+
+		if msg.Source != data {
+			t.Fatalf("source %q, expected %q", msg.Source, data)
+		}
+		//invalid utf-8 of method is replaced on encoding
+		if msg.Attachments == 0 && utf8.ValidString(data) {
+			checkRoundTrip(t, msg)
+		}
+
+		streamed, args, err := DecodeReader(strings.NewReader(data))
+		if err != nil {
+			return
+		}
+		if args != nil {
+			var v interface{}
+			DecodeArgs(args, []interface{}{&v})
+		}
+		ReleaseMessage(streamed)
+	})
+}
+
+func checkRoundTrip(t *testing.T, msg *Message) {
+	switch msg.Type {
+	case MessageTypeEmit, MessageTypeAckRequest, MessageTypeAckResponse:
+	default:
+		return
+	}
+
+	encoded, err := Encode(msg)
+	if err != nil {
+		t.Fatalf("encoding of %q failed: %v", msg.Source, err)
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("decoding of %q, encoded from %q, failed: %v", encoded, msg.Source, err)
+	}
+	defer ReleaseMessage(decoded)
+
+	if decoded.Type != msg.Type || decoded.AckId != msg.AckId ||
+		decoded.Method != msg.Method || decoded.Args != msg.Args ||
+		decoded.Namespace != msg.Namespace {
+		t.Fatalf("%q decoded as %+v, encoded back as %q and decoded as %+v",
+			msg.Source, *msg, encoded, *decoded)
+	}
+}
+
+/**
+Streaming decoder should return the same message and arguments as Decode,
+packets Decode fails on should fail on decoding of message or arguments
+*/
+func TestDecodeReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"emit", `42["chat","hello"]`, true},
+		{"emit without args", `42["ready"]`, true},
+		{"several args", `42["move",1,{"x":2,"y":[3,4]},"end"]`, true},
+		{"extra args", `42["move",1,2,3,[4,{"a":"]"}],5]`, true},
+		{"ack request", `4212["join","lobby"]`, true},
+		{"namespace", `42/admin,["chat","hello"]`, true},
+		{"namespace ack request", `42/admin,7["join"]`, true},
+		{"default namespace", `42/,["chat"]`, true},
+		{"escaped method", `42["say \"hi\"",null]`, true},
+		{"trailing whitespace", `42["chat","hello"] `, true},
+		{"ack response", `437["ok"]`, true},
+		{"ping", `2`, true},
+		{"probe", `3probe`, true},
+		{"connect", `40/admin,`, true},
+		{"disconnect", `41`, true},
+		{"no packet", `42`, false},
+		{"truncated method", `42["chat`, false},
+		{"truncated args", `42["chat","hel`, false},
+		{"truncated array", `42["chat",1`, false},
+		{"truncated without args", `42["chat"`, false},
+		{"trailing data", `42["chat","hello"]junk`, false},
+		{"trailing data without args", `42["chat"]x`, false},
+		{"wrong ack id", `42x["chat"]`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := Decode(test.data)
+			if (err == nil) != test.valid {
+				t.Fatalf("Decode of %q returned error %v", test.data, err)
+			}
+			if expected != nil {
+				defer ReleaseMessage(expected)
+			}
+
+			msg, args, err := DecodeReader(strings.NewReader(test.data))
+			if err == nil {
+				defer ReleaseMessage(msg)
+			}
+			if err == nil && args != nil {
+				err = checkStreamedArgs(args, expected)
+			}
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("%q decoded from stream as %+v, expected error", test.data, *msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stream decoding of %q failed: %v", test.data, err)
+			}
+
+			if msg.Type != expected.Type || msg.AckId != expected.AckId ||
+				msg.Method != expected.Method || msg.Namespace != expected.Namespace {
+				t.Fatalf("%q decoded from stream as %+v, expected %+v", test.data, *msg, *expected)
+			}
+			if args == nil && (msg.Args != expected.Args || msg.Source != expected.Source) {
+				t.Fatalf("%q decoded from stream as %+v, expected %+v", test.data, *msg, *expected)
+			}
+		})
+	}
+}
+
+/**
+Decode streamed arguments and compare them with the ones decoded by Decode,
+which are expected to be nil if Decode failed
+*/
+func checkStreamedArgs(args io.Reader, expected *Message) error {
+	streamed := make([]json.RawMessage, 3)
+	if err := DecodeArgs(args, []interface{}{&streamed[0], &streamed[1], &streamed[2]}); err != nil {
+		return err
+	}
+	if expected == nil {
+		return nil
+	}
+
+	decoded := make([]json.RawMessage, 3)
+	err := DecodeArgs(strings.NewReader(expected.Args+"]"),
+		[]interface{}{&decoded[0], &decoded[1], &decoded[2]})
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(streamed, decoded) {
+		return fmt.Errorf("streamed args %q, expected %q", streamed, decoded)
+	}
+	return nil
+}
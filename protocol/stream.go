@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+Decode packet read from r. Arguments of emit and ack request packets are
+not read, returned reader is positioned at them, so they can be decoded
+right from the stream. Message Source and Args are empty in that case.
+Other packets are read fully and decoded as usual, returned reader is nil.
+Returned message is taken from pool, see ReleaseMessage
+*/
+func DecodeReader(r io.Reader) (*Message, io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(commonMessage))
+	if err != nil || string(head) != commonMessage {
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg, err := Decode(string(data))
+		return msg, nil, err
+	}
+	br.Discard(len(commonMessage))
+
+	msg := AcquireMessage()
+	msg.Type = MessageTypeEmit
+
+	if next, err := br.Peek(1); err == nil && next[0] == '/' {
+		namespace, err := br.ReadString(',')
+		if err != nil {
+			ReleaseMessage(msg)
+			return nil, nil, ErrorWrongPacket
+		}
+		msg.Namespace = namespace[:len(namespace)-1]
+		if msg.Namespace == defaultNamespace {
+			msg.Namespace = ""
+		}
+	}
+
+	//optional ack id is followed by arguments array
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			ReleaseMessage(msg)
+			return nil, nil, ErrorWrongPacket
+		}
+		if b == '[' {
+			break
+		}
+		if b < '0' || b > '9' {
+			ReleaseMessage(msg)
+			return nil, nil, ErrorWrongPacket
+		}
+		msg.Type = MessageTypeAckRequest
+		msg.AckId = msg.AckId*10 + int(b-'0')
+	}
+
+	decoder := json.NewDecoder(br)
+	if err := decoder.Decode(&msg.Method); err != nil {
+		ReleaseMessage(msg)
+		return nil, nil, ErrorWrongPacket
+	}
+
+	rest := bufio.NewReader(io.MultiReader(decoder.Buffered(), br))
+	for {
+		b, err := rest.ReadByte()
+		if err != nil {
+			ReleaseMessage(msg)
+			return nil, nil, ErrorWrongPacket
+		}
+		if b == ',' {
+			break
+		}
+		if b == ']' {
+			//no arguments, rest of packet is checked by DecodeArgs
+			return msg, io.MultiReader(strings.NewReader("]"), rest), nil
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			ReleaseMessage(msg)
+			return nil, nil, ErrorWrongPacket
+		}
+	}
+
+	return msg, rest, nil
+}
+
+/**
+Decode json event arguments, comma separated and followed by closing
+bracket, to given pointers one by one. Missing arguments are kept
+as they are, extra ones are skipped. Closing bracket should end the packet
+*/
+func DecodeArgs(r io.Reader, v []interface{}) error {
+	decoder := json.NewDecoder(io.MultiReader(strings.NewReader("["), r))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	for _, arg := range v {
+		if !decoder.More() {
+			break
+		}
+		if err := decoder.Decode(arg); err != nil {
+			return err
+		}
+	}
+
+	return skipArgs(decoder)
+}
+
+/**
+Skip extra arguments token by token, so they are not kept in memory
+as a whole, and check that nothing follows closing bracket
+*/
+func skipArgs(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return ErrorWrongPacket
+		}
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return ErrorWrongPacket
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorRateLimited       = errors.New("Rate limit exceeded")
+	ErrorBandwidthExceeded = errors.New("Bandwidth limit exceeded")
+)
+
+/**
+What to do with incoming event when channel rate limit is exceeded
+*/
+type RateLimitPolicy int
+
+const (
+	/**
+	Drop event, error handler receives error wrapping ErrorRateLimited
+	*/
+	RateLimitDrop RateLimitPolicy = iota
+	/**
+	Stop reading from channel until event is allowed, events order is kept
+	*/
+	RateLimitWait
+	/**
+	Close channel, disconnection reason is the limit error
+	*/
+	RateLimitClose
+	/**
+	Put event to bounded queue of channel, queued events are processed
+	in order as limit allows, reading is not paused. Event is dropped
+	if queue is full, error handler receives error wrapping ErrorRateLimited.
+	Bandwidth limits wait as with RateLimitWait, streaming decode is not used
+	*/
+	RateLimitQueue
+)
+
+const (
+	DefaultRateLimitQueueSize = 100
+)
+
+/**
+Token bucket, refilled with rate tokens per second up to burst tokens
+*/
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+/**
+Take n tokens, returns time to wait for them if bucket has not enough.
+Request bigger than burst is allowed on full bucket, leaving it in debt
+*/
+func (b *tokenBucket) take(n float64) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	need := n
+	if need > b.burst {
+		need = b.burst
+	}
+	if b.tokens >= need {
+		b.tokens -= n
+		return 0, true
+	}
+	if b.rate <= 0 {
+		return 0, false
+	}
+
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+/**
+Wait until n tokens are taken or ctx is done
+*/
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	for {
+		delay, ok := b.take(n)
+		if ok {
+			return nil
+		}
+		if delay <= 0 {
+			return ErrorRateLimited
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/**
+Rate limiter of one channel, counts events or bytes
+*/
+type rateLimiter struct {
+	bucket *tokenBucket
+	policy RateLimitPolicy
+
+	//pending events of RateLimitQueue policy
+	queue     chan *protocol.Message
+	queueOnce sync.Once
+}
+
+func newRateLimiter(rate float64, burst int, policy RateLimitPolicy, queueSize int) *rateLimiter {
+	l := &rateLimiter{
+		bucket: newTokenBucket(rate, burst),
+		policy: policy,
+	}
+	if policy == RateLimitQueue {
+		if queueSize <= 0 {
+			queueSize = DefaultRateLimitQueueSize
+		}
+		l.queue = make(chan *protocol.Message, queueSize)
+	}
+
+	return l
+}
+
+/**
+Check that n tokens can be taken, waits for them with RateLimitWait policy
+*/
+func (l *rateLimiter) allow(ctx context.Context, n int) bool {
+	if l.policy == RateLimitWait || l.policy == RateLimitQueue {
+		return l.bucket.wait(ctx, float64(n)) == nil
+	}
+
+	_, ok := l.bucket.take(float64(n))
+	return ok
+}
+
+/**
+Change incoming events limit of this channel, e.g. higher one for authenticated
+users. Policy of server WithRateLimit option is kept, zero rate removes the limit
+*/
+func (c *Channel) SetRateLimit(rate float64, burst int) {
+	c.limiterLock.Lock()
+	defer c.limiterLock.Unlock()
+
+	if rate <= 0 {
+		c.limiter = nil
+		return
+	}
+
+	policy, queueSize := RateLimitDrop, 0
+	if c.server != nil {
+		policy, queueSize = c.server.rateLimitPolicy, c.server.rateLimitQueue
+	}
+	c.limiter = newRateLimiter(rate, burst, policy, queueSize)
+}
+
+/**
+Get current incoming events limiter, nil if events are not limited
+*/
+func (c *Channel) eventLimiter() *rateLimiter {
+	c.limiterLock.RLock()
+	defer c.limiterLock.RUnlock()
+
+	return c.limiter
+}
+
+/**
+Check that incoming event can be processed, waits for it with RateLimitWait policy
+*/
+func (c *Channel) allowIncoming() bool {
+	limiter := c.eventLimiter()
+	if limiter == nil {
+		return true
+	}
+
+	return limiter.allow(c.Context(), 1)
+}
+
+/**
+Put incoming event to queue of limiter with RateLimitQueue policy,
+returns false if queue is full. Queue is processed by its own goroutine,
+started with first queued event
+*/
+func (c *Channel) queueIncoming(m *methods, l *rateLimiter, msg *protocol.Message) bool {
+	l.queueOnce.Do(func() {
+		go c.processLimiterQueue(m, l)
+	})
+
+	select {
+	case l.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+Dispatch queued events one by one as limit allows, until channel is closed.
+Events left in queue of closed channel are discarded
+*/
+func (c *Channel) processLimiterQueue(m *methods, l *rateLimiter) {
+	for {
+		select {
+		case msg := <-l.queue:
+			if err := l.bucket.wait(c.Context(), 1); err != nil {
+				protocol.ReleaseMessage(msg)
+				return
+			}
+			c.routeIncoming(m, msg)
+		case <-c.Context().Done():
+			return
+		}
+	}
+}
+
+/**
+Check that incoming packet of given size fits channel bandwidth limit
+*/
+func (c *Channel) allowInboundBytes(size int) bool {
+	if c.inBandwidth == nil {
+		return true
+	}
+
+	return c.inBandwidth.allow(c.Context(), size)
+}
+
+/**
+Check that outgoing packet of given size fits channel bandwidth limit
+*/
+func (c *Channel) allowOutboundBytes(size int) bool {
+	if c.outBandwidth == nil {
+		return true
+	}
+
+	return c.outBandwidth.allow(c.Context(), size)
+}
+
+/**
+Check that exceeded limit closes the channel instead of dropping
+*/
+func limitCloses(l *rateLimiter) bool {
+	return l != nil && l.policy == RateLimitClose
+}
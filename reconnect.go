@@ -0,0 +1,229 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/transport"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+/**
+Client reconnection settings, delay before each attempt grows from
+InitialDelay by Multiplier up to MaxDelay
+*/
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	/**
+	Part of delay which is randomized, from 0 to 1, so clients
+	disconnected at once do not reconnect at once
+	*/
+	Jitter float64
+	/**
+	Amount of attempts after each disconnection, zero means no limit
+	*/
+	MaxAttempts int
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: time.Second,
+	Multiplier:   2,
+	MaxDelay:     30 * time.Second,
+	Jitter:       0.5,
+}
+
+/**
+Get delay before given reconnection attempt, first attempt is 1
+*/
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+/**
+Start loops of current client connection, they are tracked,
+so connection is not replaced while old loops are running
+*/
+func (c *Client) startLoops() {
+	c.loops.Add(3)
+	go func() {
+		defer c.loops.Done()
+		inLoop(&c.Channel, &c.methods)
+	}()
+	go func() {
+		defer c.loops.Done()
+		outLoop(&c.Channel, &c.methods)
+	}()
+	go func() {
+		defer c.loops.Done()
+		if c.serverPings {
+			//missing server pings mean connection is lost
+			watchdog(&c.Channel, &c.methods)
+			return
+		}
+		pinger(&c.Channel)
+	}()
+}
+
+/**
+Wait for disconnection and restore connection according to reconnect policy,
+until client is closed or attempts are exhausted
+*/
+func (c *Client) supervise() {
+	for {
+		<-c.Context().Done()
+		c.loops.Wait()
+
+		if c.isClosed() {
+			return
+		}
+		if !c.reconnect() {
+			if c.offline != nil {
+				c.offline.disable()
+			}
+			c.status.set(StatusClosed)
+			return
+		}
+	}
+}
+
+/**
+Try to connect again with the same url, preferred transport is tried first,
+returns false if client was closed or all attempts failed
+*/
+func (c *Client) reconnect() bool {
+	policy := *c.reconnectPolicy
+	hintDelay := c.takeReconnectHint()
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		delay := policy.delay(attempt)
+		if attempt == 1 && hintDelay > 0 {
+			delay = hintDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-c.closed:
+			return false
+		}
+		c.Channel.logger.Info("reconnecting", "url", c.url, "attempt", attempt)
+		c.callSystemEvent(&c.Channel, OnReconnecting, attempt)
+
+		conn, err := c.connect()
+		if err != nil {
+			c.Channel.logger.Warn("reconnection failed", "url", c.url, "attempt", attempt, "error", err)
+			c.callErrorHandler(&c.Channel, err)
+			continue
+		}
+
+		c.resetChannel(conn)
+		if c.authData != nil {
+			c.sendConnectAuth()
+		}
+		if c.Channel.namespaces != nil {
+			c.Channel.namespaces.connectAll(&c.Channel)
+		}
+		c.startLoops()
+		if c.isClosed() {
+			//closed while connecting, new connection should not be kept
+			c.Close()
+			return true
+		}
+		c.flushOffline()
+		c.callSystemEvent(&c.Channel, OnReconnected, attempt)
+		return true
+	}
+
+	c.Channel.logger.Error("reconnection attempts exhausted", "url", c.url)
+	c.callSystemEvent(&c.Channel, OnReconnectFailed)
+	return false
+}
+
+/**
+Call handler of client event with given arguments, handler can omit them,
+arguments of other types are passed as empty values
+*/
+func (m *methods) callSystemEvent(c *Channel, event string, args ...interface{}) {
+	defer m.recoverPanic(c)
+
+	f, ok := m.findMethod(event)
+	if !ok {
+		return
+	}
+
+	data := f.getArgs()
+	for i := 0; i < len(data) && i < len(args); i++ {
+		param := reflect.ValueOf(data[i]).Elem()
+		value := reflect.ValueOf(args[i])
+		if value.Type().AssignableTo(param.Type()) {
+			param.Set(value)
+		}
+	}
+
+	if err := f.getError(f.callFunc(c, data)); err != nil {
+		m.callErrorHandler(c, err)
+	}
+}
+
+/**
+Check that client was closed by Close, so it should not be reconnected
+*/
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+Make closed channel alive again with new connection, session and
+handlers are kept, connection state is reset
+*/
+func (c *Channel) resetChannel(conn transport.Connection) {
+	c.connLock.Lock()
+	c.conn = conn
+	c.connLock.Unlock()
+
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	for len(c.out) > 0 {
+		<-c.out
+	}
+	c.header = Header{}
+	c.connected = false
+	c.connectError = nil
+	c.closing = false
+	c.ctxLock.Lock()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.ctxLock.Unlock()
+
+	c.lastActivityLock.Lock()
+	c.lastActivity = time.Now()
+	c.connectedAt = c.lastActivity
+	c.lastMessage = c.lastActivity
+	c.lastActivityLock.Unlock()
+
+	c.disconnectReasonLock.Lock()
+	c.disconnectReason = nil
+	c.kickReason = nil
+	c.disconnectReasonLock.Unlock()
+
+	c.written.reset()
+	c.alive = true
+}
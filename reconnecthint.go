@@ -0,0 +1,112 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	//event sent to clients by draining or shutting down server,
+	//see WithReconnectHint
+	OnReconnectHint = "reconnect-hint"
+
+	//time to write reconnect hint before connection is closed by Shutdown
+	reconnectHintTimeout = time.Second
+)
+
+var (
+	ErrorReconnectHint = errors.New("Reconnect requested by server")
+)
+
+/**
+Reconnect hint sent to clients when server is drained or shut down,
+so they reconnect in a controlled way, e.g. during node rotation
+*/
+type ReconnectHint struct {
+	//alternate endpoint, same url form as Dial one, current url is used if empty
+	Url string `json:"url,omitempty"`
+	//delay before reconnection in milliseconds, reconnect policy delay if zero
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+/**
+Send reconnect hint to all channels if it is set
+*/
+func (s *Server) sendReconnectHint() {
+	if s.reconnectHint == nil {
+		return
+	}
+
+	for _, c := range s.channelsSnapshot() {
+		go c.Emit(OnReconnectHint, s.reconnectHint)
+	}
+}
+
+/**
+Send reconnect hint to all channels if it is set, and wait
+until it is written, so it is not dropped by closing
+*/
+func (s *Server) flushReconnectHint() {
+	if s.reconnectHint == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range s.channelsSnapshot() {
+		wg.Add(1)
+		go func(c *Channel) {
+			defer wg.Done()
+			if c.Emit(OnReconnectHint, s.reconnectHint) == nil {
+				c.flush(reconnectHintTimeout)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+/**
+Client side of reconnect hint: connection is closed after hint delay,
+so it is restored by reconnect policy, with hint url if it is set
+*/
+func (c *Client) interceptReconnectHint(ch *Channel, msg *protocol.Message) error {
+	if msg.Method != OnReconnectHint || msg.Type != protocol.MessageTypeEmit {
+		return nil
+	}
+
+	hint := &ReconnectHint{}
+	if err := ch.parser.Unmarshal(msg.Args, hint); err != nil {
+		return nil
+	}
+
+	c.hintLock.Lock()
+	c.hint = hint
+	c.hintLock.Unlock()
+
+	c.Channel.logger.Info("reconnect hint", "url", hint.Url, "retryAfter", hint.RetryAfter)
+	closeChannel(&c.Channel, &c.methods, ErrorReconnectHint)
+	return nil
+}
+
+/**
+Take reconnect hint received before disconnection, url is switched to hint one.
+Returns delay of the first reconnection attempt, zero if it is not set
+*/
+func (c *Client) takeReconnectHint() time.Duration {
+	c.hintLock.Lock()
+	hint := c.hint
+	c.hint = nil
+	c.hintLock.Unlock()
+
+	if hint == nil {
+		return 0
+	}
+	if hint.Url != "" {
+		c.url = hint.Url
+		if c.Channel.chunkSize > 0 {
+			c.url = withChunksParam(c.url)
+		}
+	}
+	return time.Duration(hint.RetryAfter) * time.Millisecond
+}
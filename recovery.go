@@ -0,0 +1,242 @@
+package gosocketio
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	RecoverSidParam   = "recover_sid"
+	RecoverTokenParam = "recover_token"
+
+	HeaderRecoverSid   = "X-Recover-Sid"
+	HeaderRecoverToken = "X-Recover-Token"
+
+	//random bytes of recovery token
+	recoveryTokenSize = 32
+)
+
+/**
+Event, broadcasted while channel was disconnected
+*/
+type missedEvent struct {
+	method string
+	args   interface{}
+}
+
+/**
+State of disconnected channel, kept during recovery window
+*/
+type recoverySession struct {
+	sid     string
+	token   string
+	rooms   map[string]struct{}
+	values  map[string]interface{}
+	missed  []missedEvent
+	expires time.Time
+}
+
+/**
+Connection state recovery: rooms and missed broadcasts of disconnected
+channels are kept for a while, so reconnected client can continue
+*/
+type recoveryStore struct {
+	window     time.Duration
+	bufferSize int
+
+	sessions map[string]*recoverySession
+	lock     sync.Mutex
+}
+
+func newRecoveryStore(window time.Duration, bufferSize int) *recoveryStore {
+	return &recoveryStore{
+		window:     window,
+		bufferSize: bufferSize,
+		sessions:   make(map[string]*recoverySession),
+	}
+}
+
+/**
+Build recovery store after all options are applied,
+if connection recovery or session resumption is enabled
+*/
+func (s *Server) initRecovery() {
+	if s.recoveryWindow <= 0 && !s.resumeSessions {
+		return
+	}
+
+	window := s.recoveryWindow
+	if s.resumeGrace > window {
+		window = s.resumeGrace
+	}
+	s.recovery = newRecoveryStore(window, s.recoveryBuffer)
+}
+
+/**
+Keep state of disconnected channel
+*/
+func (r *recoveryStore) save(c *Channel, rooms []string) {
+	session := &recoverySession{
+		sid:     c.Id(),
+		token:   c.RecoveryToken(),
+		rooms:   make(map[string]struct{}, len(rooms)),
+		values:  c.sessionValues(),
+		expires: time.Now().Add(r.window),
+	}
+	for _, room := range rooms {
+		session.rooms[room] = struct{}{}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.prune()
+	r.sessions[session.sid] = session
+}
+
+/**
+Store broadcast for disconnected channels joined to any of given rooms,
+empty room means broadcast to all
+*/
+func (r *recoveryStore) record(rooms []string, method string, args interface{}) {
+	if r.bufferSize <= 0 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.prune()
+
+	for _, session := range r.sessions {
+		if !session.joinedAny(rooms) {
+			continue
+		}
+
+		//bounded buffer, oldest events are dropped
+		if len(session.missed) >= r.bufferSize {
+			session.missed = session.missed[1:]
+		}
+		session.missed = append(session.missed, missedEvent{method, args})
+	}
+}
+
+/**
+Generate recovery token from crypto random bytes, so it can not be guessed.
+Empty token is returned if random source fails, channel is not recoverable then
+*/
+func newRecoveryToken() (string, error) {
+	token := make([]byte, recoveryTokenSize)
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+/**
+Take state of disconnected channel, if sid and token are correct
+and recovery window is not expired yet
+*/
+func (r *recoveryStore) take(sid, token string) (*recoverySession, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.prune()
+
+	session, ok := r.sessions[sid]
+	if !ok || subtle.ConstantTimeCompare([]byte(session.token), []byte(token)) != 1 {
+		return nil, false
+	}
+	delete(r.sessions, sid)
+
+	return session, true
+}
+
+/**
+Remove expired sessions, should be called under lock
+*/
+func (r *recoveryStore) prune() {
+	now := time.Now()
+	for sid, session := range r.sessions {
+		if now.After(session.expires) {
+			delete(r.sessions, sid)
+		}
+	}
+}
+
+func (s *recoverySession) joinedAny(rooms []string) bool {
+	for _, room := range rooms {
+		if room == "" {
+			return true
+		}
+		if _, ok := s.rooms[room]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+Find state of previous connection, sid and token are taken from query
+params or, if absent, from request headers
+*/
+func (s *Server) takeRecoverySession(r *http.Request) *recoverySession {
+	query := r.URL.Query()
+	sid, token := query.Get(RecoverSidParam), query.Get(RecoverTokenParam)
+	if sid == "" || token == "" {
+		sid, token = r.Header.Get(HeaderRecoverSid), r.Header.Get(HeaderRecoverToken)
+	}
+	if sid == "" || token == "" {
+		return nil
+	}
+
+	session, ok := s.recovery.take(sid, token)
+	if !ok {
+		return nil
+	}
+
+	return session
+}
+
+/**
+Restore rooms, session values if resumption is enabled,
+and deliver missed events to reconnected channel
+*/
+func (s *Server) recoverChannel(c *Channel, session *recoverySession) {
+	if s.resumeSessions {
+		for key, value := range session.values {
+			c.Set(key, value)
+		}
+	}
+	for room := range session.rooms {
+		c.Join(room)
+	}
+	for _, event := range session.missed {
+		c.Emit(event.method, event.args)
+	}
+	c.recovered = true
+}
+
+/**
+Check that channel state was recovered from previous connection,
+resumed channels also keep previous sid, see WithSessionResumption
+*/
+func (c *Channel) Recovered() bool {
+	return c.recovered
+}
+
+/**
+Get token to recover this channel state after reconnection, empty
+if recovery is disabled. Pass previous sid and token as query params
+RecoverSidParam and RecoverTokenParam when reconnecting
+*/
+func (c *Channel) RecoveryToken() string {
+	return c.header.RecoveryToken
+}
@@ -0,0 +1,168 @@
+package gosocketio
+
+import (
+	"errors"
+	"github.com/graarh/golang-socketio/protocol"
+	"time"
+)
+
+const (
+	DefaultReliableWindow = 16
+)
+
+var (
+	ErrorDeliveryExpired = errors.New("Delivery expired")
+)
+
+/**
+Settings of reliable emits, see EmitReliable. Delay before each retry grows
+from InitialDelay by Multiplier up to MaxDelay, zero values are taken
+from DefaultReliablePolicy
+*/
+type ReliablePolicy struct {
+	//max amount of not acknowledged reliable emits of channel
+	Window       int
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	//emit is not retried after ttl, EmitReliable returns ErrorDeliveryExpired
+	TTL time.Duration
+}
+
+var DefaultReliablePolicy = ReliablePolicy{
+	Window:       DefaultReliableWindow,
+	InitialDelay: time.Second,
+	Multiplier:   2,
+	MaxDelay:     10 * time.Second,
+	TTL:          time.Minute,
+}
+
+/**
+Fill not set values with default ones
+*/
+func (p ReliablePolicy) withDefaults() ReliablePolicy {
+	if p.Window <= 0 {
+		p.Window = DefaultReliablePolicy.Window
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultReliablePolicy.InitialDelay
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultReliablePolicy.Multiplier
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultReliablePolicy.MaxDelay
+	}
+	if p.TTL <= 0 {
+		p.TTL = DefaultReliablePolicy.TTL
+	}
+	return p
+}
+
+/**
+Get delay before next retry
+*/
+func (p ReliablePolicy) nextDelay(delay time.Duration) time.Duration {
+	delay = time.Duration(float64(delay) * p.Multiplier)
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+/**
+Emit event with at-least-once delivery: it is sent as ack request and
+retried with backoff until remote side acknowledges it or policy ttl
+expires, ErrorDeliveryExpired is returned then. Retries carry the same
+ack id, which is message id for deduplication on remote side.
+Not more than policy window reliable emits of channel are in flight,
+others wait for free slot. Retries of reconnecting client continue
+after reconnection, other channels return ErrorChannelClosed when closed
+*/
+func (c *Channel) EmitReliable(method string, args ...interface{}) (string, error) {
+	policy := c.reliablePolicy.withDefaults()
+	expired := time.NewTimer(policy.TTL)
+	defer expired.Stop()
+
+	c.reliableOnce.Do(func() {
+		c.reliableWindow = make(chan struct{}, policy.Window)
+	})
+	select {
+	case c.reliableWindow <- struct{}{}:
+	case <-expired.C:
+		return "", ErrorDeliveryExpired
+	}
+	defer func() {
+		<-c.reliableWindow
+	}()
+
+	packed, err := c.callEmitMiddlewares(method, packArgs(args))
+	if err != nil {
+		return "", err
+	}
+
+	ackId := c.ack.getNextId()
+	//buffered, so late response does not block incoming message processing
+	waiter := make(chan string, 1)
+	defer c.ack.removeWaiter(ackId)
+
+	for delay := policy.InitialDelay; ; delay = policy.nextDelay(delay) {
+		//waiters are cleared on disconnection
+		c.ack.addWaiter(ackId, waiter)
+
+		//message is encoded and encrypted for every attempt
+		msg := &protocol.Message{
+			Type:   protocol.MessageTypeAckRequest,
+			AckId:  ackId,
+			Method: method,
+		}
+		err := send(msg, c, packed)
+		if err != nil && err != ErrorSocketOverflood && !c.reconnectable {
+			return "", err
+		}
+
+		if result, ok, err := c.waitReliable(waiter, delay, expired.C); ok || err != nil {
+			return result, err
+		}
+	}
+}
+
+/**
+Wait for ack of reliable emit until retry delay passes, returns false
+if it should be retried
+*/
+func (c *Channel) waitReliable(waiter chan string, delay time.Duration,
+	expired <-chan time.Time) (string, bool, error) {
+
+	retry := time.NewTimer(delay)
+	defer retry.Stop()
+
+	closed := c.closedSignal()
+	for {
+		select {
+		case result := <-waiter:
+			return result, true, nil
+		case <-closed:
+			if !c.reconnectable {
+				return "", false, ErrorChannelClosed
+			}
+			//reconnecting client retries after delay
+			closed = nil
+		case <-retry.C:
+			return "", false, nil
+		case <-expired:
+			return "", false, ErrorDeliveryExpired
+		}
+	}
+}
+
+/**
+Get signal of current connection close, connection of reconnecting
+client is replaced
+*/
+func (c *Channel) closedSignal() <-chan struct{} {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.Context().Done()
+}
@@ -0,0 +1,119 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"strings"
+)
+
+/**
+Group of event handlers with shared middlewares, mounted under event name
+prefix onto server, client or other router, e.g.
+
+	game := gosocketio.NewRouter()
+	game.On("join", onJoin)
+	server.Mount("game.", game)
+
+handles "game.join" events. Handlers can be added after mounting
+*/
+type Router struct {
+	m methods
+}
+
+type mountedRouter struct {
+	prefix string
+	router *Router
+}
+
+/**
+Create empty router
+*/
+func NewRouter() *Router {
+	r := &Router{}
+	r.m.initMethods()
+	return r
+}
+
+/**
+Add event processing function, method is event name without router
+prefix, can be glob pattern, see Server.On
+*/
+func (r *Router) On(method string, f interface{}) error {
+	return r.m.On(method, f)
+}
+
+/**
+Add event processing function, that is removed after first call
+*/
+func (r *Router) Once(method string, f interface{}) error {
+	return r.m.Once(method, f)
+}
+
+/**
+Receive stream transfers of given method, see Server.OnStream
+*/
+func (r *Router) OnStream(method string, f StreamHandler) error {
+	return r.m.OnStream(method, f)
+}
+
+/**
+Remove event processing function, bound to given method
+*/
+func (r *Router) Off(method string) {
+	r.m.Off(method)
+}
+
+/**
+Add middleware, called for events of this router only, after middlewares
+of routers it is mounted onto. Message method is full event name
+*/
+func (r *Router) Use(f Middleware) {
+	r.m.Use(f)
+}
+
+/**
+Mount sub-router under given prefix, relative to prefix of this router
+*/
+func (r *Router) Mount(prefix string, sub *Router) {
+	r.m.Mount(prefix, sub)
+}
+
+/**
+Mount router under given event name prefix. Events without own handler
+are passed to routers with matching prefix in the order they were mounted
+*/
+func (m *methods) Mount(prefix string, r *Router) {
+	m.messageHandlersLock.Lock()
+	defer m.messageHandlersLock.Unlock()
+
+	m.routers = append(m.routers, mountedRouter{prefix: prefix, router: r})
+}
+
+/**
+Call middlewares and find processing function of incoming event, given
+event is method without prefixes of routers passed. Returns middleware
+error, or nil function if event has no processing function
+*/
+func (m *methods) routeEvent(c *Channel, msg *protocol.Message, event string) (*caller, error) {
+	if err := m.callMiddlewares(c, msg); err != nil {
+		return nil, err
+	}
+
+	if f, ok := m.findEventMethod(msg.Type, event); ok {
+		return f, nil
+	}
+
+	m.messageHandlersLock.RLock()
+	var route mountedRouter
+	for _, r := range m.routers {
+		if strings.HasPrefix(event, r.prefix) {
+			route = r
+			break
+		}
+	}
+	m.messageHandlersLock.RUnlock()
+
+	if route.router == nil {
+		return nil, nil
+	}
+	return route.router.m.routeEvent(c, msg, strings.TrimPrefix(event, route.prefix))
+}
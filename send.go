@@ -1,44 +1,190 @@
 package gosocketio
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"github.com/graarh/golang-socketio/protocol"
-	"log"
 	"time"
 )
 
+const (
+	DefaultOverflowTimeout = 5 * time.Second
+)
+
 var (
 	ErrorSendTimeout     = errors.New("Timeout")
 	ErrorSocketOverflood = errors.New("Socket overflood")
+	ErrorMessageDropped  = errors.New("Message dropped")
+	ErrorChannelClosed   = errors.New("Channel closed")
+)
+
+/**
+What to do when outgoing queue of channel is full
+*/
+type OverflowPolicy int
+
+const (
+	/**
+	Close channel with ErrorSocketOverflood, default policy
+	*/
+	OverflowClose OverflowPolicy = iota
+	/**
+	Drop message being sent, Emit returns ErrorSocketOverflood
+	*/
+	OverflowDropNewest
+	/**
+	Drop the oldest queued message to make room for the new one
+	*/
+	OverflowDropOldest
+	/**
+	Wait for free room in queue up to overflow timeout,
+	Emit returns ErrorSocketOverflood on timeout
+	*/
+	OverflowBlock
 )
 
 /**
-Send message packet to socket
+Send message packet to socket. Returns ErrorMessageDropped if message
+can not be delivered: encoding panicked, server is shut down or channel
+was closed while message was queued
 */
 func send(msg *protocol.Message, c *Channel, args interface{}) error {
+	return sendContext(context.Background(), msg, c, args)
+}
+
+/**
+Same as send, but waits for room in outgoing queue until ctx is done
+if ctx can be done, overflow policy is used otherwise
+*/
+func sendContext(ctx context.Context, msg *protocol.Message, c *Channel, args interface{}) (err error) {
+	//callback of packet which is not queued is called with send error
+	written := writeCallbackOf(ctx)
+	defer func() {
+		if err != nil && written != nil {
+			written(err)
+		}
+	}()
+
 	//preventing json/encoding "index out of range" panic
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("socket.io send panic: ", r)
+			c.logger.Error("send panic", "sid", c.Id(), "method", msg.Method, "panic", r)
+			err = ErrorMessageDropped
 		}
 	}()
 
+	if !c.canSend() {
+		return ErrorChannelClosed
+	}
+	if c.server != nil && c.server.IsShutdown() {
+		return ErrorMessageDropped
+	}
+
 	if args != nil {
-		json, err := json.Marshal(&args)
+		encoded, err := marshalArgs(c.eventParser(msg.Method), args)
 		if err != nil {
 			return err
 		}
 
-		msg.Args = string(json)
+		msg.Args = encoded
+	}
+	if err := c.encryptArgs(msg); err != nil {
+		return err
+	}
+
+	command, err := c.parser.Encode(msg)
+	if err != nil {
+		return err
 	}
 
-	command, err := protocol.Encode(msg)
+	if c.shouldChunk(command) {
+		err = c.enqueueChunks(ctx, command)
+	} else {
+		err = c.enqueueContext(ctx, markCompression(ctx, command))
+	}
 	if err != nil {
+		c.observeDropped(err)
 		return err
 	}
+	if written != nil {
+		c.enqueueWriteCallback(ctx, written)
+		//queued packet callback is called by write loop or on close
+		written = nil
+	}
+
+	//queued messages are discarded when channel is closed
+	if !c.IsAlive() {
+		return ErrorMessageDropped
+	}
 
-	if len(c.out) == queueBufferSize {
+	return nil
+}
+
+/**
+Put encoded packet to outgoing queue, waiting for room until ctx is done.
+Overflow policy is used if ctx can not be done
+*/
+func (c *Channel) enqueueContext(ctx context.Context, command string) error {
+	if ctx.Done() == nil {
+		return c.enqueue(command)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case c.out <- command:
+		return nil
+	case <-c.Context().Done():
+		return ErrorChannelClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+Put encoded packet to outgoing queue, according to overflow policy
+*/
+func (c *Channel) enqueue(command string) error {
+	switch c.overflowPolicy {
+	case OverflowDropNewest:
+		select {
+		case c.out <- command:
+			return nil
+		default:
+			return ErrorSocketOverflood
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.out <- command:
+				return nil
+			default:
+			}
+
+			select {
+			case dropped := <-c.out:
+				if dropped == protocol.CloseMessage {
+					//channel is closing, keep the close marker for outLoop
+					c.out <- dropped
+					return ErrorSocketOverflood
+				}
+				c.observeDropped(ErrorSocketOverflood)
+			default:
+			}
+		}
+	case OverflowBlock:
+		select {
+		case c.out <- command:
+			return nil
+		case <-c.Context().Done():
+			return ErrorSocketOverflood
+		case <-time.After(c.overflowTimeout):
+			return ErrorSocketOverflood
+		}
+	}
+
+	if len(c.out) == cap(c.out) {
 		return ErrorSocketOverflood
 	}
 
@@ -48,40 +194,180 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 }
 
 /**
-Create packet based on given data and send it
+Outgoing emit middleware, called for every event sent by server channels,
+including broadcasts. Returns args to send, which can be modified,
+returned error vetoes the event and is returned by Emit.
+Several positional arguments are passed as Args
 */
-func (c *Channel) Emit(method string, args interface{}) error {
+type EmitMiddleware func(c *Channel, method string, args interface{}) (interface{}, error)
+
+/**
+Add outgoing emit middleware, middlewares are called in the order they were added
+*/
+func (s *Server) UseEmit(f EmitMiddleware) {
+	s.emitMiddlewaresLock.Lock()
+	defer s.emitMiddlewaresLock.Unlock()
+
+	s.emitMiddlewares = append(s.emitMiddlewares, f)
+}
+
+/**
+Run outgoing middlewares chain of channel server, stops on first error
+*/
+func (c *Channel) callEmitMiddlewares(method string, args interface{}) (interface{}, error) {
+	if c.server == nil {
+		return args, nil
+	}
+
+	c.server.emitMiddlewaresLock.RLock()
+	middlewares := c.server.emitMiddlewares
+	c.server.emitMiddlewaresLock.RUnlock()
+
+	var err error
+	for _, f := range middlewares {
+		if args, err = f(c, method, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+/**
+Create packet based on given data and send it, several arguments are sent
+as positional event arguments. Returns ErrorChannelClosed right away
+if channel is not alive, unless client queues events while reconnecting,
+see DialWithOfflineBuffer
+*/
+func (c *Channel) Emit(method string, args ...interface{}) error {
+	return c.EmitContext(context.Background(), method, args...)
+}
+
+/**
+Same as Emit, but waits for room in outgoing queue until given context
+is done, returns ctx.Err() in that case
+*/
+func (c *Channel) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	//channel can be closed between broadcast alive check and emit
+	if !c.canSend() {
+		if c.offline != nil && !c.IsAlive() {
+			return c.offline.push(method, args)
+		}
+		return ErrorChannelClosed
+	}
+
+	return c.emitNamespace(ctx, "", method, args)
+}
+
+/**
+Send event to given namespace, empty for default one
+*/
+func (c *Channel) emitNamespace(ctx context.Context, namespace, method string, args []interface{}) error {
 	msg := &protocol.Message{
-		Type:   protocol.MessageTypeEmit,
-		Method: method,
+		Type:      protocol.MessageTypeEmit,
+		Method:    method,
+		Namespace: namespace,
+	}
+
+	packed, err := c.callEmitMiddlewares(method, packArgs(args))
+	if err != nil {
+		return err
 	}
 
-	return send(msg, c, args)
+	if c.sequenced {
+		c.sequenceOrder.Lock()
+		defer c.sequenceOrder.Unlock()
+	}
+	return sendContext(ctx, msg, c, c.stampSequence(method, packed))
 }
 
 /**
 Create ack packet based on given data and send it and receive response
 */
 func (c *Channel) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := c.AckContext(ctx, method, args)
+	if err == context.DeadlineExceeded {
+		return "", ErrorSendTimeout
+	}
+
+	return result, err
+}
+
+/**
+Decode ack result to given pointers, one for each of returned values
+*/
+func (c *Channel) UnmarshalAck(result string, v ...interface{}) error {
+	return unmarshalArgs(c.parser, result, v)
+}
+
+/**
+Same as Ack, but waits for room in outgoing queue and for response
+until given context is done, returns ctx.Err() in that case.
+Response is not waited longer than ack timeout, *AckTimeoutError
+is returned then. Returns ErrorChannelClosed if channel is closed while waiting
+*/
+func (c *Channel) AckContext(ctx context.Context, method string, args interface{}) (string, error) {
+	return c.ackNamespace(ctx, "", method, args)
+}
+
+/**
+Send ack request to given namespace, empty for default one, and wait for response
+*/
+func (c *Channel) ackNamespace(ctx context.Context, namespace, method string,
+	args interface{}) (result string, err error) {
+
+	if !c.canSend() {
+		return "", ErrorChannelClosed
+	}
+	closed := c.Context().Done()
+	if c.tracer != nil {
+		var end func(error)
+		ctx, end = c.tracer.StartAck(ctx, c, method)
+		defer func() {
+			end(err)
+		}()
+	}
+
 	msg := &protocol.Message{
-		Type:   protocol.MessageTypeAckRequest,
-		AckId:  c.ack.getNextId(),
-		Method: method,
+		Type:      protocol.MessageTypeAckRequest,
+		AckId:     c.ack.getNextId(),
+		Method:    method,
+		Namespace: namespace,
 	}
 
-	waiter := make(chan string)
+	args, err = c.callEmitMiddlewares(method, args)
+	if err != nil {
+		return "", err
+	}
+
+	//buffered, so late response does not block incoming message processing
+	waiter := make(chan string, 1)
 	c.ack.addWaiter(msg.AckId, waiter)
+	defer c.ack.removeWaiter(msg.AckId)
 
-	err := send(msg, c, args)
+	err = sendContext(ctx, msg, c, args)
 	if err != nil {
-		c.ack.removeWaiter(msg.AckId)
+		return "", err
+	}
+
+	var expired <-chan time.Time
+	if c.ackTimeout > 0 {
+		timer := time.NewTimer(c.ackTimeout)
+		defer timer.Stop()
+		expired = timer.C
 	}
 
 	select {
 	case result := <-waiter:
 		return result, nil
-	case <-time.After(timeout):
-		c.ack.removeWaiter(msg.AckId)
-		return "", ErrorSendTimeout
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-closed:
+		return "", ErrorChannelClosed
+	case <-expired:
+		return "", &AckTimeoutError{Method: method, AckId: msg.AckId, Timeout: c.ackTimeout}
 	}
 }
@@ -0,0 +1,107 @@
+package gosocketio
+
+import (
+	"encoding/json"
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Function receiving sequence gap of incoming events, events from expected
+to received-1 were dropped by server, e.g. because of queue overflow
+or broadcast policy, so client should request resync. See DialWithSequenceCheck
+*/
+type SequenceGapHandler func(c *Channel, expected, received uint64)
+
+/**
+Stamp outgoing event with next sequence number of channel, it is sent
+as the last event argument. Args are not changed if sequence numbers
+are disabled or parser does not support several arguments
+*/
+func (c *Channel) stampSequence(method string, args interface{}) interface{} {
+	if !c.sequenced {
+		return args
+	}
+	if _, ok := c.eventParser(method).(protocol.MultiArgsParser); !ok {
+		return args
+	}
+
+	c.sequenceLock.Lock()
+	c.sequence++
+	seq := c.sequence
+	c.sequenceLock.Unlock()
+
+	switch v := args.(type) {
+	case nil:
+		return Args{seq}
+	case Args:
+		stamped := make(Args, len(v), len(v)+1)
+		copy(stamped, v)
+		return append(stamped, seq)
+	}
+	return Args{args, seq}
+}
+
+/**
+Skip sequence number of event which is not sent, so client sees the gap
+*/
+func (c *Channel) skipSequence() {
+	if !c.sequenced {
+		return
+	}
+
+	c.sequenceLock.Lock()
+	c.sequence++
+	c.sequenceLock.Unlock()
+}
+
+/**
+Get sequence number of the last event sent by channel, see WithSequenceNumbers
+*/
+func (c *Channel) Sequence() uint64 {
+	c.sequenceLock.Lock()
+	defer c.sequenceLock.Unlock()
+
+	return c.sequence
+}
+
+/**
+Get sequence number of the last event received by client,
+see DialWithSequenceCheck
+*/
+func (c *Channel) ReceivedSequence() uint64 {
+	c.sequenceLock.Lock()
+	defer c.sequenceLock.Unlock()
+
+	return c.received
+}
+
+/**
+Check sequence number of incoming emit in arrival order, called by read loop.
+Sequence starting over means new server channel, e.g. after reconnection
+*/
+func (c *Channel) checkSequence(msg *protocol.Message) {
+	if c.sequenceGap == nil || msg.Type != protocol.MessageTypeEmit {
+		return
+	}
+
+	var args []json.RawMessage
+	if err := json.Unmarshal([]byte("["+msg.Args+"]"), &args); err != nil || len(args) == 0 {
+		return
+	}
+	var received uint64
+	if err := json.Unmarshal(args[len(args)-1], &received); err != nil || received == 0 {
+		return
+	}
+
+	c.sequenceLock.Lock()
+	expected := c.received + 1
+	if received < expected {
+		expected = 1
+	}
+	c.received = received
+	c.sequenceLock.Unlock()
+
+	if received > expected {
+		c.sequenceGap(c, expected, received)
+	}
+}
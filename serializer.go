@@ -0,0 +1,95 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+)
+
+/**
+Serializers of event arguments registered by OnWith, shared by handlers
+and channels
+*/
+type eventSerializers struct {
+	serializers map[string]protocol.Serializer
+	lock        sync.RWMutex
+}
+
+func (s *eventSerializers) set(method string, serializer protocol.Serializer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.serializers == nil {
+		s.serializers = make(map[string]protocol.Serializer)
+	}
+	s.serializers[method] = serializer
+}
+
+func (s *eventSerializers) get(method string) protocol.Serializer {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.serializers[method]
+}
+
+/**
+Parser encoding arguments by given serializer, packets are encoded by wrapped one
+*/
+type serializerParser struct {
+	protocol.Parser
+	serializer protocol.Serializer
+}
+
+func (p serializerParser) Marshal(v interface{}) (string, error) {
+	data, err := p.serializer.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (p serializerParser) Unmarshal(data string, v interface{}) error {
+	return p.serializer.Unmarshal([]byte(data), v)
+}
+
+/**
+Add message processing function, arguments of event are encoded and decoded
+by given serializer instead of parser ones, in both directions: incoming
+events, ack results and emitted events with this name. Serializer output
+should fit packet format, e.g. be json for default parser
+*/
+func (m *methods) OnWith(method string, f interface{}, serializer protocol.Serializer) error {
+	if err := m.On(method, f); err != nil {
+		return err
+	}
+
+	m.serializers.set(method, serializer)
+	return nil
+}
+
+/**
+Get parser of arguments of given event
+*/
+func (c *Channel) eventParser(method string) protocol.Parser {
+	return c.serializers.parserOf(c.parser, method)
+}
+
+/**
+Get parser of arguments of given event, wrapping packet parser
+if event has own serializer
+*/
+func (s *eventSerializers) parserOf(parser protocol.Parser, method string) protocol.Parser {
+	if s == nil || method == "" {
+		return parser
+	}
+
+	serializer := s.get(method)
+	if serializer == nil {
+		return parser
+	}
+	if _, ok := parser.(protocol.JsonParser); ok {
+		//keeps multiple arguments support
+		return protocol.JsonParser{Serializer: serializer}
+	}
+	return serializerParser{parser, serializer}
+}
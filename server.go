@@ -2,6 +2,7 @@ package gosocketio
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
@@ -11,19 +12,53 @@ import (
 	"github.com/graarh/golang-socketio/transport"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
 	"sync"
 	"time"
 )
 
 const (
 	HeaderForward = "X-Forwarded-For"
+
+	upgradeProbe   = "probe"
+	upgradeTimeout = 10 * time.Second
+
+	//max payload of engine.io v4 clients if max message size is not set
+	defaultMaxPayload = 1000000
 )
 
 var (
 	ErrorServerNotSet       = errors.New("Server not set")
 	ErrorConnectionNotFound = errors.New("Connection not found")
+	ErrorUpgradeNotAllowed  = errors.New("Upgrade not allowed")
+	ErrorTransportUnknown   = errors.New("Transport unknown")
+	ErrorProtocolVersion    = errors.New("Unsupported protocol version")
+	ErrorUpgradeFailed      = errors.New("Upgrade failed")
+	ErrorServerDraining     = errors.New("Server is draining")
+	ErrorServerShutdown     = errors.New("Server is shut down")
+	ErrorTooManyConnections = errors.New("Too many connections")
 )
 
+/**
+Handshake authentication function, called before connection upgrade.
+Returned error rejects the connection with 401 status, *HandshakeError one
+with its own status and json body, *ConnectError one is sent to client
+as error packet. Value is available as Channel.Auth()
+*/
+type AuthHandler func(r *http.Request) (interface{}, error)
+
+/**
+Connection id generator, called with handshake request of every new connection.
+Generated ids should be unique and hard to guess
+*/
+type IDGenerator func(r *http.Request) string
+
+/**
+Room membership change handler
+*/
+type RoomHandler func(room string, c *Channel)
+
 /**
 socket.io server instance
 */
@@ -31,14 +66,110 @@ type Server struct {
 	methods
 	http.Handler
 
-	channels     map[string]map[*Channel]struct{}
-	rooms        map[*Channel]map[string]struct{}
-	channelsLock sync.RWMutex
+	sids *sidMap
+
+	tr     transport.Transport
+	parser protocol.Parser
+	//transports chosen by transport query parameter, see WithTransport
+	transports map[string]transport.Transport
+	//accepted engine.io versions, any if empty
+	protocolVersions map[int]struct{}
+	adapter          Adapter
+	//custom namespaces, see Of and OfPattern
+	namespaces namespaceRegistry
+
+	authHandler   AuthHandler
+	originChecker CheckOriginFunc
+	//any origin is allowed without credentials, see WithAllowedOrigins
+	anyOrigin   bool
+	idGenerator IDGenerator
+
+	emitMiddlewares     []EmitMiddleware
+	emitMiddlewaresLock sync.RWMutex
+
+	onRoomJoin  RoomHandler
+	onRoomLeave RoomHandler
+
+	disconnectHooks     []systemHandler
+	disconnectHooksLock sync.RWMutex
+	connectHooks        []systemHandler
+	connectHooksLock    sync.RWMutex
+
+	roomMessages     map[string]uint64
+	roomMessagesLock sync.Mutex
+
+	queueSize       int
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+
+	rateLimit       float64
+	rateLimitBurst  int
+	rateLimitPolicy RateLimitPolicy
+	rateLimitQueue  int
+
+	controlWriteTimeout time.Duration
+	dataWriteTimeout    time.Duration
+
+	maxMessageSize     int
+	streamDecode       bool
+	skipUnknownPackets bool
+	decodeTolerance    int
+
+	//server sends pings, as engine.io v4 does
+	serverPings bool
+
+	//time given to channel cleanup on Shutdown, see WithForceCloseTimeout
+	forceCloseTimeout time.Duration
+	//channels without incoming packets but heartbeats are closed, see WithIdleTimeout
+	idleTimeout time.Duration
+	//engine.io v4 channels without connect packet are closed, see WithConnectTimeout
+	connectTimeout time.Duration
+
+	//override ping params of transports, see WithPingInterval
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	goroutines goroutineCounters
+
+	packetDebug int
+
+	tracer Tracer
 
-	sids     map[string]*Channel
-	sidsLock sync.RWMutex
+	connectAuthHandler ConnectAuthHandler
 
-	tr transport.Transport
+	outgoingTransforms []OutgoingTransform
+
+	ackTimeout time.Duration
+
+	tags tagIndex
+
+	workers *workerPool
+
+	broadcastPolicy *BroadcastPolicy
+	reconnectHint   *ReconnectHint
+	sticky          *StickySession
+	reliablePolicy  ReliablePolicy
+	sequenceNumbers bool
+	chunkSize       int
+
+	inboundBandwidth  int
+	outboundBandwidth int
+	bandwidthPolicy   RateLimitPolicy
+
+	maxConnections   int64
+	onMaxConnections http.HandlerFunc
+
+	draining  bool
+	shutdown  bool
+	stateLock sync.RWMutex
+
+	//recovery store is built by NewServer from options, see initRecovery
+	recovery       *recoveryStore
+	recoveryWindow time.Duration
+	recoveryBuffer int
+	resumeGrace    time.Duration
+	resumeSessions bool
+	history        *roomHistory
 }
 
 /**
@@ -50,6 +181,42 @@ func (c *Channel) Close() {
 	}
 }
 
+/**
+Stop accepting new messages, write already queued ones
+to socket, waiting up to given timeout, and close channel
+*/
+func (c *Channel) CloseGraceful(timeout time.Duration) {
+	c.flush(timeout)
+	c.Close()
+}
+
+/**
+Disconnection reason of kicked channels
+*/
+type KickError struct {
+	Reason string
+}
+
+func (e *KickError) Error() string {
+	return "Kicked: " + e.Reason
+}
+
+/**
+Remove client from server, OnKick event with reason and disconnect packet
+are sent before the connection is closed. Disconnection reason is *KickError
+*/
+func (c *Channel) Kick(reason string) error {
+	if err := c.Emit(OnKick, reason); err != nil {
+		return err
+	}
+
+	c.disconnectReasonLock.Lock()
+	c.kickReason = &KickError{Reason: reason}
+	c.disconnectReasonLock.Unlock()
+
+	return send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil)
+}
+
 /**
 Get ip of socket client
 */
@@ -68,14 +235,47 @@ func (c *Channel) RequestHeader() http.Header {
 	return c.requestHeader
 }
 
+/**
+Get query parameters of connection request, e.g. auth token
+or client version, engine.io ones (EIO, transport, sid) are included
+*/
+func (c *Channel) Query() url.Values {
+	return c.query
+}
+
+/**
+Get rooms joined by channel, adapter should implement ChannelRooms(*Channel) []string
+as MemoryAdapter does, nil is returned otherwise
+*/
+func (c *Channel) Rooms() []string {
+	if c.server == nil {
+		return nil
+	}
+
+	adapter, ok := c.server.adapter.(interface {
+		ChannelRooms(c *Channel) []string
+	})
+	if !ok {
+		return nil
+	}
+	return adapter.ChannelRooms(c)
+}
+
+/**
+Get value returned by server auth handler for this connection
+*/
+func (c *Channel) Auth() interface{} {
+	c.authLock.RLock()
+	defer c.authLock.RUnlock()
+
+	return c.auth
+}
+
 /**
 Get channel by it's sid
 */
 func (s *Server) GetChannel(sid string) (*Channel, error) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
-
-	c, ok := s.sids[sid]
+	c, ok := s.sids.get(sid)
 	if !ok {
 		return nil, ErrorConnectionNotFound
 	}
@@ -83,6 +283,23 @@ func (s *Server) GetChannel(sid string) (*Channel, error) {
 	return c, nil
 }
 
+/**
+Emit event to channel with given sid, returns ErrorConnectionNotFound
+if it is not connected to this server. With DirectAdapter event for sid
+not connected locally is routed to other instances, delivery is not confirmed
+*/
+func (s *Server) EmitTo(sid string, method string, args ...interface{}) error {
+	c, err := s.GetChannel(sid)
+	if err == nil {
+		return c.Emit(method, args...)
+	}
+
+	if direct, ok := s.adapter.(DirectAdapter); ok {
+		return direct.EmitTo(sid, method, args)
+	}
+	return err
+}
+
 /**
 Join this channel to given room
 */
@@ -91,23 +308,25 @@ func (c *Channel) Join(room string) error {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
-
-	cn := c.server.channels
-	if _, ok := cn[room]; !ok {
-		cn[room] = make(map[*Channel]struct{})
-	}
-
-	byRoom := c.server.rooms
-	if _, ok := byRoom[c]; !ok {
-		byRoom[c] = make(map[string]struct{})
+	if c.server.adapter.AddToRoom(c, room) && c.server.onRoomJoin != nil {
+		c.server.onRoomJoin(room, c)
 	}
+	return nil
+}
 
-	cn[room][c] = struct{}{}
-	byRoom[c][room] = struct{}{}
+/**
+Set handler called when channel joins a room, should be set before serving
+*/
+func (s *Server) OnRoomJoin(f RoomHandler) {
+	s.onRoomJoin = f
+}
 
-	return nil
+/**
+Set handler called when channel leaves a room, including disconnection,
+should be set before serving
+*/
+func (s *Server) OnRoomLeave(f RoomHandler) {
+	s.onRoomLeave = f
 }
 
 /**
@@ -118,23 +337,78 @@ func (c *Channel) Leave(room string) error {
 		return ErrorServerNotSet
 	}
 
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
+	if !c.server.adapter.RemoveFromRoom(c, room) {
+		return nil
+	}
+	c.server.releaseRoom(room)
+	if c.server.onRoomLeave != nil {
+		c.server.onRoomLeave(room, c)
+	}
+	return nil
+}
+
+/**
+Remove all channels from given room
+*/
+func (s *Server) CloseRoom(room string) {
+	s.closeRoom(room)
+}
 
-	cn := c.server.channels
-	if _, ok := cn[room]; ok {
-		delete(cn[room], c)
-		if len(cn[room]) == 0 {
-			delete(cn, room)
+/**
+Remove all channels from given room and emit event to each of them
+*/
+func (s *Server) CloseRoomWithEvent(room, method string, args interface{}) {
+	for _, c := range s.closeRoom(room) {
+		if c.IsAlive() {
+			go s.emitBroadcast(c, method, args)
 		}
 	}
+}
 
-	byRoom := c.server.rooms
-	if _, ok := byRoom[c]; ok {
-		delete(byRoom[c], room)
+func (s *Server) closeRoom(room string) []*Channel {
+	removed := s.adapter.RemoveRoom(room)
+	s.releaseRoom(room)
+	if s.onRoomLeave != nil {
+		for _, c := range removed {
+			s.onRoomLeave(room, c)
+		}
 	}
 
-	return nil
+	return removed
+}
+
+/**
+Store broadcast in history and count it for rooms having channels
+of this server, so nothing is kept for rooms nobody joined
+*/
+func (s *Server) trackRoomBroadcast(rooms []string, method string, args interface{}) {
+	joined := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if room != "" && len(s.adapter.Sockets(room)) > 0 {
+			joined = append(joined, room)
+		}
+	}
+
+	if s.history != nil {
+		s.history.record(joined, method, args)
+	}
+	s.countRoomMessage(joined...)
+}
+
+/**
+Drop history and message counter of room which has no channels left
+*/
+func (s *Server) releaseRoom(room string) {
+	if len(s.adapter.Sockets(room)) > 0 {
+		return
+	}
+
+	if s.history != nil {
+		s.history.clear(room)
+	}
+	s.roomMessagesLock.Lock()
+	delete(s.roomMessages, room)
+	s.roomMessagesLock.Unlock()
 }
 
 /**
@@ -149,14 +423,35 @@ func (c *Channel) Amount(room string) int {
 }
 
 /**
-Get amount of channels, joined to given room, using server
+Get amount of channels, joined to given room, using server.
+With ClusterAdapter channels of all server instances are counted
 */
 func (s *Server) Amount(room string) int {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+	if _, ok := s.adapter.(ClusterAdapter); ok {
+		return len(s.ListSids(room))
+	}
+	return len(s.adapter.Sockets(room))
+}
 
-	roomChannels, _ := s.channels[room]
-	return len(roomChannels)
+/**
+Get sids of channels joined to given room. With ClusterAdapter channels
+of all server instances are listed, local ones are listed if it fails
+*/
+func (s *Server) ListSids(room string) []string {
+	if cluster, ok := s.adapter.(ClusterAdapter); ok {
+		sids, err := cluster.RoomSids(room)
+		if err == nil {
+			return sids
+		}
+		s.logger.Warn("cluster room members failed", "room", room, "error", err)
+	}
+
+	channels := s.adapter.Sockets(room)
+	sids := make([]string, 0, len(channels))
+	for _, c := range channels {
+		sids = append(sids, c.Id())
+	}
+	return sids
 }
 
 /**
@@ -174,23 +469,7 @@ func (c *Channel) List(room string) []*Channel {
 Get list of channels, joined to given room, using server
 */
 func (s *Server) List(room string) []*Channel {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
-
-	roomChannels, ok := s.channels[room]
-	if !ok {
-		return []*Channel{}
-	}
-
-	i := 0
-	roomChannelsCopy := make([]*Channel, len(roomChannels))
-	for channel := range roomChannels {
-		roomChannelsCopy[i] = channel
-		i++
-	}
-
-	return roomChannelsCopy
-
+	return s.adapter.Sockets(room)
 }
 
 func (c *Channel) BroadcastTo(room, method string, args interface{}) {
@@ -204,32 +483,72 @@ func (c *Channel) BroadcastTo(room, method string, args interface{}) {
 Broadcast message to all room channels
 */
 func (s *Server) BroadcastTo(room, method string, args interface{}) {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+	s.broadcast(room, method, args)
+}
 
-	roomChannels, ok := s.channels[room]
-	if !ok {
-		return
-	}
+/**
+Broadcast to all clients
+*/
+func (s *Server) BroadcastToAll(method string, args interface{}) {
+	s.broadcast("", method, args)
+}
+
+/**
+Ack response of one channel to broadcast ack request
+*/
+type AckResult struct {
+	Channel *Channel
+	Result  string
+	Err     error
+}
+
+/**
+Send ack request to all room channels of this server instance, wait until
+all of them respond or timeout fires, and return collected responses
+*/
+func (s *Server) BroadcastToWithAck(room, method string, args interface{},
+	timeout time.Duration) []AckResult {
 
-	for cn := range roomChannels {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var channels []*Channel
+	for _, cn := range s.List(room) {
 		if cn.IsAlive() {
-			go cn.Emit(method, args)
+			channels = append(channels, cn)
 		}
 	}
+
+	results := make([]AckResult, len(channels))
+	var wg sync.WaitGroup
+	for i, cn := range channels {
+		wg.Add(1)
+		go func(i int, cn *Channel) {
+			defer wg.Done()
+
+			result, err := cn.AckContext(ctx, method, args)
+			if err == context.DeadlineExceeded {
+				err = ErrorSendTimeout
+			}
+			results[i] = AckResult{Channel: cn, Result: result, Err: err}
+		}(i, cn)
+	}
+	wg.Wait()
+
+	return results
 }
 
 /**
-Broadcast to all clients
+Pass broadcast to adapter, it is not able to return error to caller
 */
-func (s *Server) BroadcastToAll(method string, args interface{}) {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
+func (s *Server) broadcast(room, method string, args interface{}) {
+	if s.recovery != nil {
+		s.recovery.record([]string{room}, method, args)
+	}
+	s.trackRoomBroadcast([]string{room}, method, args)
 
-	for _, cn := range s.sids {
-		if cn.IsAlive() {
-			go cn.Emit(method, args)
-		}
+	if err := s.adapter.Broadcast(room, method, args); err != nil {
+		s.logger.Error("adapter broadcast failed", "room", room, "method", method, "error", err)
 	}
 }
 
@@ -237,7 +556,7 @@ func (s *Server) BroadcastToAll(method string, args interface{}) {
 Generate new id for socket.io connection
 */
 func generateNewId(custom string) string {
-	hash := fmt.Sprintf("%s %s %n %n", custom, time.Now(), rand.Uint32(), rand.Uint32())
+	hash := fmt.Sprintf("%s %s %d %d", custom, time.Now(), rand.Uint32(), rand.Uint32())
 	buf := bytes.NewBuffer(nil)
 	sum := md5.Sum([]byte(hash))
 	encoder := base64.NewEncoder(base64.URLEncoding, buf)
@@ -246,45 +565,113 @@ func generateNewId(custom string) string {
 	return buf.String()[:20]
 }
 
+/**
+Encode event arguments the way they are sent to channels of server,
+by server parser or serializer of event. Adapters pass them to other
+server instances, which emit them as is
+*/
+func (s *Server) EncodeArgs(method string, args interface{}) (EncodedArgs, error) {
+	encoded, err := marshalArgs(s.methods.serializers.parserOf(s.parser, method), args)
+	if err != nil {
+		return "", err
+	}
+
+	return EncodedArgs(encoded), nil
+}
+
+/**
+Default connection id generator, based on remote address
+*/
+func defaultIdGenerator(r *http.Request) string {
+	return generateNewId(r.RemoteAddr)
+}
+
 /**
 On connection system handler, store sid
 */
 func onConnectStore(c *Channel) {
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	c.server.sids.set(c.Id(), c)
 
-	c.server.sids[c.Id()] = c
+	c.server.connectHooksLock.RLock()
+	hooks := c.server.connectHooks
+	c.server.connectHooksLock.RUnlock()
+	for _, f := range hooks {
+		f(c)
+	}
 }
 
 /**
 On disconnection system handler, clean joins and sid
 */
 func onDisconnectCleanup(c *Channel) {
-	c.server.channelsLock.Lock()
-	defer c.server.channelsLock.Unlock()
-
-	cn := c.server.channels
-	byRoom, ok := c.server.rooms[c]
-	if ok {
-		for room := range byRoom {
-			if curRoom, ok := cn[room]; ok {
-				delete(curRoom, c)
-				if len(curRoom) == 0 {
-					delete(cn, room)
-				}
-			}
+	c.server.tags.removeAll(c)
+	left := c.server.adapter.RemoveFromAllRooms(c)
+	for _, room := range left {
+		c.server.releaseRoom(room)
+	}
+	if c.server.recovery != nil {
+		c.server.recovery.save(c, left)
+	}
+	if c.server.onRoomLeave != nil {
+		for _, room := range left {
+			c.server.onRoomLeave(room, c)
 		}
+	}
 
-		delete(c.server.rooms, c)
+	c.server.disconnectHooksLock.RLock()
+	hooks := c.server.disconnectHooks
+	c.server.disconnectHooksLock.RUnlock()
+	for _, f := range hooks {
+		f(c)
 	}
 
-	c.server.sidsLock.Lock()
-	defer c.server.sidsLock.Unlock()
+	//sid can be already taken by resumed connection
+	c.server.sids.remove(c.Id(), c)
+}
+
+/**
+Add internal handler, called on each channel disconnection
+*/
+func (s *Server) addDisconnectHook(f systemHandler) {
+	s.disconnectHooksLock.Lock()
+	defer s.disconnectHooksLock.Unlock()
+
+	s.disconnectHooks = append(s.disconnectHooks, f)
+}
+
+/**
+Add internal handler, called on each channel connection
+*/
+func (s *Server) addConnectHook(f systemHandler) {
+	s.connectHooksLock.Lock()
+	defer s.connectHooksLock.Unlock()
 
-	delete(c.server.sids, c.Id())
+	s.connectHooks = append(s.connectHooks, f)
 }
 
+/**
+Send open packet and connect packet of default namespace, engine.io v4
+clients receive connect packet as reply to their own one
+*/
 func (s *Server) SendOpenSequence(c *Channel) {
+	s.sendOpenPacket(c)
+	if c.protocolVersion >= transport.ProtocolV4 {
+		return
+	}
+
+	connect, err := c.parser.Encode(&protocol.Message{Type: protocol.MessageTypeEmpty})
+	if err != nil {
+		s.logger.Error("open sequence encoding failed", "sid", c.Id(), "error", err)
+		return
+	}
+
+	c.out <- connect
+}
+
+/**
+Send engine.io open packet with channel header
+*/
+func (s *Server) sendOpenPacket(c *Channel) {
 	jsonHdr, err := json.Marshal(&c.header)
 	if err != nil {
 		panic(err)
@@ -296,8 +683,77 @@ func (s *Server) SendOpenSequence(c *Channel) {
 			Args: string(jsonHdr),
 		},
 	)
+}
+
+/**
+Open transport connection, send error packet instead of connect one and close
+connection. Channel is not registered, handlers are not called
+*/
+func (s *Server) rejectConnection(w http.ResponseWriter, r *http.Request, reason *ConnectError) {
+	tr := s.transportFor(r)
+	if tr == nil {
+		http.Error(w, ErrorTransportUnknown.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := tr.HandleConnection(w, r)
+	if err != nil {
+		return
+	}
+
+	interval, timeout := s.pingParams(conn)
+	c := &Channel{}
+	c.conn = conn
+	c.parser = s.parser
+	c.logger = s.logger
+	c.initChannel(s.queueSize)
+	c.header = Header{
+		Sid:          s.newSid(r),
+		Upgrades:     []string{},
+		PingInterval: int(interval / time.Millisecond),
+		PingTimeout:  int(timeout / time.Millisecond),
+	}
 
-	c.out <- protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeEmpty})
+	m := &methods{}
+	go outLoop(c, m)
+	s.sendOpenPacket(c)
+	send(&protocol.Message{Type: protocol.MessageTypeError}, c, reason)
+	go func() {
+		c.flush(upgradeTimeout)
+		closeChannel(c, m, reason)
+	}()
+
+	if httpConn, ok := conn.(transport.HttpConnection); ok {
+		httpConn.ServeRequest(w, r)
+		return
+	}
+	tr.Serve(w, r)
+}
+
+/**
+Apply ping params overrides of server to connection and get its ping params,
+sent to client in handshake. Connections which ping params can not be
+changed keep transport ones
+*/
+func (s *Server) pingParams(conn transport.Connection) (interval, timeout time.Duration) {
+	interval, timeout = conn.PingParams()
+	if s.pingInterval <= 0 && s.pingTimeout <= 0 {
+		return interval, timeout
+	}
+
+	pingConn, ok := conn.(transport.PingParamsConnection)
+	if !ok {
+		s.logger.Warn("ping params can not be set for transport", "interval", interval, "timeout", timeout)
+		return interval, timeout
+	}
+	if s.pingInterval > 0 {
+		interval = s.pingInterval
+	}
+	if s.pingTimeout > 0 {
+		timeout = s.pingTimeout
+	}
+	pingConn.SetPingParams(interval, timeout)
+
+	return interval, timeout
 }
 
 /**
@@ -306,28 +762,126 @@ Setup event loop for given connection
 func (s *Server) SetupEventLoop(conn transport.Connection, remoteAddr string,
 	requestHeader http.Header) {
 
-	interval, timeout := conn.PingParams()
+	r := &http.Request{
+		RemoteAddr: remoteAddr,
+		Header:     requestHeader,
+		URL:        &url.URL{},
+	}
+	s.setupEventLoop(conn, r, nil)
+}
+
+func (s *Server) setupEventLoop(conn transport.Connection, r *http.Request, auth interface{}) {
+	var recovered *recoverySession
+	if s.recovery != nil {
+		recovered = s.takeRecoverySession(r)
+	}
+
+	interval, timeout := s.pingParams(conn)
 	hdr := Header{
-		Sid:          generateNewId(remoteAddr),
-		Upgrades:     []string{},
+		Upgrades:     s.upgrades(conn),
 		PingInterval: int(interval / time.Millisecond),
 		PingTimeout:  int(timeout / time.Millisecond),
 	}
+	if recovered != nil && s.resumeSessions {
+		hdr.Sid = recovered.sid
+	} else {
+		hdr.Sid = s.newSid(r)
+	}
+	if s.recovery != nil {
+		token, err := newRecoveryToken()
+		if err != nil {
+			s.logger.Error("recovery token generation failed", "sid", hdr.Sid, "error", err)
+		}
+		hdr.RecoveryToken = token
+	}
+	maxPayload := defaultMaxPayload
+	if s.maxMessageSize > 0 {
+		maxPayload = s.maxMessageSize
+	}
+	if limited, ok := conn.(transport.PayloadLimitConnection); ok {
+		limited.SetMaxPayload(maxPayload)
+	}
+	version := transport.ProtocolVersion(r)
+	if version >= transport.ProtocolV4 {
+		hdr.MaxPayload = maxPayload
+	}
 
 	c := &Channel{}
+	c.protocolVersion = version
 	c.conn = conn
-	c.ip = remoteAddr
-	c.requestHeader = requestHeader
-	c.initChannel()
+	c.ip = r.RemoteAddr
+	c.requestHeader = r.Header
+	c.query = r.URL.Query()
+	c.auth = auth
+	c.logger = s.logger
+	c.tracer = s.tracer
+	c.packetDebug = s.packetDebug
+	c.initChannel(s.queueSize)
+	c.overflowPolicy = s.overflowPolicy
+	c.overflowTimeout = s.overflowTimeout
+	c.controlWriteTimeout = s.controlWriteTimeout
+	c.dataWriteTimeout = s.dataWriteTimeout
+	c.maxMessageSize = s.maxMessageSize
+	c.streamDecode = s.streamDecode
+	c.skipUnknownPackets = s.skipUnknownPackets
+	c.decodeTolerance = s.decodeTolerance
+	c.reliablePolicy = s.reliablePolicy
+	c.sequenced = s.sequenceNumbers
+	if c.query.Get(chunkQueryParam) != "" {
+		c.chunkSize = s.chunkSize
+	}
+	if s.rateLimit > 0 {
+		c.limiter = newRateLimiter(s.rateLimit, s.rateLimitBurst, s.rateLimitPolicy, s.rateLimitQueue)
+	}
+	if s.inboundBandwidth > 0 {
+		c.inBandwidth = &rateLimiter{
+			bucket: newTokenBucket(float64(s.inboundBandwidth), s.inboundBandwidth),
+			policy: s.bandwidthPolicy,
+		}
+	}
+	if s.outboundBandwidth > 0 {
+		c.outBandwidth = &rateLimiter{
+			bucket: newTokenBucket(float64(s.outboundBandwidth), s.outboundBandwidth),
+			policy: s.bandwidthPolicy,
+		}
+	}
 
 	c.server = s
 	c.header = hdr
+	c.parser = s.parser
+	c.serializers = s.methods.serializers
+	c.ackTimeout = s.ackTimeout
+	c.transforms = append([]OutgoingTransform(nil), s.outgoingTransforms...)
+	//engine.io v3 clients are connected by open sequence, v4 ones send connect packet
+	c.connected = version < transport.ProtocolV4
+	if !c.connected && s.connectTimeout > 0 {
+		accepted := make(chan struct{})
+		c.connectAccepted = accepted
+		go connectWatchdog(c, &s.methods, accepted, s.connectTimeout)
+	}
 
 	s.SendOpenSequence(c)
 
 	go inLoop(c, &s.methods)
 	go outLoop(c, &s.methods)
+	go watchdog(c, &s.methods)
+	if s.idleTimeout > 0 {
+		go idleWatchdog(c, &s.methods, s.idleTimeout)
+	}
+	//engine.io v4 server pings clients
+	if s.serverPings || version >= transport.ProtocolV4 {
+		go pinger(c)
+	}
+
+	if recovered != nil {
+		s.recoverChannel(c, recovered)
+	}
 
+	if !c.connected {
+		//connection handler is called when connect packet is accepted
+		s.sids.set(c.Id(), c)
+		return
+	}
 	s.callLoopEvent(c, OnConnection)
 }
 
@@ -335,47 +889,463 @@ func (s *Server) SetupEventLoop(conn transport.Connection, remoteAddr string,
 implements ServeHTTP function from http.Handler
 */
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.tr.HandleConnection(w, r)
+	if !s.checkOrigin(w, r) {
+		return
+	}
+
+	if s.IsShutdown() {
+		http.Error(w, ErrorServerShutdown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if sid := r.URL.Query().Get("sid"); sid != "" {
+		s.serveSid(sid, w, r)
+		return
+	}
+
+	if s.IsDraining() {
+		http.Error(w, ErrorServerDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if !s.acceptsVersion(r) {
+		(&HandshakeError{
+			Status:  http.StatusBadRequest,
+			Code:    HandshakeCodeBadProtocol,
+			Message: ErrorProtocolVersion.Error(),
+		}).writeResponse(w)
+		return
+	}
+
+	if s.maxConnections > 0 && s.AmountOfSids() >= s.maxConnections {
+		if s.onMaxConnections != nil {
+			s.onMaxConnections(w, r)
+			return
+		}
+		http.Error(w, ErrorTooManyConnections.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var auth interface{}
+	if s.authHandler != nil {
+		var err error
+		if auth, err = s.authHandler(r); err != nil {
+			switch reason := err.(type) {
+			case *ConnectError:
+				s.rejectConnection(w, r, reason)
+				return
+			case *HandshakeError:
+				reason.writeResponse(w)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	tr := s.transportFor(r)
+	if tr == nil {
+		http.Error(w, ErrorTransportUnknown.Error(), http.StatusBadRequest)
+		return
+	}
+	s.setStickyCookie(w)
+	conn, err := tr.HandleConnection(w, r)
 	if err != nil {
 		return
 	}
 
-	s.SetupEventLoop(conn, r.RemoteAddr, r.Header)
-	s.tr.Serve(w, r)
+	s.setupEventLoop(conn, r, auth)
+	if httpConn, ok := conn.(transport.HttpConnection); ok {
+		httpConn.ServeRequest(w, r)
+		return
+	}
+	tr.Serve(w, r)
+}
+
+/**
+Get transport of new connection by transport query parameter,
+default transport of the server is used if it is not registered.
+Returns nil if there is no default transport
+*/
+func (s *Server) transportFor(r *http.Request) transport.Transport {
+	if tr, ok := s.transports[r.URL.Query().Get("transport")]; ok {
+		return tr
+	}
+
+	return s.tr
+}
+
+/**
+Reject new connections with 503 status, already connected channels
+keep working. Used to move clients to other instances before shutdown,
+reconnect hint is sent to them if it is set, see WithReconnectHint
+*/
+func (s *Server) Drain() {
+	s.stateLock.Lock()
+	s.draining = true
+	s.stateLock.Unlock()
+
+	s.sendReconnectHint()
+}
+
+/**
+Accept new connections again after Drain
+*/
+func (s *Server) Undrain() {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	s.draining = false
+}
+
+/**
+Check that server rejects new connections
+*/
+func (s *Server) IsDraining() bool {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	return s.draining
+}
+
+/**
+Close all channels with ErrorServerShutdown reason and wait until they are
+cleaned up or ctx is done. Reconnect hint is written to channels first
+if it is set, see WithReconnectHint. All requests are rejected with 503
+status until Reset.
+Channels which are not cleaned up within force close timeout, e.g. blocked
+by disconnection handler, are force closed, see WithForceCloseTimeout.
+If it is set, remaining channels are force closed when ctx is done too.
+Worker pool is stopped after channels are closed, Shutdown waits for
+handlers queued or running in it, see WithWorkerPool
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	//hint is written before shutdown, messages are dropped after it
+	s.flushReconnectHint()
+
+	s.stateLock.Lock()
+	s.shutdown = true
+	s.stateLock.Unlock()
+
+	closedAt := make(map[*Channel]time.Time)
+	for {
+		//taken before snapshot, so channels added or removed after it are not missed
+		changed := s.sids.changes()
+		now := time.Now()
+		var nextForce time.Time
+		for _, c := range s.channelsSnapshot() {
+			started, ok := closedAt[c]
+			if !ok {
+				closedAt[c] = now
+				closeChannel(c, &s.methods, ErrorServerShutdown)
+				continue
+			}
+			if s.forceCloseTimeout <= 0 {
+				continue
+			}
+			deadline := started.Add(s.forceCloseTimeout)
+			if !now.Before(deadline) {
+				s.forceClose(c)
+			} else if nextForce.IsZero() || deadline.Before(nextForce) {
+				nextForce = deadline
+			}
+		}
+		if s.AmountOfSids() == 0 {
+			return s.closeWorkers(ctx)
+		}
+
+		var timer *time.Timer
+		var force <-chan time.Time
+		if !nextForce.IsZero() {
+			timer = time.NewTimer(nextForce.Sub(now))
+			force = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if s.forceCloseTimeout > 0 {
+				for _, c := range s.channelsSnapshot() {
+					s.forceClose(c)
+				}
+			}
+			s.closeWorkers(ctx)
+			return ctx.Err()
+		case <-changed:
+		case <-force:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+/**
+Stop worker pool after channels are closed, waiting for handlers
+already queued or running in it until ctx is done
+*/
+func (s *Server) closeWorkers(ctx context.Context) error {
+	if s.workers == nil {
+		return nil
+	}
+	return s.workers.close(ctx)
+}
+
+/**
+Release channel which cleanup is not finished: close its connection and
+context and remove it from rooms and sids. Goroutines of its handlers can
+not be stopped, they should return when channel context is done
+*/
+func (s *Server) forceClose(c *Channel) {
+	s.logger.Warn("channel force closed", "sid", c.Id())
+
+	c.connection().Close()
+	c.aliveLock.Lock()
+	c.cancelContext()
+	c.aliveLock.Unlock()
+
+	s.tags.removeAll(c)
+	for _, room := range s.adapter.RemoveFromAllRooms(c) {
+		s.releaseRoom(room)
+	}
+	s.sids.remove(c.Id(), c)
+}
+
+/**
+Check that server is shut down
+*/
+func (s *Server) IsShutdown() bool {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	return s.shutdown
+}
+
+/**
+Accept connections again after Shutdown or Drain, worker pool
+stopped by Shutdown is started again
+*/
+func (s *Server) Reset() {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	s.shutdown = false
+	s.draining = false
+	if s.workers != nil {
+		s.workers.start()
+	}
+}
+
+/**
+Serve request of already opened connection: next poll or transport upgrade
+*/
+func (s *Server) serveSid(sid string, w http.ResponseWriter, r *http.Request) {
+	c, err := s.GetChannel(sid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	httpConn, ok := c.connection().(transport.HttpConnection)
+	if !ok {
+		http.Error(w, ErrorUpgradeNotAllowed.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("transport")
+	if name == "" || name == transport.PollingTransportName {
+		httpConn.ServeRequest(w, r)
+		return
+	}
+
+	tr, ok := s.upgradeTransports()[name]
+	if !ok {
+		http.Error(w, ErrorUpgradeNotAllowed.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := tr.HandleConnection(w, r)
+	if err != nil {
+		return
+	}
+
+	if err := s.upgrade(c, httpConn, conn); err != nil {
+		conn.Close()
+		return
+	}
+	tr.Serve(w, r)
+}
+
+/**
+Engine.io upgrade sequence: probe ping/pong, pause current transport, switch
+*/
+func (s *Server) upgrade(c *Channel, prev transport.HttpConnection,
+	conn transport.Connection) error {
+
+	pkg, err := conn.GetMessage()
+	if err != nil {
+		return err
+	}
+	if pkg != protocol.PingMessage+upgradeProbe {
+		return ErrorUpgradeFailed
+	}
+	if err := conn.WriteMessage(protocol.PongMessage + upgradeProbe); err != nil {
+		return err
+	}
+
+	//client waits for pending poll to finish before sending upgrade packet
+	upgraded := make(chan error, 1)
+	go func() {
+		pkg, err := conn.GetMessage()
+		if err == nil && pkg != protocol.UpgradeMessage {
+			err = ErrorUpgradeFailed
+		}
+		upgraded <- err
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(upgradeTimeout)
+	for {
+		select {
+		case <-ticker.C:
+			prev.Flush()
+		case <-timeout:
+			return ErrorUpgradeFailed
+		case err := <-upgraded:
+			if err != nil {
+				return err
+			}
+			s.pingParams(conn)
+			c.upgradeConnection(conn)
+			return nil
+		}
+	}
+}
+
+/**
+Transports, by name, to which connections of the server can be upgraded:
+upgrades of default transport and registered transports except polling
+*/
+func (s *Server) upgradeTransports() map[string]transport.Transport {
+	upgrades := map[string]transport.Transport{}
+	if tr, ok := s.tr.(transport.UpgradableTransport); ok {
+		for name, upgrade := range tr.Upgrades() {
+			upgrades[name] = upgrade
+		}
+	}
+	for name, tr := range s.transports {
+		if name != transport.PollingTransportName {
+			upgrades[name] = tr
+		}
+	}
+
+	return upgrades
+}
+
+/**
+Websocket transports of the server, including upgrade ones
+*/
+func (s *Server) websocketTransports() []*transport.WebsocketTransport {
+	var result []*transport.WebsocketTransport
+	if wst, ok := s.tr.(*transport.WebsocketTransport); ok {
+		result = append(result, wst)
+	}
+	//upgrade transports include registered ones
+	for _, tr := range s.upgradeTransports() {
+		if wst, ok := tr.(*transport.WebsocketTransport); ok {
+			result = append(result, wst)
+		}
+	}
+
+	return result
+}
+
+/**
+List of upgrades available for given connection, sent in open packet
+*/
+func (s *Server) upgrades(conn transport.Connection) []string {
+	upgrades := []string{}
+	if _, ok := conn.(transport.HttpConnection); !ok {
+		return upgrades
+	}
+
+	for name := range s.upgradeTransports() {
+		upgrades = append(upgrades, name)
+	}
+	sort.Strings(upgrades)
+
+	return upgrades
 }
 
 /**
 Get amount of current connected sids
 */
 func (s *Server) AmountOfSids() int64 {
-	s.sidsLock.RLock()
-	defer s.sidsLock.RUnlock()
-
-	return int64(len(s.sids))
+	return int64(s.sids.len())
 }
 
 /**
 Get amount of rooms with at least one channel(or sid) joined
 */
 func (s *Server) AmountOfRooms() int64 {
-	s.channelsLock.RLock()
-	defer s.channelsLock.RUnlock()
+	return int64(len(s.adapter.Rooms()))
+}
+
+/**
+Get list of rooms with at least one channel joined
+*/
+func (s *Server) Rooms() []string {
+	return s.adapter.Rooms()
+}
 
-	return int64(len(s.channels))
+/**
+Get rooms with at least one channel joined, with amount of channels in each
+*/
+func (s *Server) RoomsWithCounts() map[string]int {
+	rooms := s.adapter.Rooms()
+
+	counts := make(map[string]int, len(rooms))
+	for _, room := range rooms {
+		if amount := s.Amount(room); amount > 0 {
+			counts[room] = amount
+		}
+	}
+
+	return counts
 }
 
 /**
-Create new socket.io server
+Create new socket.io server, tr is default transport of new connections.
+It can be nil if server serves only transports registered with WithTransports,
+requests of other transports are rejected then
 */
-func NewServer(tr transport.Transport) *Server {
+func NewServer(tr transport.Transport, opts ...ServerOption) *Server {
 	s := Server{}
 	s.initMethods()
 	s.tr = tr
-	s.channels = make(map[string]map[*Channel]struct{})
-	s.rooms = make(map[*Channel]map[string]struct{})
-	s.sids = make(map[string]*Channel)
+	s.parser = protocol.JsonParser{}
+	s.queueSize = DefaultQueueSize
+	s.overflowTimeout = DefaultOverflowTimeout
+	s.sids = newSidMap()
+	s.roomMessages = make(map[string]uint64)
 	s.onConnection = onConnectStore
 	s.onDisconnection = onDisconnectCleanup
+	s.idGenerator = defaultIdGenerator
+	s.connectTimeout = DefaultConnectTimeout
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+	s.initRecovery()
+
+	if s.adapter == nil {
+		s.adapter = NewMemoryAdapter()
+	}
+	s.adapter.Init(&s)
+	if s.metrics != nil {
+		s.metrics.Init(&s)
+		s.initConnectionMetrics()
+	}
 
 	return &s
 }
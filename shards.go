@@ -0,0 +1,119 @@
+package gosocketio
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+/**
+Amount of shards of sids and rooms maps, operations on different shards
+do not contend for locks
+*/
+const mapShards = 32
+
+func shardOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % mapShards)
+}
+
+/**
+Channels by sid, sharded by hash of sid
+*/
+type sidMap struct {
+	shards [mapShards]struct {
+		sids map[string]*Channel
+		lock sync.RWMutex
+	}
+
+	//closed and replaced on each set or remove, see changes
+	changed     chan struct{}
+	changedLock sync.Mutex
+}
+
+func newSidMap() *sidMap {
+	m := &sidMap{changed: make(chan struct{})}
+	for i := range m.shards {
+		m.shards[i].sids = make(map[string]*Channel)
+	}
+	return m
+}
+
+/**
+Get channel closed on the next set or remove of sid
+*/
+func (m *sidMap) changes() <-chan struct{} {
+	m.changedLock.Lock()
+	defer m.changedLock.Unlock()
+
+	return m.changed
+}
+
+func (m *sidMap) notify() {
+	m.changedLock.Lock()
+	defer m.changedLock.Unlock()
+
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *sidMap) get(sid string) (*Channel, bool) {
+	shard := &m.shards[shardOf(sid)]
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	c, ok := shard.sids[sid]
+	return c, ok
+}
+
+func (m *sidMap) set(sid string, c *Channel) {
+	shard := &m.shards[shardOf(sid)]
+	shard.lock.Lock()
+	shard.sids[sid] = c
+	shard.lock.Unlock()
+
+	m.notify()
+}
+
+/**
+Remove sid if it still belongs to given channel
+*/
+func (m *sidMap) remove(sid string, c *Channel) {
+	shard := &m.shards[shardOf(sid)]
+	shard.lock.Lock()
+	removed := shard.sids[sid] == c
+	if removed {
+		delete(shard.sids, sid)
+	}
+	shard.lock.Unlock()
+
+	if removed {
+		m.notify()
+	}
+}
+
+func (m *sidMap) len() int {
+	n := 0
+	for i := range m.shards {
+		m.shards[i].lock.RLock()
+		n += len(m.shards[i].sids)
+		m.shards[i].lock.RUnlock()
+	}
+	return n
+}
+
+/**
+Get copy of all channels, shards are locked one by one
+*/
+func (m *sidMap) snapshot() []*Channel {
+	var channels []*Channel
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.RLock()
+		for _, c := range shard.sids {
+			channels = append(channels, c)
+		}
+		shard.lock.RUnlock()
+	}
+	return channels
+}
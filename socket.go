@@ -0,0 +1,22 @@
+package gosocketio
+
+import (
+	"net/http"
+)
+
+/**
+Connection methods used by handlers, implemented by *Channel.
+Handlers can accept Socket instead of *Channel as first argument,
+e.g. func(s Socket, msg Message), so they can be tested with mock sockets
+*/
+type Socket interface {
+	Id() string
+	Emit(method string, args ...interface{}) error
+	Join(room string) error
+	Leave(room string) error
+	Ip() string
+	RequestHeader() http.Header
+	Close()
+}
+
+var _ Socket = (*Channel)(nil)
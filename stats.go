@@ -0,0 +1,196 @@
+package gosocketio
+
+import (
+	"time"
+)
+
+/**
+Statistics of one connected channel
+*/
+type ChannelStats struct {
+	Id               string    `json:"id"`
+	Ip               string    `json:"ip"`
+	QueueDepth       int       `json:"queueDepth"`
+	PendingAcks      int       `json:"pendingAcks"`
+	BytesSent        int64     `json:"bytesSent"`
+	BytesReceived    int64     `json:"bytesReceived"`
+	MessagesSent     int64     `json:"messagesSent"`
+	MessagesReceived int64     `json:"messagesReceived"`
+	ConnectedAt      time.Time `json:"connectedAt"`
+	LastActivity     time.Time `json:"lastActivity"`
+}
+
+/**
+Statistics of one room, Messages is amount of broadcasts to room
+sent by this server instance since the server start
+*/
+type RoomStats struct {
+	Name     string `json:"name"`
+	Members  int    `json:"members"`
+	Messages uint64 `json:"messages"`
+}
+
+/**
+Statistics of server channels and rooms, see Server.Stats
+*/
+type ServerStats struct {
+	Channels []ChannelStats `json:"channels"`
+	Rooms    []RoomStats    `json:"rooms"`
+}
+
+/**
+Count bytes of incoming packet
+*/
+func (c *Channel) countReceived(n int) {
+	c.lastActivityLock.Lock()
+	c.bytesReceived += int64(n)
+	c.messagesReceived++
+	c.lastActivityLock.Unlock()
+}
+
+/**
+Count bytes of written packets
+*/
+func (c *Channel) countSent(msgs []string) {
+	n := 0
+	for _, msg := range msgs {
+		n += len(msg)
+	}
+
+	c.lastActivityLock.Lock()
+	c.bytesSent += int64(n)
+	c.messagesSent += int64(len(msgs))
+	c.lastActivityLock.Unlock()
+}
+
+/**
+Get statistics of channel
+*/
+func (c *Channel) Stats() ChannelStats {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return ChannelStats{
+		Id:               c.Id(),
+		Ip:               c.Ip(),
+		QueueDepth:       len(c.out),
+		PendingAcks:      c.ack.waitersCount(),
+		BytesSent:        c.bytesSent,
+		BytesReceived:    c.bytesReceived,
+		MessagesSent:     c.messagesSent,
+		MessagesReceived: c.messagesReceived,
+		ConnectedAt:      c.connectedAt,
+		LastActivity:     c.lastActivity,
+	}
+}
+
+/**
+Get amount of packets waiting in outgoing queue
+*/
+func (c *Channel) QueueDepth() int {
+	return len(c.out)
+}
+
+/**
+Get amount of packets written to channel, pings included
+*/
+func (c *Channel) MessagesSent() int64 {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.messagesSent
+}
+
+/**
+Get amount of packets received by channel, pings included
+*/
+func (c *Channel) MessagesReceived() int64 {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.messagesReceived
+}
+
+/**
+Get amount of bytes written to channel
+*/
+func (c *Channel) BytesSent() int64 {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.bytesSent
+}
+
+/**
+Get amount of bytes received by channel
+*/
+func (c *Channel) BytesReceived() int64 {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.bytesReceived
+}
+
+/**
+Get time of connection, of the last reconnection for client
+*/
+func (c *Channel) ConnectedAt() time.Time {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.connectedAt
+}
+
+/**
+Get time of the last packet received by channel
+*/
+func (c *Channel) LastActivity() time.Time {
+	c.lastActivityLock.Lock()
+	defer c.lastActivityLock.Unlock()
+
+	return c.lastActivity
+}
+
+/**
+Count broadcast to given rooms
+*/
+func (s *Server) countRoomMessage(rooms ...string) {
+	s.roomMessagesLock.Lock()
+	defer s.roomMessagesLock.Unlock()
+
+	for _, room := range rooms {
+		s.roomMessages[room]++
+	}
+}
+
+/**
+Get snapshot of channels and rooms statistics, returned data is a copy
+and can be used without any locks
+*/
+func (s *Server) Stats() ServerStats {
+	stats := ServerStats{}
+	for _, c := range s.channelsSnapshot() {
+		stats.Channels = append(stats.Channels, c.Stats())
+	}
+
+	counts := s.RoomsWithCounts()
+
+	s.roomMessagesLock.Lock()
+	defer s.roomMessagesLock.Unlock()
+
+	for room, members := range counts {
+		stats.Rooms = append(stats.Rooms, RoomStats{
+			Name:     room,
+			Members:  members,
+			Messages: s.roomMessages[room],
+		})
+	}
+	//counters of rooms which do not exist anymore are dropped
+	for room := range s.roomMessages {
+		if _, ok := counts[room]; !ok {
+			delete(s.roomMessages, room)
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,147 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+	"sync"
+)
+
+/**
+Client connection state
+*/
+type Status int
+
+const (
+	/**
+	Client is connected, waiting for open packet of the server
+	*/
+	StatusConnecting Status = iota
+	/**
+	Open packet is received, client is ready
+	*/
+	StatusConnected
+	/**
+	Connection is lost, client is reconnecting, see DialWithReconnect
+	*/
+	StatusReconnecting
+	/**
+	Client is closed and will not be reconnected
+	*/
+	StatusClosed
+)
+
+//amount of not received status changes kept in feed
+const statusFeedSize = 16
+
+func (s Status) String() string {
+	switch s {
+	case StatusConnecting:
+		return "connecting"
+	case StatusConnected:
+		return "connected"
+	case StatusReconnecting:
+		return "reconnecting"
+	case StatusClosed:
+		return "closed"
+	}
+
+	return "unknown"
+}
+
+/**
+Current client state and feed of its changes
+*/
+type statusTracker struct {
+	status  Status
+	changes chan Status
+	//transport of current connection, see DialWithFallback
+	transport transport.Transport
+	lock      sync.Mutex
+}
+
+func (t *statusTracker) init() {
+	t.status = StatusConnecting
+	t.changes = make(chan Status, statusFeedSize)
+}
+
+/**
+Change state and notify feed, the oldest change is dropped
+if feed is full. Feed is closed after StatusClosed
+*/
+func (t *statusTracker) set(status Status) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.status == status || t.status == StatusClosed {
+		return
+	}
+	t.status = status
+
+	for {
+		select {
+		case t.changes <- status:
+			if status == StatusClosed {
+				close(t.changes)
+			}
+			return
+		default:
+		}
+
+		select {
+		case <-t.changes:
+		default:
+		}
+	}
+}
+
+func (t *statusTracker) setTransport(tr transport.Transport) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.transport = tr
+}
+
+/**
+Get current client state, IsAlive is false while client is reconnecting,
+Status tells whether it will be connected again
+*/
+func (c *Client) Status() Status {
+	c.status.lock.Lock()
+	defer c.status.lock.Unlock()
+
+	return c.status.status
+}
+
+/**
+Get transport of current or last connection, e.g. fallback one if preferred
+transport failed to connect, see DialWithFallback
+*/
+func (c *Client) ActiveTransport() transport.Transport {
+	c.status.lock.Lock()
+	defer c.status.lock.Unlock()
+
+	return c.status.transport
+}
+
+/**
+Get feed of client state changes, feed is closed when client is closed.
+All calls return the same feed, so it should have one reader
+*/
+func (c *Client) StatusChanges() <-chan Status {
+	return c.status.changes
+}
+
+/**
+Update state on connection and disconnection of client channel
+*/
+func (c *Client) trackStatus() {
+	c.onConnection = func(*Channel) {
+		c.status.set(StatusConnected)
+	}
+	c.onDisconnection = func(*Channel) {
+		if c.reconnectPolicy == nil || c.isClosed() {
+			c.status.set(StatusClosed)
+			return
+		}
+		c.status.set(StatusReconnecting)
+	}
+}
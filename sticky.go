@@ -0,0 +1,120 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/transport"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+const (
+	//cookie used by socket.io deployments for load balancer affinity
+	DefaultStickyCookie = "io"
+
+	//separates routing key and generated part of sid
+	stickySeparator = "."
+)
+
+/**
+Sticky session settings, see WithStickySession
+*/
+type StickySession struct {
+	//routing key of this server instance, e.g. node name,
+	//should not contain stickySeparator
+	Key string
+	//cookie name, DefaultStickyCookie if empty
+	Cookie string
+	//cookie path, "/" if empty
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+/**
+Generate sid of new connection, prefixed with routing key of sticky session
+*/
+func (s *Server) newSid(r *http.Request) string {
+	sid := s.idGenerator(r)
+	if s.sticky == nil || s.sticky.Key == "" {
+		return sid
+	}
+
+	return s.sticky.Key + stickySeparator + sid
+}
+
+/**
+Set sticky session cookie to handshake response, it is sent
+with upgrade response by websocket transport
+*/
+func (s *Server) setStickyCookie(w http.ResponseWriter) {
+	if s.sticky == nil || s.sticky.Key == "" {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     s.sticky.Cookie,
+		Value:    s.sticky.Key,
+		Path:     s.sticky.Path,
+		Secure:   s.sticky.Secure,
+		SameSite: s.sticky.SameSite,
+		HttpOnly: true,
+	}
+	if cookie.Name == "" {
+		cookie.Name = DefaultStickyCookie
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	http.SetCookie(w, cookie)
+}
+
+/**
+Get routing key of request for load balancer affinity: sid prefix of
+already opened connection or sticky cookie of new one, empty if there is none.
+Cookie name is DefaultStickyCookie if empty
+*/
+func RoutingKey(r *http.Request, cookie string) string {
+	if sid := r.URL.Query().Get("sid"); sid != "" {
+		if i := strings.Index(sid, stickySeparator); i > 0 {
+			return sid[:i]
+		}
+	}
+
+	if cookie == "" {
+		cookie = DefaultStickyCookie
+	}
+	if c, err := r.Cookie(cookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+/**
+Store cookies of handshake responses and send them on reconnection,
+so sticky session keeps client on the same server instance. Jar is set
+to websocket and polling transports which have no own one
+*/
+func DialWithStickySession() DialOption {
+	return func(c *Client) {
+		c.stickySession = true
+	}
+}
+
+/**
+Set the same cookie jar to transports of client, including fallback ones
+*/
+func (c *Client) setStickyJar() {
+	jar, _ := cookiejar.New(nil)
+	for _, tr := range c.transports() {
+		switch tr := tr.(type) {
+		case *transport.WebsocketTransport:
+			if tr.Jar == nil {
+				tr.Jar = jar
+			}
+		case *transport.PollingTransport:
+			if tr.Jar == nil {
+				tr.Jar = jar
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package gosocketio
+
+import (
+	"bufio"
+	"github.com/graarh/golang-socketio/protocol"
+	"github.com/graarh/golang-socketio/transport"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+Reader counting read bytes, fails with ErrorMessageTooLarge
+when more than limit bytes are read
+*/
+type countingReader struct {
+	r     io.Reader
+	n     int
+	limit int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	if r.limit > 0 && r.n > r.limit {
+		return n, ErrorMessageTooLarge
+	}
+
+	return n, err
+}
+
+/**
+Check that event arguments can be decoded right from transport stream
+*/
+func (c *Channel) canStream(conn transport.Connection) (transport.ReaderConnection, bool) {
+	if !c.streamDecode {
+		return nil, false
+	}
+	//custom serializer is not able to decode stream
+	if p, ok := c.parser.(protocol.JsonParser); !ok || p.Serializer != nil {
+		return nil, false
+	}
+	//encrypted arguments are decrypted as a whole
+	if c.payloadCipher() != nil {
+		return nil, false
+	}
+	//interceptors receive arguments as a whole
+	if c.server != nil && c.server.hasInterceptors() {
+		return nil, false
+	}
+	//events of custom namespaces are routed as whole packets
+	if c.server != nil && c.server.hasNamespaces() {
+		return nil, false
+	}
+	//queued events are decoded later, when stream is gone
+	if l := c.eventLimiter(); l != nil && l.queue != nil {
+		return nil, false
+	}
+
+	readerConn, ok := conn.(transport.ReaderConnection)
+	return readerConn, ok
+}
+
+/**
+Read next incoming packet. Event packets are returned as stream if it
+is enabled and supported by connection, other ones are read fully.
+Packets of reader connections bigger than max message size are skipped
+without buffering, ErrorMessageTooLarge is returned for them
+*/
+func (c *Channel) readIncoming(conn transport.Connection) ([]byte, io.Reader, error) {
+	readerConn, stream := c.canStream(conn)
+	if !stream && c.maxMessageSize > 0 {
+		readerConn, _ = conn.(transport.ReaderConnection)
+	}
+	if readerConn == nil {
+		data, err := transport.ReadBytes(conn)
+		return data, nil, err
+	}
+
+	reader, err := readerConn.NextReader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stream {
+		buffered := bufio.NewReader(reader)
+		head, err := buffered.Peek(2)
+		if err == nil && string(head) == "42" {
+			return nil, buffered, nil
+		}
+		reader = buffered
+	}
+
+	data, err := c.readLimited(reader)
+	return data, nil, err
+}
+
+/**
+Read packet fully, but not more than max message size. Rest of bigger
+packet is discarded, so connection can read the next one
+*/
+func (c *Channel) readLimited(reader io.Reader) ([]byte, error) {
+	if c.maxMessageSize <= 0 {
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, transport.ErrorBadBuffer
+		}
+		return data, nil
+	}
+
+	//one byte over the limit tells too large packet from the limit sized one
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(c.maxMessageSize)+1))
+	if err != nil {
+		return nil, transport.ErrorBadBuffer
+	}
+	if len(data) > c.maxMessageSize {
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			return nil, transport.ErrorBadBuffer
+		}
+		return nil, ErrorMessageTooLarge
+	}
+	//empty messages are not allowed
+	if len(data) == 0 {
+		return nil, transport.ErrorPacketWrong
+	}
+
+	return data, nil
+}
+
+/**
+Decode event packet from stream and pass it to processing function.
+Middlewares and arguments decoding are done synchronously, as stream
+is valid until the next packet is read, function is called by worker pool
+or in background.
+Returned error closes the channel, panic of middleware or decoding skips packet
+*/
+func (m *methods) processIncomingStream(c *Channel, r io.Reader) error {
+	defer m.recoverPanic(c)
+
+	counter := &countingReader{r: r, limit: c.maxMessageSize}
+	msg, args, err := protocol.DecodeReader(counter)
+	if err != nil {
+		return m.streamError(c, err)
+	}
+	defer protocol.ReleaseMessage(msg)
+
+	isEvent := msg.Type == protocol.MessageTypeEmit ||
+		msg.Type == protocol.MessageTypeAckRequest
+	if !isEvent {
+		return nil
+	}
+	if !m.validEventName(c, msg.Method) {
+		//rest of packet is skipped by the reader
+		return nil
+	}
+	if !c.allowIncoming() {
+		if limitCloses(c.eventLimiter()) {
+			return ErrorRateLimited
+		}
+		m.callErrorHandler(c, channelError(c, msg.Method, ErrorRateLimited))
+		return nil
+	}
+
+	m.observeReceived(c)
+
+	id, duplicate := m.deduplicate(c, msg)
+	if duplicate {
+		return nil
+	}
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			c.finishDedup(id, nil, false)
+		}
+	}()
+
+	var f *caller
+	var data []interface{}
+	reserved := isReservedEvent(msg.Method)
+	if reserved {
+		err = ErrorReservedEvent
+	} else if f, err = m.routeEvent(c, msg, msg.Method); err == nil && f != nil {
+		data, err = f.decodeEventArgs(func() (string, error) {
+			return readRawArgs(args)
+		}, func(v []interface{}) error {
+			return protocol.DecodeArgs(args, v)
+		})
+	}
+
+	//unhandled event arguments are read before the rest of packet is skipped
+	var unhandledArgs string
+	unhandled := !reserved && err == nil && f == nil
+	if unhandled {
+		unhandledArgs, err = readRawArgs(args)
+	}
+
+	//rest of packet is read to count its size
+	_, copyErr := io.Copy(ioutil.Discard, counter)
+	c.countReceived(counter.n)
+	if err == ErrorMessageTooLarge || copyErr == ErrorMessageTooLarge {
+		return m.streamError(c, ErrorMessageTooLarge)
+	}
+	if !c.allowInboundBytes(counter.n) {
+		if limitCloses(c.inBandwidth) {
+			return ErrorBandwidthExceeded
+		}
+		m.callErrorHandler(c, channelError(c, msg.Method, ErrorBandwidthExceeded))
+		return nil
+	}
+	if reserved {
+		m.callErrorHandler(c, channelError(c, msg.Method, ErrorReservedEvent))
+		return nil
+	}
+	if unhandled && err == nil {
+		go m.callUnhandled(c, msg.Method, unhandledArgs)
+		return nil
+	}
+	if f == nil {
+		//dropped by middleware or no processing function
+		return nil
+	}
+	if err != nil {
+		m.callErrorHandler(c, channelError(c, msg.Method, &DecodeError{Err: err}))
+		return nil
+	}
+
+	//message is released on return, handler gets copies of its fields
+	method, msgType, ackId := msg.Method, msg.Type, msg.AckId
+	dispatched = c.runTask(func() {
+		result, ok := m.callEvent(c, f, method, msgType, ackId, data)
+		c.finishDedup(id, result, ok)
+	})
+	return nil
+}
+
+/**
+Process packet decoding error, oversized packets are rejected
+and connection is kept, other errors close the channel
+*/
+func (m *methods) streamError(c *Channel, err error) error {
+	if err == ErrorMessageTooLarge {
+		c.rejectMessage(err)
+		m.callErrorHandler(c, channelError(c, "", err))
+		return nil
+	}
+
+	return protocol.ErrorWrongPacket
+}
+
+/**
+Read encoded arguments left in stream after event name, e.g. `,{"a":1}]`,
+without leading comma and closing bracket
+*/
+func readRawArgs(r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	args := strings.TrimSpace(string(data))
+	args = strings.TrimSuffix(args, "]")
+	args = strings.TrimPrefix(strings.TrimSpace(args), ",")
+	return strings.TrimSpace(args), nil
+}
@@ -0,0 +1,142 @@
+package gosocketio
+
+import (
+	"sort"
+	"sync"
+)
+
+/**
+Server-side channel tags, indexed like rooms but not shared by adapter
+and not visible to clients
+*/
+type tagIndex struct {
+	channels    map[string]map[*Channel]struct{}
+	channelTags map[*Channel]map[string]struct{}
+	lock        sync.RWMutex
+}
+
+func (t *tagIndex) add(c *Channel, tag string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.channels == nil {
+		t.channels = make(map[string]map[*Channel]struct{})
+		t.channelTags = make(map[*Channel]map[string]struct{})
+	}
+	if t.channels[tag] == nil {
+		t.channels[tag] = make(map[*Channel]struct{})
+	}
+	if t.channelTags[c] == nil {
+		t.channelTags[c] = make(map[string]struct{})
+	}
+	t.channels[tag][c] = struct{}{}
+	t.channelTags[c][tag] = struct{}{}
+}
+
+func (t *tagIndex) remove(c *Channel, tag string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.channels[tag], c)
+	if len(t.channels[tag]) == 0 {
+		delete(t.channels, tag)
+	}
+	delete(t.channelTags[c], tag)
+	if len(t.channelTags[c]) == 0 {
+		delete(t.channelTags, c)
+	}
+}
+
+func (t *tagIndex) removeAll(c *Channel) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for tag := range t.channelTags[c] {
+		delete(t.channels[tag], c)
+		if len(t.channels[tag]) == 0 {
+			delete(t.channels, tag)
+		}
+	}
+	delete(t.channelTags, c)
+}
+
+func (t *tagIndex) tagged(tag string) []*Channel {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	channels := make([]*Channel, 0, len(t.channels[tag]))
+	for c := range t.channels[tag] {
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+func (t *tagIndex) tags(c *Channel) []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	tags := make([]string, 0, len(t.channelTags[c]))
+	for tag := range t.channelTags[c] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+/**
+Add tags to this channel, e.g. "tenant:42", see Server.BroadcastToTag.
+Tags are server-side only, they are removed on disconnection
+*/
+func (c *Channel) Tag(tags ...string) error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+
+	for _, tag := range tags {
+		c.server.tags.add(c, tag)
+	}
+	return nil
+}
+
+/**
+Remove tags from this channel
+*/
+func (c *Channel) Untag(tags ...string) error {
+	if c.server == nil {
+		return ErrorServerNotSet
+	}
+
+	for _, tag := range tags {
+		c.server.tags.remove(c, tag)
+	}
+	return nil
+}
+
+/**
+Get sorted tags of this channel
+*/
+func (c *Channel) Tags() []string {
+	if c.server == nil {
+		return nil
+	}
+
+	return c.server.tags.tags(c)
+}
+
+/**
+Get channels of this server instance with given tag
+*/
+func (s *Server) TaggedChannels(tag string) []*Channel {
+	return s.tags.tagged(tag)
+}
+
+/**
+Broadcast to channels of this server instance with given tag
+*/
+func (s *Server) BroadcastToTag(tag, method string, args interface{}) {
+	for _, c := range s.tags.tagged(tag) {
+		if c.IsAlive() {
+			go s.emitBroadcast(c, method, args)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package gosocketio
+
+import (
+	"context"
+)
+
+/**
+Tracer starts spans of incoming events and ack round trips, see tracing/otel
+for OpenTelemetry one. Returned context is passed to handlers having
+context.Context first argument, returned function ends the span with
+error returned by handler or ack
+*/
+type Tracer interface {
+	/**
+	Called before event or ack request handler
+	*/
+	StartEvent(ctx context.Context, c *Channel, method string) (context.Context, func(err error))
+
+	/**
+	Called when ack is sent, span lasts until response is received
+	*/
+	StartAck(ctx context.Context, c *Channel, method string) (context.Context, func(err error))
+}
@@ -0,0 +1,88 @@
+package otel
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio"
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/graarh/golang-socketio"
+
+	AttributeEvent = attribute.Key("socketio.event")
+	AttributeSid   = attribute.Key("socketio.sid")
+	AttributeRooms = attribute.Key("socketio.rooms")
+)
+
+/**
+OpenTelemetry tracer of socket.io events, pass it to server with
+gosocketio.WithTracer or to client with gosocketio.DialWithTracer
+*/
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+/**
+Create tracer using given provider, global one is used if it is nil
+*/
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otelglobal.GetTracerProvider()
+	}
+
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+/**
+Start server span of incoming event, named after event
+*/
+func (t *Tracer) StartEvent(ctx context.Context, c *gosocketio.Channel,
+	method string) (context.Context, func(err error)) {
+
+	ctx, span := t.tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes(c, method)...),
+	)
+	return ctx, endSpan(span)
+}
+
+/**
+Start client span of ack round trip, named "ack" and event name
+*/
+func (t *Tracer) StartAck(ctx context.Context, c *gosocketio.Channel,
+	method string) (context.Context, func(err error)) {
+
+	ctx, span := t.tracer.Start(ctx, "ack "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes(c, method)...),
+	)
+	return ctx, endSpan(span)
+}
+
+func attributes(c *gosocketio.Channel, method string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttributeEvent.String(method),
+		AttributeSid.String(c.Id()),
+	}
+	if rooms := c.Rooms(); len(rooms) > 0 {
+		attrs = append(attrs, AttributeRooms.StringSlice(rooms))
+	}
+
+	return attrs
+}
+
+/**
+Get function ending span, error is recorded in span
+*/
+func endSpan(span trace.Span) func(err error) {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
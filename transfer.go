@@ -0,0 +1,315 @@
+package gosocketio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTransferChunkSize = 64 * 1024
+	DefaultTransferWindow    = 4
+
+	//late chunks of finished transfer are rejected during this time
+	transferLinger = time.Minute
+)
+
+var (
+	ErrorTransferAborted = errors.New("Transfer aborted")
+)
+
+/**
+Chunking and backpressure of stream transfer, see SendStream.
+Zero fields are replaced with defaults
+*/
+type TransferPolicy struct {
+	//max size of data of one chunk, should fit max message size of remote side
+	ChunkSize int
+	//max amount of chunks waiting for ack, should not exceed worker pool size
+	//of remote side, see WithWorkerPool
+	Window int
+}
+
+var DefaultTransferPolicy = TransferPolicy{
+	ChunkSize: DefaultTransferChunkSize,
+	Window:    DefaultTransferWindow,
+}
+
+func (p TransferPolicy) withDefaults() TransferPolicy {
+	if p.ChunkSize <= 0 {
+		p.ChunkSize = DefaultTransferChunkSize
+	}
+	if p.Window <= 0 {
+		p.Window = DefaultTransferWindow
+	}
+	return p
+}
+
+/**
+One chunk of stream transfer, data is sent as binary by binary parsers.
+Abort chunk cancels transfer
+*/
+type TransferChunk struct {
+	Id    string `json:"id" msgpack:"id"`
+	Seq   int    `json:"seq" msgpack:"seq"`
+	Data  []byte `json:"data,omitempty" msgpack:"data,omitempty"`
+	Last  bool   `json:"last,omitempty" msgpack:"last,omitempty"`
+	Abort bool   `json:"abort,omitempty" msgpack:"abort,omitempty"`
+}
+
+/**
+Function receiving incoming stream transfer, called once per transfer in
+separate goroutine. Reader returns chunks data in order, io.EOF when transfer
+is complete and ErrorTransferAborted if sender aborted it. Transfer is aborted
+if function returns before reading all data
+*/
+type StreamHandler func(c *Channel, id string, r io.Reader)
+
+/**
+Receiving side of one stream transfer, chunks are written to pipe in order
+*/
+type incomingTransfer struct {
+	w    *io.PipeWriter
+	next int
+
+	done chan struct{}
+	lock sync.Mutex
+	cond *sync.Cond
+}
+
+/**
+Send data of reader to remote side in chunks of given method, which should be
+handled with OnStream. Chunks are sent as ack requests, not more than policy
+window chunks wait for ack, so transfer is not faster than remote side reads it.
+Returns transfer id when remote side received all data, ErrorTransferAborted
+if remote side stopped reading, ctx.Err() if ctx is done
+*/
+func (c *Channel) SendStream(ctx context.Context, method string, r io.Reader,
+	policy TransferPolicy) (string, error) {
+
+	policy = policy.withDefaults()
+	id := c.nextTransferId()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	window := make(chan struct{}, policy.Window)
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for seq := 0; ; seq++ {
+		data := make([]byte, policy.ChunkSize)
+		n, err := io.ReadFull(r, data)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			fail(err)
+			break
+		}
+
+		select {
+		case window <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(chunk *TransferChunk) {
+			defer wg.Done()
+			defer func() {
+				<-window
+			}()
+
+			if err := c.sendChunk(ctx, method, chunk); err != nil {
+				fail(err)
+			}
+		}(&TransferChunk{Id: id, Seq: seq, Data: data[:n], Last: last})
+
+		if last {
+			break
+		}
+	}
+	wg.Wait()
+
+	select {
+	case err := <-failed:
+		//remote side is not waiting for the rest of data
+		c.Emit(method, &TransferChunk{Id: id, Abort: true})
+		return id, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		c.Emit(method, &TransferChunk{Id: id, Abort: true})
+		return id, err
+	}
+
+	return id, nil
+}
+
+/**
+Send one chunk and wait until remote side takes it
+*/
+func (c *Channel) sendChunk(ctx context.Context, method string, chunk *TransferChunk) error {
+	result, err := c.AckContext(ctx, method, chunk)
+	if err != nil {
+		return err
+	}
+
+	var taken bool
+	if err := c.UnmarshalAck(result, &taken); err != nil {
+		return err
+	}
+	if !taken {
+		return ErrorTransferAborted
+	}
+	return nil
+}
+
+/**
+Get id of next outgoing transfer, unique within channel
+*/
+func (c *Channel) nextTransferId() string {
+	c.transfersLock.Lock()
+	defer c.transfersLock.Unlock()
+
+	c.transferId++
+	return strconv.Itoa(c.transferId)
+}
+
+/**
+Receive stream transfers sent with SendStream to given method
+*/
+func (m *methods) OnStream(method string, f StreamHandler) error {
+	return m.On(method, func(c *Channel, chunk TransferChunk) bool {
+		return c.receiveChunk(m, f, &chunk)
+	})
+}
+
+/**
+Pass chunk data to reader of transfer when all previous chunks are read.
+Returns false if transfer is aborted
+*/
+func (c *Channel) receiveChunk(m *methods, f StreamHandler, chunk *TransferChunk) bool {
+	t := c.incomingTransfer(m, f, chunk)
+	if t == nil {
+		return false
+	}
+	if chunk.Abort {
+		t.finish(ErrorTransferAborted)
+		return false
+	}
+
+	t.lock.Lock()
+	for t.next != chunk.Seq && t.next >= 0 {
+		t.cond.Wait()
+	}
+	t.lock.Unlock()
+
+	//chunks are written one by one, writes are gated by sequence
+	var err error
+	if t.next >= 0 && len(chunk.Data) > 0 {
+		_, err = t.w.Write(chunk.Data)
+	}
+
+	t.lock.Lock()
+	aborted := t.next < 0
+	if !aborted {
+		t.next++
+	}
+	t.cond.Broadcast()
+	t.lock.Unlock()
+
+	if aborted || err != nil {
+		return false
+	}
+	if chunk.Last {
+		t.finish(nil)
+	}
+	return true
+}
+
+/**
+Get transfer of incoming chunk, new one is started with stream handler.
+Returns nil for abort chunk of unknown transfer
+*/
+func (c *Channel) incomingTransfer(m *methods, f StreamHandler,
+	chunk *TransferChunk) *incomingTransfer {
+
+	c.transfersLock.Lock()
+	defer c.transfersLock.Unlock()
+
+	if t, ok := c.transfers[chunk.Id]; ok {
+		return t
+	}
+	if chunk.Abort {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	t := &incomingTransfer{w: pw, done: make(chan struct{})}
+	t.cond = sync.NewCond(&t.lock)
+	if c.transfers == nil {
+		c.transfers = make(map[string]*incomingTransfer)
+	}
+	c.transfers[chunk.Id] = t
+
+	go func() {
+		defer t.finish(ErrorTransferAborted)
+		defer pr.CloseWithError(ErrorTransferAborted)
+		defer m.recoverPanic(c)
+
+		f(c, chunk.Id, pr)
+	}()
+	go func() {
+		select {
+		case <-c.closedSignal():
+			t.finish(ErrorChannelClosed)
+		case <-t.done:
+		}
+		time.AfterFunc(transferLinger, func() {
+			c.removeTransfer(chunk.Id)
+		})
+	}()
+
+	return t
+}
+
+func (c *Channel) removeTransfer(id string) {
+	c.transfersLock.Lock()
+	defer c.transfersLock.Unlock()
+
+	delete(c.transfers, id)
+}
+
+/**
+Complete transfer, reader receives io.EOF if err is nil.
+Waiting chunks are released, next ones are rejected
+*/
+func (t *incomingTransfer) finish(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.next < 0 {
+		return
+	}
+	t.next = -1
+	t.cond.Broadcast()
+	close(t.done)
+
+	if err == nil {
+		t.w.Close()
+		return
+	}
+	t.w.CloseWithError(err)
+}
@@ -0,0 +1,61 @@
+package gosocketio
+
+import (
+	"github.com/graarh/golang-socketio/protocol"
+)
+
+/**
+Outgoing packet transform, called for every encoded packet right before
+it is written, engine.io ping and pong packets excluded. Returned packet
+is written instead, e.g. with audit metadata, compressed or redacted.
+Empty packet is dropped, error drops packet and is passed to error handler
+*/
+type OutgoingTransform func(c *Channel, packet string) (string, error)
+
+/**
+Add transform of packets written by channel, after server ones,
+transforms are called in the order they were added
+*/
+func (c *Channel) AddOutgoingTransform(f OutgoingTransform) {
+	c.transformsLock.Lock()
+	defer c.transformsLock.Unlock()
+
+	c.transforms = append(c.transforms, f)
+}
+
+/**
+Run transforms for packets to write, packets are not changed in place
+*/
+func (c *Channel) transformOutgoing(m *methods, msgs []string) []string {
+	c.transformsLock.RLock()
+	transforms := c.transforms
+	c.transformsLock.RUnlock()
+
+	if len(transforms) == 0 {
+		return msgs
+	}
+
+	result := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg == protocol.PingMessage || msg == protocol.PongMessage {
+			result = append(result, msg)
+			continue
+		}
+
+		var err error
+		for _, f := range transforms {
+			if msg, err = f(c, msg); err != nil || msg == "" {
+				break
+			}
+		}
+		if err != nil {
+			m.callErrorHandler(c, channelError(c, "", err))
+			continue
+		}
+		if msg != "" {
+			result = append(result, msg)
+		}
+	}
+
+	return result
+}
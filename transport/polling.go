@@ -0,0 +1,679 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	PollingTransportName   = "polling"
+	WebsocketTransportName = "websocket"
+
+	//engine.io protocol versions, see ProtocolVersion
+	ProtocolV3 = 3
+	ProtocolV4 = 4
+
+	PlDefaultPingInterval   = 30 * time.Second
+	PlDefaultPingTimeout    = 60 * time.Second
+	PlDefaultReceiveTimeout = 60 * time.Second
+	PlDefaultSendTimeout    = 60 * time.Second
+	PlDefaultMaxPayload     = 1000000
+
+	noopMessage  = "6"
+	closeMessage = "1"
+	pollingOk    = "ok"
+	contentType  = "text/plain; charset=UTF-8"
+
+	//packets separator of engine.io v4 payload
+	payloadSeparator = "\x1e"
+)
+
+var (
+	ErrorConnectionClosed = errors.New("Connection closed")
+	ErrorReceiveTimeout   = errors.New("Receive timeout")
+	ErrorSendTimeout      = errors.New("Send timeout")
+	ErrorWrongPayload     = errors.New("Wrong payload")
+	ErrorDuplicatePoll    = errors.New("Overlapping poll request")
+	ErrorPayloadTooLarge  = errors.New("Payload too large")
+)
+
+/**
+Server side long polling connection, served by sequence of http requests
+*/
+type PollingConnection struct {
+	transport *PollingTransport
+
+	in  chan string
+	out chan string
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	polling     bool
+	pollingLock sync.Mutex
+
+	//engine.io protocol version of client, sets payload encoding
+	version int
+
+	//override transport ping params if set
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	pingLock     sync.RWMutex
+
+	//override transport max payload if set
+	maxPayload int
+}
+
+func (plc *PollingConnection) GetMessage() (message string, err error) {
+	interval, timeout := plc.PingParams()
+	select {
+	case message = <-plc.in:
+		return message, nil
+	case <-plc.closed:
+		return "", ErrorConnectionClosed
+	case <-time.After(readTimeout(interval, timeout, plc.transport.ReceiveTimeout)):
+		return "", ErrorReceiveTimeout
+	}
+}
+
+func (plc *PollingConnection) WriteMessage(message string) error {
+	return plc.WriteMessageTimeout(message, false, plc.transport.SendTimeout)
+}
+
+func (plc *PollingConnection) WriteMessageTimeout(message string, binary bool,
+	timeout time.Duration) error {
+
+	if binary {
+		return ErrorBinaryMessage
+	}
+
+	select {
+	case plc.out <- message:
+		return nil
+	case <-plc.closed:
+		return ErrorConnectionClosed
+	case <-time.After(timeout):
+		return ErrorSendTimeout
+	}
+}
+
+func (plc *PollingConnection) Close() {
+	plc.closeOnce.Do(func() {
+		close(plc.closed)
+	})
+}
+
+func (plc *PollingConnection) PingParams() (interval, timeout time.Duration) {
+	plc.pingLock.RLock()
+	defer plc.pingLock.RUnlock()
+
+	if plc.pingInterval > 0 {
+		return plc.pingInterval, plc.pingTimeout
+	}
+	return plc.transport.PingInterval, plc.transport.PingTimeout
+}
+
+func (plc *PollingConnection) SetPingParams(interval, timeout time.Duration) {
+	plc.pingLock.Lock()
+	defer plc.pingLock.Unlock()
+
+	plc.pingInterval = interval
+	plc.pingTimeout = timeout
+}
+
+func (plc *PollingConnection) SetMaxPayload(size int) {
+	plc.maxPayload = size
+}
+
+/**
+Serve poll (GET) or send (POST) request of this connection
+*/
+func (plc *PollingConnection) ServeRequest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		plc.poll(w)
+	case "POST":
+		plc.receive(w, r)
+	default:
+		http.Error(w, ErrorMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+	}
+}
+
+/**
+Complete pending poll request with noop packet, used while upgrading
+*/
+func (plc *PollingConnection) Flush() {
+	select {
+	case plc.out <- noopMessage:
+	default:
+	}
+}
+
+/**
+Wait for outgoing messages and send them all in one payload
+*/
+func (plc *PollingConnection) poll(w http.ResponseWriter) {
+	plc.pollingLock.Lock()
+	if plc.polling {
+		plc.pollingLock.Unlock()
+		http.Error(w, ErrorDuplicatePoll.Error(), http.StatusBadRequest)
+		return
+	}
+	plc.polling = true
+	plc.pollingLock.Unlock()
+
+	defer func() {
+		plc.pollingLock.Lock()
+		plc.polling = false
+		plc.pollingLock.Unlock()
+	}()
+
+	_, pingTimeout := plc.PingParams()
+	var messages []string
+	select {
+	case message := <-plc.out:
+		messages = append(messages, message)
+	case <-plc.closed:
+		messages = append(messages, closeMessage)
+	case <-time.After(pingTimeout):
+		messages = append(messages, noopMessage)
+	}
+
+	//send everything that is already queued in the same payload
+	for waiting := true; waiting; {
+		select {
+		case message := <-plc.out:
+			messages = append(messages, message)
+		default:
+			waiting = false
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if plc.version >= ProtocolV4 {
+		w.Write([]byte(EncodePayloadV4(messages)))
+		return
+	}
+	w.Write([]byte(EncodePayload(messages)))
+}
+
+/**
+Decode received payload and pass packets to the connection reader
+*/
+func (plc *PollingConnection) receive(w http.ResponseWriter, r *http.Request) {
+	maxPayload := plc.maxPayload
+	if maxPayload <= 0 {
+		maxPayload = plc.transport.maxPayload()
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxPayload)))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, ErrorPayloadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, ErrorBadBuffer.Error(), http.StatusBadRequest)
+		return
+	}
+
+	decode := DecodePayload
+	if plc.version >= ProtocolV4 {
+		decode = DecodePayloadV4
+	}
+	messages, err := decode(string(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, message := range messages {
+		select {
+		case plc.in <- message:
+		case <-plc.closed:
+			http.Error(w, ErrorConnectionClosed.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(pollingOk))
+}
+
+/**
+Client side long polling connection
+*/
+type pollingClientConnection struct {
+	transport *PollingTransport
+	url       string
+	client    *http.Client
+
+	queue []string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	//negotiated in handshake, transport ones are used if not set
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	pingLock     sync.RWMutex
+}
+
+func (plc *pollingClientConnection) GetMessage() (message string, err error) {
+	for len(plc.queue) == 0 {
+		plc.queue, err = plc.request("GET", "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	message = plc.queue[0]
+	plc.queue = plc.queue[1:]
+	return message, nil
+}
+
+func (plc *pollingClientConnection) WriteMessage(message string) error {
+	_, err := plc.request("POST", EncodePayload([]string{message}))
+	return err
+}
+
+func (plc *pollingClientConnection) Close() {
+	plc.cancel()
+}
+
+func (plc *pollingClientConnection) PingParams() (interval, timeout time.Duration) {
+	plc.pingLock.RLock()
+	defer plc.pingLock.RUnlock()
+
+	if plc.pingInterval > 0 {
+		return plc.pingInterval, plc.pingTimeout
+	}
+	return plc.transport.PingInterval, plc.transport.PingTimeout
+}
+
+func (plc *pollingClientConnection) SetPingParams(interval, timeout time.Duration) {
+	plc.pingLock.Lock()
+	defer plc.pingLock.Unlock()
+
+	plc.pingInterval = interval
+	plc.pingTimeout = timeout
+}
+
+/**
+Get timeout of one request, poll is answered by server at least once
+per ping interval negotiated in handshake
+*/
+func (plc *pollingClientConnection) requestTimeout() time.Duration {
+	plc.pingLock.RLock()
+	defer plc.pingLock.RUnlock()
+
+	if plc.pingInterval > 0 {
+		return plc.pingInterval + plc.pingTimeout
+	}
+	return plc.transport.PingTimeout + plc.transport.ReceiveTimeout
+}
+
+/**
+Make poll or send request and decode response payload
+*/
+func (plc *pollingClientConnection) request(method, body string) ([]string, error) {
+	req, err := http.NewRequest(method, plc.url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(plc.ctx, plc.requestTimeout())
+	defer cancel()
+	req = req.WithContext(ctx)
+	for name, values := range plc.transport.RequestHeader {
+		req.Header[name] = values
+	}
+	if method == "POST" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := plc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	//one byte over the limit tells too large payload from the limit sized one
+	maxPayload := plc.transport.maxPayload()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(maxPayload)+1))
+	if err != nil {
+		return nil, ErrorBadBuffer
+	}
+	if len(data) > maxPayload {
+		return nil, ErrorPayloadTooLarge
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(data)))
+	}
+	if method == "POST" {
+		return nil, nil
+	}
+
+	messages, err := DecodePayload(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, message := range messages {
+		if message != noopMessage {
+			result = append(result, message)
+		}
+	}
+	return result, nil
+}
+
+/**
+Engine.io long polling transport, can be upgraded to websocket
+*/
+type PollingTransport struct {
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	//used only if ping interval and timeout are not set
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	/**
+	Max size of polling request and response body in bytes,
+	PlDefaultMaxPayload if not set. Server connections use maxPayload
+	of server, see PayloadLimitConnection
+	*/
+	MaxPayload int
+
+	RequestHeader http.Header
+
+	/**
+	Called for every handshake request, returned headers are added
+	to handshake response of server connection, e.g. sticky session cookie
+	*/
+	ResponseHeader func(r *http.Request) http.Header
+
+	/**
+	Transport to upgrade polling connections to, nil disables upgrades
+	*/
+	UpgradeTo *WebsocketTransport
+
+	/**
+	Tls configuration of client connections, e.g. client certificates and root CAs
+	*/
+	TLSClientConfig *tls.Config
+
+	/**
+	Cookies of server responses, e.g. sticky session ones, are stored in jar
+	and sent with next requests and on reconnection
+	*/
+	Jar http.CookieJar
+
+	/**
+	Path of unix socket to connect to instead of url host, e.g. of sidecar,
+	url is still used for requests
+	*/
+	UnixSocket string
+
+	/**
+	Tcp options of client connections, e.g. keepalive. Options of server
+	connections are set by listener of http server, see SocketOptions.Listener
+	*/
+	SocketOptions *SocketOptions
+}
+
+/**
+Get max size of polling payload
+*/
+func (plt *PollingTransport) maxPayload() int {
+	if plt.MaxPayload > 0 {
+		return plt.MaxPayload
+	}
+	return PlDefaultMaxPayload
+}
+
+/**
+Get http client for polling requests of client connection
+*/
+func (plt *PollingTransport) httpClient() *http.Client {
+	//request timeout is set by connection, see pollingClientConnection.request
+	client := &http.Client{Jar: plt.Jar}
+	if plt.TLSClientConfig != nil || plt.UnixSocket != "" || plt.SocketOptions != nil {
+		tr := &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: plt.TLSClientConfig,
+		}
+		if plt.UnixSocket != "" {
+			tr.Proxy = nil
+			tr.DialContext = dialUnix(plt.UnixSocket)
+		}
+		if plt.SocketOptions != nil {
+			tr.DialContext = plt.SocketOptions.dialContext(tr.DialContext)
+		}
+		client.Transport = tr
+	}
+
+	return client
+}
+
+/**
+Connect to the server using long polling, upgrades are not supported here
+*/
+func (plt *PollingTransport) Connect(rawUrl string) (conn Connection, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	query := u.Query()
+	query.Set("transport", PollingTransportName)
+	u.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	plc := &pollingClientConnection{
+		transport: plt,
+		url:       u.String(),
+		client:    plt.httpClient(),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	//handshake response contains open packet with sid
+	plc.queue, err = plc.request("GET", "")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if len(plc.queue) == 0 || !strings.HasPrefix(plc.queue[0], "0") {
+		cancel()
+		return nil, ErrorPacketWrong
+	}
+
+	var hdr struct {
+		Sid string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(plc.queue[0][1:]), &hdr); err != nil {
+		cancel()
+		return nil, err
+	}
+	query.Set("sid", hdr.Sid)
+	u.RawQuery = query.Encode()
+	plc.url = u.String()
+
+	return plc, nil
+}
+
+func (plt *PollingTransport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
+
+	if plt.UpgradeTo != nil && (isWebsocketRequest(r) || isHttp2WebsocketRequest(r)) {
+		return plt.UpgradeTo.HandleConnection(w, r)
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, ErrorMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return nil, ErrorMethodNotAllowed
+	}
+
+	//handshake response is written later by connection itself
+	if plt.ResponseHeader != nil {
+		for key, values := range plt.ResponseHeader(r) {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
+
+	return &PollingConnection{
+		transport: plt,
+		in:        make(chan string),
+		out:       make(chan string),
+		closed:    make(chan struct{}),
+		version:   ProtocolVersion(r),
+	}, nil
+}
+
+func (plt *PollingTransport) Name() string {
+	return PollingTransportName
+}
+
+/**
+Polling requests are served by connection itself, see PollingConnection.ServeRequest.
+Websocket connections are served by upgrade transport
+*/
+func (plt *PollingTransport) Serve(w http.ResponseWriter, r *http.Request) {
+	if plt.UpgradeTo != nil {
+		plt.UpgradeTo.Serve(w, r)
+	}
+}
+
+/**
+Transports to which polling connection can be upgraded
+*/
+func (plt *PollingTransport) Upgrades() map[string]Transport {
+	if plt.UpgradeTo == nil {
+		return map[string]Transport{}
+	}
+
+	return map[string]Transport{WebsocketTransportName: plt.UpgradeTo}
+}
+
+/**
+Returns long polling transport with default params, upgradable to websocket
+*/
+func GetDefaultPollingTransport() *PollingTransport {
+	return &PollingTransport{
+		PingInterval:   PlDefaultPingInterval,
+		PingTimeout:    PlDefaultPingTimeout,
+		ReceiveTimeout: PlDefaultReceiveTimeout,
+		SendTimeout:    PlDefaultSendTimeout,
+		UpgradeTo:      GetDefaultWebsocketTransport(),
+	}
+}
+
+func isWebsocketRequest(r *http.Request) bool {
+	return r.URL.Query().Get("transport") == WebsocketTransportName
+}
+
+/**
+Encode packets to engine.io v3 text payload, length is counted in utf-16 units
+*/
+func EncodePayload(messages []string) string {
+	var result strings.Builder
+	for _, message := range messages {
+		length := len(utf16.Encode([]rune(message)))
+		result.WriteString(strconv.Itoa(length))
+		result.WriteByte(':')
+		result.WriteString(message)
+	}
+
+	return result.String()
+}
+
+/**
+Encode packets to engine.io v4 text payload, packets are separated
+by record separator
+*/
+func EncodePayloadV4(messages []string) string {
+	return strings.Join(messages, payloadSeparator)
+}
+
+/**
+Decode engine.io v4 text payload to packets
+*/
+func DecodePayloadV4(payload string) ([]string, error) {
+	if payload == "" {
+		return nil, ErrorWrongPayload
+	}
+
+	return strings.Split(payload, payloadSeparator), nil
+}
+
+/**
+Get engine.io protocol version of request by EIO query parameter,
+v3 is used if it is not set or not known
+*/
+func ProtocolVersion(r *http.Request) int {
+	if r.URL.Query().Get("EIO") == strconv.Itoa(ProtocolV4) {
+		return ProtocolV4
+	}
+	return ProtocolV3
+}
+
+/**
+Decode engine.io v3 text payload to packets
+*/
+func DecodePayload(payload string) ([]string, error) {
+	var messages []string
+	runes := []rune(payload)
+
+	for len(runes) > 0 {
+		pos := 0
+		for pos < len(runes) && runes[pos] != ':' {
+			pos++
+		}
+		if pos == len(runes) {
+			return nil, ErrorWrongPayload
+		}
+
+		length, err := strconv.Atoi(string(runes[:pos]))
+		if err != nil || length < 0 {
+			return nil, ErrorWrongPayload
+		}
+		runes = runes[pos+1:]
+
+		//count utf-16 units, surrogate pairs are two units
+		end, units := 0, 0
+		for end < len(runes) && units < length {
+			if runes[end] > 0xFFFF {
+				units += 2
+			} else {
+				units++
+			}
+			end++
+		}
+		if units != length {
+			return nil, ErrorWrongPayload
+		}
+
+		messages = append(messages, string(runes[:end]))
+		runes = runes[end:]
+	}
+
+	return messages, nil
+}
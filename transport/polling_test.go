@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var payloadTests = []struct {
+	name     string
+	messages []string
+}{
+	{"one packet", []string{`42["chat","hello"]`}},
+	{"several packets", []string{"2", `42["chat","hello"]`, "3probe"}},
+	{"empty packet", []string{"4", ""}},
+	{"separator like text", []string{`42["a:b","1:2"]`, "6"}},
+	{"multibyte", []string{`42["chat","привет"]`, `42["emoji","😀 ok"]`}},
+}
+
+/**
+Packets encoded to engine.io v3 payload should be decoded back,
+length prefix is counted in utf-16 units
+*/
+func TestPayloadRoundTrip(t *testing.T) {
+	for _, test := range payloadTests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EncodePayload(test.messages)
+			decoded, err := DecodePayload(payload)
+			if err != nil {
+				t.Fatalf("decoding of %q failed: %v", payload, err)
+			}
+			if !reflect.DeepEqual(decoded, test.messages) {
+				t.Fatalf("%q encoded as %q and decoded as %q", test.messages, payload, decoded)
+			}
+		})
+	}
+
+	if payload := EncodePayload([]string{"😀"}); payload != "2:😀" {
+		t.Fatalf("surrogate pair encoded as %q", payload)
+	}
+}
+
+func TestPayloadV4RoundTrip(t *testing.T) {
+	for _, test := range payloadTests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := EncodePayloadV4(test.messages)
+			decoded, err := DecodePayloadV4(payload)
+			if err != nil {
+				t.Fatalf("decoding of %q failed: %v", payload, err)
+			}
+			if !reflect.DeepEqual(decoded, test.messages) {
+				t.Fatalf("%q encoded as %q and decoded as %q", test.messages, payload, decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeWrongPayload(t *testing.T) {
+	for _, payload := range []string{
+		"2",
+		":2",
+		"x:2",
+		"-1:2",
+		"3:42",
+		"1:2" + "5:3probe",
+		"2:😀" + "1",
+		"2:4😀",
+	} {
+		if messages, err := DecodePayload(payload); err == nil {
+			t.Fatalf("%q decoded as %q, expected error", payload, messages)
+		}
+	}
+
+	if messages, err := DecodePayloadV4(""); err == nil {
+		t.Fatalf("empty v4 payload decoded as %q, expected error", messages)
+	}
+}
+
+/**
+Request bodies bigger than max payload are rejected with 413 status
+*/
+func TestPollingReceiveLimit(t *testing.T) {
+	plc := &PollingConnection{
+		transport: &PollingTransport{},
+		in:        make(chan string, 1),
+		closed:    make(chan struct{}),
+	}
+	plc.SetMaxPayload(10)
+
+	w := httptest.NewRecorder()
+	plc.ServeRequest(w, httptest.NewRequest("POST", "/", strings.NewReader(EncodePayload([]string{"4hello"}))))
+	if w.Code != http.StatusOK || <-plc.in != "4hello" {
+		t.Fatalf("payload within limit answered with %d status", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	plc.ServeRequest(w, httptest.NewRequest("POST", "/", strings.NewReader(EncodePayload([]string{"4hello world"}))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("payload over limit answered with %d status", w.Code)
+	}
+}
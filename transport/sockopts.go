@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+/**
+Options of tcp sockets of connections, zero values keep OS and Go defaults.
+Connections which are not tcp ones, e.g. unix sockets or http/2 streams,
+are not changed
+*/
+type SocketOptions struct {
+	//period of tcp keepalive probes, e.g. for connections idle behind NAT,
+	//negative value disables keepalive
+	KeepAlive time.Duration
+
+	//enable Nagle's algorithm, Go disables it by default
+	DelayWrites bool
+
+	//sizes of OS socket buffers
+	ReadBuffer  int
+	WriteBuffer int
+
+	//called after options are set, e.g. to set other options with SyscallConn
+	Configure func(conn *net.TCPConn) error
+}
+
+/**
+Set options of tcp connection, tls connection options are set
+to underlying one. Nil options do nothing
+*/
+func (o *SocketOptions) Apply(conn net.Conn) error {
+	if o == nil {
+		return nil
+	}
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapped.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if o.KeepAlive < 0 {
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	} else if o.KeepAlive > 0 {
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if o.DelayWrites {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	if o.Configure != nil {
+		return o.Configure(tcpConn)
+	}
+
+	return nil
+}
+
+/**
+Wrap listener, so options are set for accepted connections, e.g. ones
+of http server serving polling requests. Connections failed to be
+configured are closed
+*/
+func (o *SocketOptions) Listener(l net.Listener) net.Listener {
+	return &optionsListener{Listener: l, options: o}
+}
+
+type optionsListener struct {
+	net.Listener
+	options *SocketOptions
+}
+
+func (l *optionsListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.options.Apply(conn); err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+/**
+Wrap dial function, so options are set for dialed connections.
+Net dialer is used if dial is nil
+*/
+func (o *SocketOptions) dialContext(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := o.Apply(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
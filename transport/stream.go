@@ -0,0 +1,198 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	//frame header: one byte of frame type and four bytes of payload length
+	streamHeaderSize  = 5
+	streamFrameText   = 0
+	streamFrameBinary = 1
+
+	StreamDefaultMaxFrameSize = 1024 * 1024 * 16
+)
+
+var (
+	ErrorFrameTooLarge = errors.New("Frame is too large")
+)
+
+/**
+Parameters of stream connection, see NewStreamConnection
+*/
+type StreamParams struct {
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	//used only if ping interval and timeout are not set
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	//bigger incoming frames close the connection,
+	//StreamDefaultMaxFrameSize if not set
+	MaxFrameSize int
+}
+
+/**
+Stream which read and write deadlines can be set, e.g. net.Conn or quic stream
+*/
+type deadlineStream interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+/**
+Connection exchanging length-prefixed frames over byte stream, used by
+transports without own message framing, like raw tcp or WebTransport
+*/
+type StreamConnection struct {
+	stream io.ReadWriteCloser
+	reader *bufio.Reader
+	params StreamParams
+
+	readBuf []byte
+
+	writeLock sync.Mutex
+	writeBuf  []byte
+
+	//negotiated in handshake, params ones are used if not set
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	pingLock     sync.RWMutex
+}
+
+/**
+Wrap byte stream into connection, stream is closed with connection
+*/
+func NewStreamConnection(stream io.ReadWriteCloser, params StreamParams) *StreamConnection {
+	if params.MaxFrameSize <= 0 {
+		params.MaxFrameSize = StreamDefaultMaxFrameSize
+	}
+
+	return &StreamConnection{
+		stream: stream,
+		reader: bufio.NewReader(stream),
+		params: params,
+	}
+}
+
+func (sc *StreamConnection) GetMessage() (message string, err error) {
+	data, err := sc.GetMessageBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+/**
+Receive one more frame into connection read buffer, which is reused
+*/
+func (sc *StreamConnection) GetMessageBytes() ([]byte, error) {
+	if ds, ok := sc.stream.(deadlineStream); ok {
+		interval, timeout := sc.PingParams()
+		timeout = readTimeout(interval, timeout, sc.params.ReceiveTimeout)
+		ds.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	var header [streamHeaderSize]byte
+	if _, err := io.ReadFull(sc.reader, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != streamFrameText && header[0] != streamFrameBinary {
+		return nil, ErrorPacketWrong
+	}
+
+	size := int(binary.BigEndian.Uint32(header[1:]))
+	if size > sc.params.MaxFrameSize {
+		return nil, ErrorFrameTooLarge
+	}
+	//empty messages are not allowed
+	if size == 0 {
+		return nil, ErrorPacketWrong
+	}
+
+	if cap(sc.readBuf) < size || cap(sc.readBuf) > wsMaxKeptBufferSize {
+		sc.readBuf = make([]byte, size)
+	}
+	sc.readBuf = sc.readBuf[:size]
+	if _, err := io.ReadFull(sc.reader, sc.readBuf); err != nil {
+		return nil, err
+	}
+
+	return sc.readBuf, nil
+}
+
+func (sc *StreamConnection) WriteMessage(message string) error {
+	return sc.write(streamFrameText, []byte(message), sc.params.SendTimeout)
+}
+
+func (sc *StreamConnection) WriteBinaryMessage(message string) error {
+	return sc.write(streamFrameBinary, []byte(message), sc.params.SendTimeout)
+}
+
+func (sc *StreamConnection) WriteMessageTimeout(message string, binary bool,
+	timeout time.Duration) error {
+
+	if binary {
+		return sc.write(streamFrameBinary, []byte(message), timeout)
+	}
+	return sc.write(streamFrameText, []byte(message), timeout)
+}
+
+func (sc *StreamConnection) WriteMessageBytes(message []byte, binary bool) error {
+	if binary {
+		return sc.write(streamFrameBinary, message, sc.params.SendTimeout)
+	}
+	return sc.write(streamFrameText, message, sc.params.SendTimeout)
+}
+
+/**
+Write one frame, header and payload are written at once
+*/
+func (sc *StreamConnection) write(frameType byte, message []byte, timeout time.Duration) error {
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+
+	if ds, ok := sc.stream.(deadlineStream); ok && timeout > 0 {
+		ds.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	size := streamHeaderSize + len(message)
+	if cap(sc.writeBuf) < size || cap(sc.writeBuf) > wsMaxKeptBufferSize {
+		sc.writeBuf = make([]byte, size)
+	}
+	sc.writeBuf = sc.writeBuf[:size]
+	sc.writeBuf[0] = frameType
+	binary.BigEndian.PutUint32(sc.writeBuf[1:], uint32(len(message)))
+	copy(sc.writeBuf[streamHeaderSize:], message)
+
+	_, err := sc.stream.Write(sc.writeBuf)
+	return err
+}
+
+func (sc *StreamConnection) Close() {
+	sc.stream.Close()
+}
+
+func (sc *StreamConnection) PingParams() (interval, timeout time.Duration) {
+	sc.pingLock.RLock()
+	defer sc.pingLock.RUnlock()
+
+	if sc.pingInterval > 0 {
+		return sc.pingInterval, sc.pingTimeout
+	}
+	return sc.params.PingInterval, sc.params.PingTimeout
+}
+
+func (sc *StreamConnection) SetPingParams(interval, timeout time.Duration) {
+	sc.pingLock.Lock()
+	defer sc.pingLock.Unlock()
+
+	sc.pingInterval = interval
+	sc.pingTimeout = timeout
+}
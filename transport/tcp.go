@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	TcpTransportName = "tcp"
+
+	TcpDefaultPingInterval   = 30 * time.Second
+	TcpDefaultPingTimeout    = 60 * time.Second
+	TcpDefaultReceiveTimeout = 60 * time.Second
+	TcpDefaultSendTimeout    = 60 * time.Second
+	TcpDefaultDialTimeout    = 10 * time.Second
+)
+
+var (
+	ErrorHttpNotSupported = errors.New("Http requests are not supported")
+)
+
+/**
+Raw tcp transport for service-to-service connections, without http and
+websocket overhead. Messages are sent as length-prefixed frames, see
+StreamConnection. Server connections are accepted by Server.ServeListener,
+wrap listener with tls.NewListener to use tls
+*/
+type TcpTransport struct {
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	//used only if ping interval and timeout are not set
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+	DialTimeout    time.Duration
+
+	//bigger incoming frames close the connection
+	MaxFrameSize int
+
+	//tls configuration of client connections, used with wss, https
+	//and tls url schemes
+	TLSClientConfig *tls.Config
+
+	//tcp options of client and accepted connections, e.g. keepalive
+	SocketOptions *SocketOptions
+}
+
+func (t *TcpTransport) params() StreamParams {
+	return StreamParams{
+		PingInterval:   t.PingInterval,
+		PingTimeout:    t.PingTimeout,
+		ReceiveTimeout: t.ReceiveTimeout,
+		SendTimeout:    t.SendTimeout,
+		MaxFrameSize:   t.MaxFrameSize,
+	}
+}
+
+/**
+Connect to host and port of given url, path and query are not used,
+e.g. tcp://localhost:3811 or url made by GetUrl. Url with unix scheme
+connects to unix socket by its path, e.g. unix:///run/app.sock
+*/
+func (t *TcpTransport) Connect(rawUrl string) (conn Connection, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: t.DialTimeout}
+	var netConn net.Conn
+	switch u.Scheme {
+	case "wss", "https", "tls":
+		netConn, err = tls.DialWithDialer(dialer, "tcp", u.Host, t.TLSClientConfig)
+	case "unix":
+		netConn, err = dialer.Dial("unix", u.Path)
+	default:
+		netConn, err = dialer.Dial("tcp", u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.SocketOptions.Apply(netConn); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return NewStreamConnection(netConn, t.params()), nil
+}
+
+/**
+Wrap accepted tcp or tls connection, socket options are set if possible
+*/
+func (t *TcpTransport) NewConnection(netConn net.Conn) *StreamConnection {
+	//failed options keep OS defaults
+	t.SocketOptions.Apply(netConn)
+	return NewStreamConnection(netConn, t.params())
+}
+
+/**
+Tcp connections are not made by http requests
+*/
+func (t *TcpTransport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
+
+	http.Error(w, ErrorHttpNotSupported.Error(), http.StatusBadRequest)
+	return nil, ErrorHttpNotSupported
+}
+
+/**
+Tcp connections are not made by http requests
+*/
+func (t *TcpTransport) Serve(w http.ResponseWriter, r *http.Request) {}
+
+func (t *TcpTransport) Name() string {
+	return TcpTransportName
+}
+
+/**
+Returns tcp transport with default params
+*/
+func GetDefaultTcpTransport() *TcpTransport {
+	return &TcpTransport{
+		PingInterval:   TcpDefaultPingInterval,
+		PingTimeout:    TcpDefaultPingTimeout,
+		ReceiveTimeout: TcpDefaultReceiveTimeout,
+		SendTimeout:    TcpDefaultSendTimeout,
+		DialTimeout:    TcpDefaultDialTimeout,
+	}
+}
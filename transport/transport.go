@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"io"
 	"net/http"
 	"time"
 )
@@ -30,6 +31,152 @@ type Connection interface {
 	PingParams() (interval, timeout time.Duration)
 }
 
+/**
+Connection which ping parameters can be replaced by ones
+received from server in handshake
+*/
+type PingParamsConnection interface {
+	Connection
+
+	/**
+	Set ping interval and timeout returned by PingParams and used for read deadlines
+	*/
+	SetPingParams(interval, timeout time.Duration)
+}
+
+/**
+Connection which size of received payloads can be limited, e.g. by
+maxPayload sent to client in handshake
+*/
+type PayloadLimitConnection interface {
+	Connection
+
+	/**
+	Set max size of received payload in bytes, should be called
+	before connection is served
+	*/
+	SetMaxPayload(size int)
+}
+
+/**
+Connection that is able to send binary frames, required by binary parsers
+*/
+type BinaryConnection interface {
+	/**
+	Send given message as binary frame, block until sent
+	*/
+	WriteBinaryMessage(message string) error
+}
+
+/**
+Connection exchanging messages as bytes, without string conversions.
+Use ReadBytes and WriteBytes to work with any Connection this way
+*/
+type BytesConnection interface {
+	Connection
+
+	/**
+	Receive one more message, block until received.
+	Returned slice is valid until the next call only
+	*/
+	GetMessageBytes() ([]byte, error)
+
+	/**
+	Send given message, as binary frame if binary is set, block until sent.
+	Message slice is not retained
+	*/
+	WriteMessageBytes(message []byte, binary bool) error
+}
+
+/**
+Connection that tells frame type of received messages, so binary
+packets can be decoded by protocol layer accordingly
+*/
+type FrameTypeConnection interface {
+	/**
+	Check that the last received message came as binary frame.
+	Called by reader only, after message is received
+	*/
+	LastMessageBinary() bool
+}
+
+/**
+Connection that is able to stream incoming messages, so big ones
+are not kept in memory as a whole
+*/
+type ReaderConnection interface {
+	/**
+	Get reader of the next message, block until it is started.
+	Reader is valid until the next call only
+	*/
+	NextReader() (io.Reader, error)
+}
+
+/**
+Connection that is able to use different write timeout for each message
+*/
+type TimeoutConnection interface {
+	/**
+	Send given message, as binary frame if binary is set,
+	fail if it is not sent within timeout
+	*/
+	WriteMessageTimeout(message string, binary bool, timeout time.Duration) error
+}
+
+/**
+Compression of written messages, see CompressionConnection
+*/
+type Compression int
+
+const (
+	/**
+	Compression is chosen by transport, e.g. by message size
+	*/
+	CompressionDefault Compression = iota
+	CompressionOn
+	CompressionOff
+)
+
+/**
+Connection that is able to compress messages, if compression
+is negotiated with remote side
+*/
+type CompressionConnection interface {
+	/**
+	Set compression of the next written messages
+	*/
+	SetWriteCompression(mode Compression)
+}
+
+/**
+Connection that is able to send several messages in a row at once
+*/
+type BatchConnection interface {
+	/**
+	Send given messages, binary flags mark messages to be sent as binary
+	frames. Write deadline is set once for the whole batch, zero timeout
+	means transport default one. Returns amount of messages sent
+	*/
+	WriteMessages(messages []string, binary []bool, timeout time.Duration) (int, error)
+}
+
+/**
+Connection that is served by sequence of http requests, like long polling
+*/
+type HttpConnection interface {
+	Connection
+
+	/**
+	Serve one more http request of current connection
+	*/
+	ServeRequest(w http.ResponseWriter, r *http.Request)
+
+	/**
+	Complete pending request, if any, so client is able to upgrade
+	*/
+	Flush()
+}
+
 /**
 Connection factory for given transport
 */
@@ -49,3 +196,73 @@ type Transport interface {
 	*/
 	Serve(w http.ResponseWriter, r *http.Request)
 }
+
+/**
+Transport with engine.io name, sent by clients as transport query parameter
+*/
+type NamedTransport interface {
+	Transport
+
+	/**
+	Get transport name, e.g. "websocket"
+	*/
+	Name() string
+}
+
+/**
+Transport which connections can be upgraded to other transports
+*/
+type UpgradableTransport interface {
+	Transport
+
+	/**
+	Get transports to upgrade to, by their names
+	*/
+	Upgrades() map[string]Transport
+}
+
+/**
+Time to wait for any incoming data: ping is expected every interval and
+should be answered within timeout. Fallback is used if ping params are not set
+*/
+func readTimeout(interval, timeout, fallback time.Duration) time.Duration {
+	if interval+timeout > 0 {
+		return interval + timeout
+	}
+
+	return fallback
+}
+
+/**
+Receive one more message as bytes, string based connections are converted
+*/
+func ReadBytes(conn Connection) ([]byte, error) {
+	if bytesConn, ok := conn.(BytesConnection); ok {
+		return bytesConn.GetMessageBytes()
+	}
+
+	message, err := conn.GetMessage()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(message), nil
+}
+
+/**
+Send message given as bytes, string based connections are converted
+*/
+func WriteBytes(conn Connection, message []byte, binary bool) error {
+	if bytesConn, ok := conn.(BytesConnection); ok {
+		return bytesConn.WriteMessageBytes(message, binary)
+	}
+
+	if !binary {
+		return conn.WriteMessage(string(message))
+	}
+
+	binaryConn, ok := conn.(BinaryConnection)
+	if !ok {
+		return ErrorBinaryMessage
+	}
+	return binaryConn.WriteBinaryMessage(string(message))
+}
@@ -1,10 +1,15 @@
 package transport
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"github.com/gorilla/websocket"
-	"io/ioutil"
+	"io"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -16,6 +21,12 @@ const (
 	WsDefaultReceiveTimeout = 60 * time.Second
 	WsDefaultSendTimeout    = 60 * time.Second
 	WsDefaultBufferSize     = 1024 * 32
+
+	//bigger read buffer is released after the message is processed
+	wsMaxKeptBufferSize = WsDefaultBufferSize * 4
+
+	//close frame is not waited for longer on closing connection
+	wsCloseTimeout = time.Second
 )
 
 var (
@@ -29,42 +40,199 @@ var (
 type WebsocketConnection struct {
 	socket    *websocket.Conn
 	transport *WebsocketTransport
+
+	readBuf bytes.Buffer
+
+	//negotiated in handshake, transport ones are used if not set
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	pingLock     sync.RWMutex
+
+	//compression of written messages, set by writer only
+	compression Compression
+
+	//frame type of the last received message, set by reader only
+	lastBinary bool
+}
+
+/**
+Wrap socket, any incoming frame including websocket ping and pong
+extends the read deadline
+*/
+func newWebsocketConnection(socket *websocket.Conn, wst *WebsocketTransport) *WebsocketConnection {
+	wsc := &WebsocketConnection{socket: socket, transport: wst}
+	socket.SetPingHandler(func(data string) error {
+		wsc.refreshReadDeadline()
+		return socket.WriteControl(websocket.PongMessage, []byte(data),
+			time.Now().Add(wst.SendTimeout))
+	})
+	socket.SetPongHandler(func(string) error {
+		wsc.refreshReadDeadline()
+		return nil
+	})
+
+	return wsc
+}
+
+/**
+Move read deadline forward, derived from ping interval and timeout
+*/
+func (wsc *WebsocketConnection) refreshReadDeadline() {
+	interval, timeout := wsc.PingParams()
+	timeout = readTimeout(interval, timeout, wsc.transport.ReceiveTimeout)
+	wsc.socket.SetReadDeadline(time.Now().Add(timeout))
 }
 
 func (wsc *WebsocketConnection) GetMessage() (message string, err error) {
-	wsc.socket.SetReadDeadline(time.Now().Add(wsc.transport.ReceiveTimeout))
-	msgType, reader, err := wsc.socket.NextReader()
+	data, err := wsc.GetMessageBytes()
 	if err != nil {
 		return "", err
 	}
 
-	//support only text messages exchange
-	if msgType != websocket.TextMessage {
-		return "", ErrorBinaryMessage
+	return string(data), nil
+}
+
+/**
+Get reader of the next message, message is not buffered
+*/
+func (wsc *WebsocketConnection) NextReader() (io.Reader, error) {
+	wsc.refreshReadDeadline()
+	msgType, reader, err := wsc.socket.NextReader()
+	if err != nil {
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(reader)
+	//binary messages are used by binary parsers only
+	if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+		return nil, ErrorBinaryMessage
+	}
+	wsc.lastBinary = msgType == websocket.BinaryMessage
+
+	return reader, nil
+}
+
+/**
+Check that the last received message came as binary frame
+*/
+func (wsc *WebsocketConnection) LastMessageBinary() bool {
+	return wsc.lastBinary
+}
+
+/**
+Receive one more message into connection read buffer, which is reused
+*/
+func (wsc *WebsocketConnection) GetMessageBytes() ([]byte, error) {
+	reader, err := wsc.NextReader()
 	if err != nil {
-		return "", ErrorBadBuffer
+		return nil, err
+	}
+
+	if wsc.readBuf.Cap() > wsMaxKeptBufferSize {
+		wsc.readBuf = bytes.Buffer{}
+	}
+	wsc.readBuf.Reset()
+	if _, err := wsc.readBuf.ReadFrom(reader); err != nil {
+		return nil, ErrorBadBuffer
 	}
-	text := string(data)
 
 	//empty messages are not allowed
-	if len(text) == 0 {
-		return "", ErrorPacketWrong
+	if wsc.readBuf.Len() == 0 {
+		return nil, ErrorPacketWrong
 	}
 
-	return text, nil
+	return wsc.readBuf.Bytes(), nil
 }
 
 func (wsc *WebsocketConnection) WriteMessage(message string) error {
-	wsc.socket.SetWriteDeadline(time.Now().Add(wsc.transport.SendTimeout))
-	writer, err := wsc.socket.NextWriter(websocket.TextMessage)
+	return wsc.write(websocket.TextMessage, message, wsc.transport.SendTimeout)
+}
+
+func (wsc *WebsocketConnection) WriteBinaryMessage(message string) error {
+	return wsc.write(websocket.BinaryMessage, message, wsc.transport.SendTimeout)
+}
+
+func (wsc *WebsocketConnection) WriteMessageTimeout(message string, binary bool,
+	timeout time.Duration) error {
+
+	if binary {
+		return wsc.write(websocket.BinaryMessage, message, timeout)
+	}
+	return wsc.write(websocket.TextMessage, message, timeout)
+}
+
+func (wsc *WebsocketConnection) WriteMessageBytes(message []byte, binary bool) error {
+	if binary {
+		return wsc.writeBytes(websocket.BinaryMessage, message, wsc.transport.SendTimeout)
+	}
+	return wsc.writeBytes(websocket.TextMessage, message, wsc.transport.SendTimeout)
+}
+
+func (wsc *WebsocketConnection) write(msgType int, message string, timeout time.Duration) error {
+	return wsc.writeBytes(msgType, []byte(message), timeout)
+}
+
+func (wsc *WebsocketConnection) WriteMessages(messages []string, binary []bool,
+	timeout time.Duration) (int, error) {
+
+	if timeout <= 0 {
+		timeout = wsc.transport.SendTimeout
+	}
+	wsc.socket.SetWriteDeadline(time.Now().Add(timeout))
+
+	for i, message := range messages {
+		msgType := websocket.TextMessage
+		if binary[i] {
+			msgType = websocket.BinaryMessage
+		}
+		if err := wsc.writeFrame(msgType, []byte(message)); err != nil {
+			return i, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (wsc *WebsocketConnection) writeBytes(msgType int, message []byte, timeout time.Duration) error {
+	wsc.socket.SetWriteDeadline(time.Now().Add(timeout))
+	return wsc.writeFrame(msgType, message)
+}
+
+/**
+Set compression of the next written messages, messages are compressed
+only if EnableCompression is set and compression is negotiated
+*/
+func (wsc *WebsocketConnection) SetWriteCompression(mode Compression) {
+	wsc.compression = mode
+}
+
+/**
+Check that message should be compressed, by default messages shorter
+than compression threshold are not
+*/
+func (wsc *WebsocketConnection) compressMessage(size int) bool {
+	switch wsc.compression {
+	case CompressionOn:
+		return true
+	case CompressionOff:
+		return false
+	}
+
+	return size >= wsc.transport.CompressionThreshold
+}
+
+/**
+Write one frame, write deadline should be already set
+*/
+func (wsc *WebsocketConnection) writeFrame(msgType int, message []byte) error {
+	if wsc.transport.EnableCompression {
+		wsc.socket.EnableWriteCompression(wsc.compressMessage(len(message)))
+	}
+	writer, err := wsc.socket.NextWriter(msgType)
 	if err != nil {
 		return err
 	}
 
-	if _, err := writer.Write([]byte(message)); err != nil {
+	if _, err := writer.Write(message); err != nil {
 		return err
 	}
 	if err := writer.Close(); err != nil {
@@ -73,56 +241,275 @@ func (wsc *WebsocketConnection) WriteMessage(message string) error {
 	return nil
 }
 
+/**
+Send close frame with normal closure code, so remote side sees clean
+disconnection instead of read error, and close the socket
+*/
 func (wsc *WebsocketConnection) Close() {
+	wsc.socket.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(wsCloseTimeout))
 	wsc.socket.Close()
 }
 
 func (wsc *WebsocketConnection) PingParams() (interval, timeout time.Duration) {
+	wsc.pingLock.RLock()
+	defer wsc.pingLock.RUnlock()
+
+	if wsc.pingInterval > 0 {
+		return wsc.pingInterval, wsc.pingTimeout
+	}
 	return wsc.transport.PingInterval, wsc.transport.PingTimeout
 }
 
+func (wsc *WebsocketConnection) SetPingParams(interval, timeout time.Duration) {
+	wsc.pingLock.Lock()
+	defer wsc.pingLock.Unlock()
+
+	wsc.pingInterval = interval
+	wsc.pingTimeout = timeout
+}
+
+/**
+Pool of write buffers shared by websocket connections, *sync.Pool is one
+*/
+type BufferPool interface {
+	Get() interface{}
+	Put(interface{})
+}
+
 type WebsocketTransport struct {
-	PingInterval   time.Duration
-	PingTimeout    time.Duration
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	//used only if ping interval and timeout are not set
 	ReceiveTimeout time.Duration
 	SendTimeout    time.Duration
 
 	BufferSize int
+	//separate sizes of read and write buffers, override BufferSize
+	ReadBufferSize  int
+	WriteBufferSize int
+	//write buffers shared by connections of client and server, e.g. &sync.Pool{},
+	//buffers are taken only while writing, so idle connections keep none
+	WriteBufferPool BufferPool
+
+	//max duration of websocket handshake of client and server connections,
+	//gorilla defaults are used if not set
+	HandshakeTimeout time.Duration
+
+	//negotiate permessage-deflate compression with remote side,
+	//messages shorter than threshold are not compressed unless
+	//compression is set for them, see CompressionConnection
+	EnableCompression    bool
+	CompressionThreshold int
 
 	RequestHeader http.Header
+
+	//called for every handshake request, returned headers are added to
+	//101 response of server connection, e.g. sticky session cookie
+	ResponseHeader func(r *http.Request) http.Header
+
+	//client dialer, e.g. with handshake timeout, proxy or subprotocols,
+	//zero value dialer is used if not set
+	Dialer *websocket.Dialer
+
+	//tls configuration of client connections, e.g. client certificates
+	//and root CAs, overrides one of Dialer
+	TLSClientConfig *tls.Config
+
+	//cookies of handshake responses, e.g. sticky session ones, are stored
+	//in jar and sent on reconnection, overrides one of Dialer
+	Jar http.CookieJar
+
+	//path of unix socket to connect to instead of url host, e.g. of sidecar,
+	//url is still used for handshake request. Overrides net dial of Dialer
+	UnixSocket string
+
+	//dial function of client connections, e.g. with custom resolver, local
+	//address or tunnel, overrides one of Dialer. UnixSocket takes precedence
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	//tcp options of client and server connections, e.g. keepalive
+	SocketOptions *SocketOptions
+
+	//client connecting with websocket over http/2 extended CONNECT, RFC 8441,
+	//e.g. one using golang.org/x/net/http2 transport. Http/1.1 is used if not set
+	HTTP2Client *http.Client
+
+	//http/2 server connections by their requests, until they are served
+	http2Conns sync.Map
+}
+
+/**
+Get dialer used by client connections
+*/
+func (wst *WebsocketTransport) dialer() *websocket.Dialer {
+	if wst.Dialer != nil && wst.TLSClientConfig == nil && wst.Jar == nil &&
+		wst.UnixSocket == "" && wst.NetDialContext == nil && !wst.EnableCompression &&
+		wst.SocketOptions == nil && wst.HandshakeTimeout == 0 &&
+		wst.ReadBufferSize == 0 && wst.WriteBufferSize == 0 && wst.WriteBufferPool == nil {
+		return wst.Dialer
+	}
+
+	dialer := &websocket.Dialer{}
+	if wst.Dialer != nil {
+		//user dialer is not modified
+		copied := *wst.Dialer
+		dialer = &copied
+	}
+	if wst.TLSClientConfig != nil {
+		dialer.TLSClientConfig = wst.TLSClientConfig
+	}
+	if wst.Jar != nil {
+		dialer.Jar = wst.Jar
+	}
+	if wst.EnableCompression {
+		dialer.EnableCompression = true
+	}
+	if wst.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = wst.HandshakeTimeout
+	}
+	//sizes of user dialer are kept unless separate sizes are set
+	read, write := wst.bufferSizes()
+	if read > 0 && (dialer.ReadBufferSize == 0 || wst.ReadBufferSize > 0) {
+		dialer.ReadBufferSize = read
+	}
+	if write > 0 && (dialer.WriteBufferSize == 0 || wst.WriteBufferSize > 0) {
+		dialer.WriteBufferSize = write
+	}
+	if wst.WriteBufferPool != nil {
+		dialer.WriteBufferPool = wst.WriteBufferPool
+	}
+	switch {
+	case wst.UnixSocket != "":
+		dialer.NetDial = nil
+		dialer.NetDialContext = dialUnix(wst.UnixSocket)
+	case wst.NetDialContext != nil:
+		dialer.NetDial = nil
+		dialer.NetDialContext = wst.NetDialContext
+	}
+	if wst.SocketOptions != nil {
+		if dialer.NetDialContext == nil && dialer.NetDial != nil {
+			netDial := dialer.NetDial
+			dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return netDial(network, addr)
+			}
+		}
+		dialer.NetDial = nil
+		dialer.NetDialContext = wst.SocketOptions.dialContext(dialer.NetDialContext)
+	}
+
+	return dialer
+}
+
+/**
+Get sizes of read and write buffers
+*/
+func (wst *WebsocketTransport) bufferSizes() (read, write int) {
+	read, write = wst.BufferSize, wst.BufferSize
+	if wst.ReadBufferSize > 0 {
+		read = wst.ReadBufferSize
+	}
+	if wst.WriteBufferSize > 0 {
+		write = wst.WriteBufferSize
+	}
+	return read, write
+}
+
+/**
+Get upgrader of server connections, origin is checked by server
+*/
+func (wst *WebsocketTransport) upgrader() *websocket.Upgrader {
+	read, write := wst.bufferSizes()
+	return &websocket.Upgrader{
+		HandshakeTimeout:  wst.HandshakeTimeout,
+		ReadBufferSize:    read,
+		WriteBufferSize:   write,
+		WriteBufferPool:   wst.WriteBufferPool,
+		EnableCompression: wst.EnableCompression,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+}
+
+/**
+Get dial function connecting to given unix socket, whatever address is requested
+*/
+func dialUnix(path string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path)
+	}
 }
 
 func (wst *WebsocketTransport) Connect(url string) (conn Connection, err error) {
-	dialer := websocket.Dialer{}
-	socket, _, err := dialer.Dial(url, wst.RequestHeader)
+	if wst.HTTP2Client != nil {
+		socket, err := wst.connectHttp2(url)
+		if err != nil {
+			return nil, err
+		}
+		return newWebsocketConnection(socket, wst), nil
+	}
+
+	socket, _, err := wst.dialer().Dial(url, wst.RequestHeader)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WebsocketConnection{socket, wst}, nil
+	return newWebsocketConnection(socket, wst), nil
 }
 
 func (wst *WebsocketTransport) HandleConnection(
 	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
 
+	header := http.Header{}
+	if wst.ResponseHeader != nil {
+		for key, values := range wst.ResponseHeader(r) {
+			header[key] = append(header[key], values...)
+		}
+	}
+	//headers set by outer handlers, e.g. cookies, are sent with upgrade response
+	for key, values := range w.Header() {
+		header[key] = append(header[key], values...)
+	}
+
+	if isHttp2WebsocketRequest(r) {
+		socket, err := wst.handleHttp2Connection(w, r, header)
+		if err != nil {
+			return nil, ErrorHttpUpgradeFailed
+		}
+		return newWebsocketConnection(socket, wst), nil
+	}
+
 	if r.Method != "GET" {
-		http.Error(w, upgradeFailed+ErrorMethodNotAllowed.Error(), 503)
+		http.Error(w, upgradeFailed+ErrorMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
 		return nil, ErrorMethodNotAllowed
 	}
 
-	socket, err := websocket.Upgrade(w, r, nil, wst.BufferSize, wst.BufferSize)
+	//error response with proper status, e.g. 400 for bad handshake,
+	//is already written by upgrader
+	socket, err := wst.upgrader().Upgrade(w, r, header)
 	if err != nil {
-		http.Error(w, upgradeFailed+err.Error(), 503)
 		return nil, ErrorHttpUpgradeFailed
 	}
+	//connection is already upgraded, failed options keep OS defaults
+	wst.SocketOptions.Apply(socket.UnderlyingConn())
+
+	return newWebsocketConnection(socket, wst), nil
+}
 
-	return &WebsocketConnection{socket, wst}, nil
+func (wst *WebsocketTransport) Name() string {
+	return WebsocketTransportName
 }
 
 /**
-Websocket connection do not require any additional processing
+Websocket connection do not require any additional processing,
+http/2 one is served until it is closed
 */
-func (wst *WebsocketTransport) Serve(w http.ResponseWriter, r *http.Request) {}
+func (wst *WebsocketTransport) Serve(w http.ResponseWriter, r *http.Request) {
+	wst.serveHttp2(r)
+}
 
 /**
 Returns websocket connection with default params
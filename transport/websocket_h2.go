@@ -0,0 +1,289 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//websocket accept key is hash of client key with this guid, RFC 6455
+	wsKeyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	h2Protocol = ":protocol"
+)
+
+var (
+	ErrorHttp2Handshake = errors.New("Http/2 websocket handshake failed")
+)
+
+/**
+Check that request is websocket bootstrapped by http/2 extended CONNECT, RFC 8441
+*/
+func isHttp2WebsocketRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect &&
+		strings.EqualFold(r.Header.Get(h2Protocol), "websocket")
+}
+
+type h2Addr string
+
+func (a h2Addr) Network() string { return "h2" }
+func (a h2Addr) String() string  { return string(a) }
+
+/**
+Http/2 stream represented as net.Conn, so websocket frames are processed
+by gorilla/websocket. Http/1.1 upgrade handshake is not sent to the stream:
+server 101 response is dropped, client one is emulated locally.
+Deadlines are not supported, dead connections are found by pings
+*/
+type h2Conn struct {
+	reader io.ReadCloser
+	writer io.WriteCloser
+	flush  func()
+	remote h2Addr
+
+	//client side: upgrade request is not written yet, emulated response
+	client    bool
+	handshake bytes.Buffer
+	response  *bytes.Reader
+	//server side: 101 response is not written yet
+	server bool
+
+	writeLock sync.Mutex
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (hc *h2Conn) Read(p []byte) (int, error) {
+	if hc.response != nil && hc.response.Len() > 0 {
+		return hc.response.Read(p)
+	}
+	return hc.reader.Read(p)
+}
+
+func (hc *h2Conn) Write(p []byte) (int, error) {
+	hc.writeLock.Lock()
+	defer hc.writeLock.Unlock()
+
+	//server handshake response is written at once
+	if hc.server {
+		hc.server = false
+		if bytes.HasPrefix(p, []byte("HTTP/1.1 101")) {
+			return len(p), nil
+		}
+	}
+	if hc.client {
+		return hc.writeClientHandshake(p)
+	}
+
+	n, err := hc.writer.Write(p)
+	if err == nil && hc.flush != nil {
+		hc.flush()
+	}
+	return n, err
+}
+
+/**
+Collect http/1.1 upgrade request of websocket client and prepare
+response accepting its key, request is not sent to the stream
+*/
+func (hc *h2Conn) writeClientHandshake(p []byte) (int, error) {
+	hc.handshake.Write(p)
+	if !bytes.Contains(hc.handshake.Bytes(), []byte("\r\n\r\n")) {
+		return len(p), nil
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(&hc.handshake))
+	if _, err := reader.ReadLine(); err != nil {
+		return 0, ErrorHttp2Handshake
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return 0, ErrorHttp2Handshake
+	}
+
+	hc.client = false
+	hc.response = bytes.NewReader([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"))
+	return len(p), nil
+}
+
+func (hc *h2Conn) Close() error {
+	hc.closeOnce.Do(func() {
+		close(hc.closed)
+		hc.writer.Close()
+		hc.reader.Close()
+	})
+	return nil
+}
+
+func (hc *h2Conn) LocalAddr() net.Addr                { return h2Addr("") }
+func (hc *h2Conn) RemoteAddr() net.Addr               { return hc.remote }
+func (hc *h2Conn) SetDeadline(t time.Time) error      { return nil }
+func (hc *h2Conn) SetReadDeadline(t time.Time) error  { return nil }
+func (hc *h2Conn) SetWriteDeadline(t time.Time) error { return nil }
+
+/**
+Response writer of extended CONNECT request, that can be hijacked
+by websocket upgrader. Stream is accepted with 200 status on hijack
+*/
+type h2ResponseWriter struct {
+	http.ResponseWriter
+	conn *h2Conn
+}
+
+func (hw *h2ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hw.ResponseWriter.WriteHeader(http.StatusOK)
+	hw.conn.flush()
+
+	return hw.conn, bufio.NewReadWriter(bufio.NewReader(hw.conn), bufio.NewWriter(hw.conn)), nil
+}
+
+/**
+Nothing is written to stream body by closing writer, handler return closes it
+*/
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+/**
+Accept websocket bootstrapped by http/2 extended CONNECT. Request is turned
+into http/1.1 upgrade one, so handshake is validated by websocket upgrader
+*/
+func (wst *WebsocketTransport) handleHttp2Connection(w http.ResponseWriter, r *http.Request,
+	header http.Header) (*websocket.Conn, error) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, ErrorHttp2Handshake.Error(), http.StatusInternalServerError)
+		return nil, ErrorHttp2Handshake
+	}
+
+	conn := &h2Conn{
+		reader: r.Body,
+		writer: nopWriteCloser{w},
+		flush:  flusher.Flush,
+		remote: h2Addr(r.RemoteAddr),
+		server: true,
+		closed: make(chan struct{}),
+	}
+
+	upgrade := r.Clone(r.Context())
+	upgrade.Method = http.MethodGet
+	upgrade.Proto, upgrade.ProtoMajor, upgrade.ProtoMinor = "HTTP/1.1", 1, 1
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	upgrade.Header.Set("Sec-WebSocket-Key", newClientKey())
+	if upgrade.Header.Get("Sec-WebSocket-Version") == "" {
+		upgrade.Header.Set("Sec-WebSocket-Version", "13")
+	}
+
+	socket, err := wst.upgrader().Upgrade(&h2ResponseWriter{w, conn}, upgrade, header)
+	if err != nil {
+		return nil, err
+	}
+
+	wst.http2Conns.Store(r, conn)
+	return socket, nil
+}
+
+/**
+Keep handler of http/2 websocket running until connection is closed,
+stream is closed when handler returns
+*/
+func (wst *WebsocketTransport) serveHttp2(r *http.Request) {
+	value, ok := wst.http2Conns.Load(r)
+	if !ok {
+		return
+	}
+	wst.http2Conns.Delete(r)
+
+	select {
+	case <-value.(*h2Conn).closed:
+	case <-r.Context().Done():
+	}
+}
+
+/**
+Connect using http/2 extended CONNECT, client should support it,
+e.g. one using golang.org/x/net/http2 transport
+*/
+func (wst *WebsocketTransport) connectHttp2(rawUrl string) (*websocket.Conn, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	wsUrl := *u
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	wsUrl.Scheme = "ws"
+
+	body, bodyWriter := io.Pipe()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodConnect, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range wst.RequestHeader {
+		req.Header[key] = values
+	}
+	req.Header.Set(h2Protocol, "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	resp, err := wst.HTTP2Client.Do(req)
+	if err != nil {
+		bodyWriter.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		bodyWriter.Close()
+		return nil, ErrorHttp2Handshake
+	}
+
+	conn := &h2Conn{
+		reader: resp.Body,
+		writer: bodyWriter,
+		remote: h2Addr(u.Host),
+		client: true,
+		closed: make(chan struct{}),
+	}
+
+	read, write := wst.bufferSizes()
+	socket, _, err := websocket.NewClient(conn, &wsUrl, nil, read, write)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return socket, nil
+}
+
+func newClientKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func acceptKey(clientKey string) string {
+	hash := sha1.Sum([]byte(clientKey + wsKeyGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,165 @@
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"github.com/graarh/golang-socketio/transport"
+	wt "github.com/quic-go/webtransport-go"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	TransportName = "webtransport"
+
+	DefaultPingInterval   = 30 * time.Second
+	DefaultPingTimeout    = 60 * time.Second
+	DefaultReceiveTimeout = 60 * time.Second
+	DefaultSendTimeout    = 60 * time.Second
+	DefaultStreamTimeout  = 10 * time.Second
+)
+
+var (
+	ErrorServerNotSet = errors.New("WebTransport server is not set")
+)
+
+/**
+Stream of WebTransport session, session is closed with stream
+*/
+type sessionStream struct {
+	*wt.Stream
+	session *wt.Session
+}
+
+func (s sessionStream) Close() error {
+	s.Stream.Close()
+	return s.session.CloseWithError(0, "")
+}
+
+/**
+Socket.io transport over WebTransport (HTTP/3). Every connection is one
+session with one bidirectional stream of length-prefixed frames, opened
+by server. Server should be served by Server.H3, e.g.:
+
+	tr := webtransport.GetDefaultTransport()
+	tr.Server = &wt.Server{H3: http3.Server{Addr: ":443", Handler: mux}}
+	tr.Server.ListenAndServeTLS(certFile, keyFile)
+*/
+type Transport struct {
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	//used only if ping interval and timeout are not set
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	//time to wait for stream of new session
+	StreamTimeout time.Duration
+
+	//bigger incoming frames close the connection
+	MaxFrameSize int
+
+	RequestHeader http.Header
+
+	//server upgrading handshake requests to sessions, used by server connections
+	Server *wt.Server
+
+	//client dialer, e.g. with tls configuration, zero value one is used if not set
+	Dialer *wt.Dialer
+}
+
+func (t *Transport) params() transport.StreamParams {
+	return transport.StreamParams{
+		PingInterval:   t.PingInterval,
+		PingTimeout:    t.PingTimeout,
+		ReceiveTimeout: t.ReceiveTimeout,
+		SendTimeout:    t.SendTimeout,
+		MaxFrameSize:   t.MaxFrameSize,
+	}
+}
+
+/**
+Connect to server, ws and wss urls are converted to https ones
+*/
+func (t *Transport) Connect(rawUrl string) (conn transport.Connection, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	query := u.Query()
+	query.Set("transport", TransportName)
+	u.RawQuery = query.Encode()
+
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &wt.Dialer{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.StreamTimeout)
+	defer cancel()
+
+	_, session, err := dialer.Dial(ctx, u.String(), t.RequestHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := session.AcceptStream(ctx)
+	if err != nil {
+		session.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return transport.NewStreamConnection(sessionStream{stream, session}, t.params()), nil
+}
+
+/**
+Upgrade handshake request to WebTransport session and open its stream
+*/
+func (t *Transport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn transport.Connection, err error) {
+
+	if t.Server == nil {
+		http.Error(w, ErrorServerNotSet.Error(), http.StatusInternalServerError)
+		return nil, ErrorServerNotSet
+	}
+
+	session, err := t.Server.Upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), t.StreamTimeout)
+	defer cancel()
+
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		session.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return transport.NewStreamConnection(sessionStream{stream, session}, t.params()), nil
+}
+
+/**
+WebTransport session do not require any additional processing
+*/
+func (t *Transport) Serve(w http.ResponseWriter, r *http.Request) {}
+
+func (t *Transport) Name() string {
+	return TransportName
+}
+
+/**
+Returns WebTransport transport with default params, Server should be set
+to serve connections
+*/
+func GetDefaultTransport() *Transport {
+	return &Transport{
+		PingInterval:   DefaultPingInterval,
+		PingTimeout:    DefaultPingTimeout,
+		ReceiveTimeout: DefaultReceiveTimeout,
+		SendTimeout:    DefaultSendTimeout,
+		StreamTimeout:  DefaultStreamTimeout,
+	}
+}
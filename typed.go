@@ -0,0 +1,52 @@
+package gosocketio
+
+import (
+	"reflect"
+)
+
+/**
+Handlers registry, implemented by both Server and Client
+*/
+type HandlerRegistry interface {
+	addCaller(method string, c *caller)
+}
+
+/**
+Build caller for function with known payload type, no signature discovery required
+*/
+func newTypedCaller[T any](f interface{}, out bool) *caller {
+	return &caller{
+		Func:        reflect.ValueOf(f),
+		Args:        reflect.TypeOf((*T)(nil)).Elem(),
+		ArgsPresent: true,
+		Out:         out,
+	}
+}
+
+/**
+Add message processing function with payload type checked at compile time
+*/
+func Handle[T any](r HandlerRegistry, method string, f func(c *Channel, msg T)) {
+	r.addCaller(method, newTypedCaller[T](f, false))
+}
+
+/**
+Add ack processing function with payload and result types checked at compile time
+*/
+func HandleAck[T any, R any](r HandlerRegistry, method string, f func(c *Channel, msg T) R) {
+	r.addCaller(method, newTypedCaller[T](f, true))
+}
+
+/**
+Emit message with payload type checked at compile time
+*/
+func Emit[T any](c *Channel, method string, msg T) error {
+	return c.Emit(method, msg)
+}
+
+/**
+Broadcast message to room with payload type checked at compile time
+*/
+func BroadcastTo[T any](s *Server, room, method string, msg T) {
+	s.BroadcastTo(room, method, msg)
+}
@@ -0,0 +1,143 @@
+package gosocketio
+
+import (
+	"context"
+	"github.com/graarh/golang-socketio/protocol"
+	"sync"
+)
+
+/**
+Shared pool of goroutines processing incoming messages of all server
+channels, see WithWorkerPool
+*/
+type workerPool struct {
+	workers   int
+	queueSize int
+	running   *int64
+
+	//nil while pool is closed
+	tasks     chan func()
+	tasksLock sync.RWMutex
+	wg        sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int, running *int64) *workerPool {
+	p := &workerPool{
+		workers:   workers,
+		queueSize: queueSize,
+		running:   running,
+	}
+	p.start()
+	return p
+}
+
+/**
+Start workers, if pool is not started yet
+*/
+func (p *workerPool) start() {
+	p.tasksLock.Lock()
+	defer p.tasksLock.Unlock()
+
+	if p.tasks != nil {
+		return
+	}
+
+	p.tasks = make(chan func(), p.queueSize)
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(p.tasks)
+	}
+}
+
+func (p *workerPool) work(tasks chan func()) {
+	defer p.wg.Done()
+	defer trackGoroutine(p.running)()
+
+	for task := range tasks {
+		task()
+	}
+}
+
+/**
+Queue task, block while queue is full. Returns false if ctx is done first.
+Tasks of closed pool are run by new goroutines
+*/
+func (p *workerPool) run(ctx context.Context, task func()) bool {
+	p.tasksLock.RLock()
+	defer p.tasksLock.RUnlock()
+
+	if p.tasks == nil {
+		go task()
+		return true
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+/**
+Stop workers after queued tasks are done and wait for them until ctx is done
+*/
+func (p *workerPool) close(ctx context.Context) error {
+	p.tasksLock.Lock()
+	if p.tasks != nil {
+		close(p.tasks)
+		p.tasks = nil
+	}
+	p.tasksLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+Process incoming message by worker pool of server if it is set, by new
+goroutine otherwise. Reading of channel is paused while pool queue is full.
+Ack responses are processed right away, so handlers waiting for them
+in workers do not block the pool
+*/
+func (c *Channel) dispatchIncoming(m *methods, msg *protocol.Message) {
+	if c.server == nil || c.server.workers == nil {
+		go m.processIncomingMessage(c, msg)
+		return
+	}
+	if msg.Type == protocol.MessageTypeAckResponse {
+		m.processIncomingMessage(c, msg)
+		return
+	}
+
+	queued := c.runTask(func() {
+		m.processIncomingMessage(c, msg)
+	})
+	if !queued {
+		protocol.ReleaseMessage(msg)
+	}
+}
+
+/**
+Run task by worker pool of server if it is set, by new goroutine otherwise.
+Returns false if channel was closed while pool queue was full,
+task is not run then
+*/
+func (c *Channel) runTask(task func()) bool {
+	if c.server == nil || c.server.workers == nil {
+		go task()
+		return true
+	}
+
+	return c.server.workers.run(c.Context(), task)
+}
@@ -0,0 +1,141 @@
+package gosocketio
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	//queue marker of write callback, follows packet of emit with callback
+	writtenMarker = "\x00w"
+)
+
+/**
+Called by write loop when emitted packet is written to socket, err is nil
+then, or when packet is dropped, e.g. because channel is closed.
+Callback must not block or emit, write loop waits for it
+*/
+type WriteCallback func(err error)
+
+type writeCallbackKey struct{}
+
+/**
+Start emit with callback called when packet is written to socket
+or dropped, e.g. c.OnWrite(f).Emit("event", data)
+*/
+func (c *Channel) OnWrite(f WriteCallback) *Emitter {
+	return &Emitter{c: c, written: f}
+}
+
+/**
+Set write callback of emitter, see Channel.OnWrite
+*/
+func (e *Emitter) OnWrite(f WriteCallback) *Emitter {
+	e.written = f
+	return e
+}
+
+func writeCallbackOf(ctx context.Context) WriteCallback {
+	f, _ := ctx.Value(writeCallbackKey{}).(WriteCallback)
+	return f
+}
+
+/**
+Write callbacks waiting for their markers to be taken by write loop
+*/
+type writeCallbacks struct {
+	pending map[uint64]WriteCallback
+	nextId  uint64
+	closed  error
+	lock    sync.Mutex
+}
+
+/**
+Register callback, it is called right away with close reason
+if channel is already closed
+*/
+func (w *writeCallbacks) add(f WriteCallback) (uint64, bool) {
+	w.lock.Lock()
+	if w.closed != nil {
+		reason := w.closed
+		w.lock.Unlock()
+		f(reason)
+		return 0, false
+	}
+	if w.pending == nil {
+		w.pending = make(map[uint64]WriteCallback)
+	}
+	w.nextId++
+	id := w.nextId
+	w.pending[id] = f
+	w.lock.Unlock()
+
+	return id, true
+}
+
+/**
+Call callback with given result, if it is still waiting
+*/
+func (w *writeCallbacks) fire(id uint64, err error) {
+	w.lock.Lock()
+	f, ok := w.pending[id]
+	delete(w.pending, id)
+	w.lock.Unlock()
+
+	if ok {
+		f(err)
+	}
+}
+
+/**
+Call all waiting callbacks with close reason of channel
+*/
+func (w *writeCallbacks) closeAll(reason error) {
+	w.lock.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.closed = reason
+	w.lock.Unlock()
+
+	for _, f := range pending {
+		f(reason)
+	}
+}
+
+/**
+Accept callbacks again, after client reconnection
+*/
+func (w *writeCallbacks) reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.closed = nil
+}
+
+/**
+Queue marker of write callback after already queued packet
+*/
+func (c *Channel) enqueueWriteCallback(ctx context.Context, f WriteCallback) {
+	id, ok := c.written.add(f)
+	if !ok {
+		return
+	}
+
+	if err := c.enqueueContext(ctx, writtenMarker+strconv.FormatUint(id, 10)); err != nil {
+		c.written.fire(id, err)
+	}
+}
+
+/**
+Get id of write callback by its queue marker, false for other packets
+*/
+func parseWrittenMarker(msg string) (uint64, bool) {
+	if !strings.HasPrefix(msg, writtenMarker) {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(msg[len(writtenMarker):], 10, 64)
+	return id, err == nil
+}
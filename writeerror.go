@@ -0,0 +1,29 @@
+package gosocketio
+
+/**
+Hook called when write to channel fails, before channel is closed.
+Packets are encoded ones which were not written, the failed one first,
+so their payload can be persisted or sent elsewhere
+*/
+type WriteErrorHook func(c *Channel, err error, packets []string)
+
+/**
+Add hook called with write error and unwritten packets of channel,
+hooks are called by write loop in the order they were added
+*/
+func (c *Channel) OnWriteError(f WriteErrorHook) {
+	c.writeErrorHooksLock.Lock()
+	defer c.writeErrorHooksLock.Unlock()
+
+	c.writeErrorHooks = append(c.writeErrorHooks, f)
+}
+
+func (c *Channel) callWriteErrorHooks(err error, packets []string) {
+	c.writeErrorHooksLock.RLock()
+	hooks := c.writeErrorHooks
+	c.writeErrorHooksLock.RUnlock()
+
+	for _, f := range hooks {
+		f(c, err, packets)
+	}
+}